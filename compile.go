@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var compileCmd = &command{
+	name:  "compile",
+	usage: "file",
+	short: "compile a program of the structured language to WHILE",
+}
+
+func init() {
+	compileCmd.run = runCompile
+}
+
+func runCompile(args []string) error {
+	flags := newFlagSet(compileCmd)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file")
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	prog, err := whilego.CompileStructured(bytes.NewReader(src))
+	if err != nil {
+		return fmt.Errorf("%s:%s", flags.Arg(0), err)
+	}
+	fmt.Println(whilego.Format(prog))
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var coverCmd = &command{
+	name:  "cover",
+	usage: "[-dialect name] [-html out.html] cover.out",
+	short: "summarize a coverage profile written by run -coverprofile",
+}
+
+func init() {
+	coverCmd.run = runCover
+}
+
+func runCover(args []string) error {
+	flags := newFlagSet(coverCmd)
+	htmlFile := flags.String("html", "", "write an HTML report of the only program in the profile to `file`")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single coverage profile")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	sources, err := profileSources(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *htmlFile != "" && len(sources) != 1 {
+		return fmt.Errorf("the HTML report needs a profile of exactly one program, got %d", len(sources))
+	}
+
+	for _, source := range sources {
+		prog, src, _, err := parseProgram(source, dialect)
+		if err != nil {
+			return err
+		}
+		cover := whilego.NewCoverage(prog)
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		err = cover.ReadProfile(f, source)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", flags.Arg(0), err)
+		}
+		fmt.Printf("%s: %s\n", source, cover.Summary())
+
+		if *htmlFile != "" {
+			out, err := os.Create(*htmlFile)
+			if err != nil {
+				return err
+			}
+			if err = cover.WriteHTML(out, src, source); err != nil {
+				out.Close()
+				return err
+			}
+			if err = out.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// profileSources returns the source files contained in a coverage profile in
+// the order of their first appearance.
+func profileSources(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sources []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndex(line, ":")
+		if strings.HasPrefix(line, "mode: ") || i < 0 || seen[line[:i]] {
+			continue
+		}
+		seen[line[:i]] = true
+		sources = append(sources, line[:i])
+	}
+	return sources, scanner.Err()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var debugCmd = &command{
+	name:  "debug",
+	usage: "[-limit n] [-dialect name] file [x1 x2 ...]",
+	short: "debug a program interactively, also backwards in time",
+}
+
+func init() {
+	debugCmd.run = runDebug
+}
+
+const debugHelp = `commands:
+  s, step [n]              execute n steps (default 1)
+  rs, reverse-step [n]     revert n steps (default 1)
+  c, continue              run until a breakpoint, watchpoint or the end
+  rc, reverse-continue     run backwards until a breakpoint, watchpoint or the start
+  g, goto n                jump to step n
+  b, break line            set a breakpoint on line
+  d, delete line           delete the breakpoint on line
+  w, watch var             stop when the variable xN or name changes
+  unwatch var              remove the watchpoint on the variable
+  p, print [var]           print all variables or only one
+  l, list                  list the program
+  i, info                  show breakpoints and watchpoints
+  h, help                  show this help
+  q, quit                  quit the debugger
+`
+
+// debugSession is the state of an interactive debugging session.
+type debugSession struct {
+	d     *whilego.Debugger
+	lines []string
+	// names are the named variables of the program or nil.
+	names *whilego.Names
+	out   io.Writer
+}
+
+func runDebug(args []string) error {
+	flags := newFlagSet(debugCmd)
+	limit := flags.Int("limit", 1000000, "maximum number of steps per continue, 0 means no limit")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return fmt.Errorf("missing file")
+	}
+	if flags.Arg(0) == "-" {
+		return fmt.Errorf("the program can not be read from stdin while debugging")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	prog, src, names, err := parseProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	input, err := parseInput(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	s := &debugSession{
+		d:     whilego.NewDebugger(prog, input...),
+		lines: strings.Split(strings.TrimRight(string(src), "\n"), "\n"),
+		names: names,
+		out:   os.Stdout,
+	}
+	s.d.Limit = *limit
+	s.printLocation()
+	return s.repl(os.Stdin)
+}
+
+// repl reads and executes commands until quit or the end of the input.
+func (s *debugSession) repl(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(s.out, "(wdb) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		if err := s.exec(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err)
+		}
+	}
+}
+
+// exec executes a single debugger command.
+func (s *debugSession) exec(cmd string, args []string) error {
+	in := s.d.Interpreter()
+	switch cmd {
+	case "s", "step":
+		return s.repeat(args, s.d.Step)
+	case "rs", "reverse-step":
+		return s.repeat(args, s.d.ReverseStep)
+	case "c", "continue":
+		s.printStop(s.d.Continue())
+	case "rc", "reverse-continue":
+		s.printStop(s.d.ReverseContinue())
+	case "g", "goto":
+		step, err := intArg(args)
+		if err != nil {
+			return err
+		}
+		if err = s.d.Goto(step); err != nil {
+			return err
+		}
+		s.printLocation()
+	case "b", "break":
+		line, err := intArg(args)
+		if err != nil {
+			return err
+		}
+		s.d.SetBreakpoint(line)
+	case "d", "delete":
+		line, err := intArg(args)
+		if err != nil {
+			return err
+		}
+		s.d.ClearBreakpoint(line)
+	case "w", "watch", "unwatch":
+		v, err := s.variableArg(args)
+		if err != nil {
+			return err
+		}
+		if cmd == "unwatch" {
+			s.d.Unwatch(v)
+		} else {
+			s.d.Watch(v)
+		}
+	case "p", "print":
+		if len(args) == 0 {
+			regs := in.Registers()
+			for i, val := range in.Vars() {
+				fmt.Fprintf(s.out, "%s = %d\n", s.names.Name(regs[i]), val)
+			}
+			return nil
+		}
+		v, err := s.variableArg(args)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "%s = %d\n", s.names.Name(v), in.Var(v))
+	case "l", "list":
+		current := 0
+		if next := in.Next(); next != nil {
+			current = next.Pos.Line
+		}
+		for i, line := range s.lines {
+			marker := " "
+			if i+1 == current {
+				marker = ">"
+			}
+			fmt.Fprintf(s.out, "%s%4d  %s\n", marker, i+1, line)
+		}
+	case "i", "info":
+		var watches []string
+		for _, v := range s.d.Watches() {
+			watches = append(watches, s.names.Name(v))
+		}
+		fmt.Fprintf(s.out, "breakpoints: %v\nwatchpoints: %v\n", s.d.Breakpoints(), watches)
+	case "h", "help":
+		fmt.Fprint(s.out, debugHelp)
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return nil
+}
+
+// repeat calls step as often as given by the optional argument and stops
+// early if a breakpoint, watchpoint or the end is reached.
+func (s *debugSession) repeat(args []string, step func() whilego.Stop) error {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = intArg(args); err != nil {
+			return err
+		}
+	}
+
+	stop := whilego.STOP_STEP
+	for i := 0; i < n && stop == whilego.STOP_STEP; i++ {
+		stop = step()
+	}
+	s.printStop(stop)
+	return nil
+}
+
+// printStop prints why the debugger stopped and the current location.
+func (s *debugSession) printStop(stop whilego.Stop) {
+	switch stop {
+	case whilego.STOP_END:
+		if s.d.Interpreter().Done() {
+			fmt.Fprintln(s.out, "program halted")
+		} else {
+			fmt.Fprintln(s.out, "reached the start of the program")
+		}
+	case whilego.STOP_BREAKPOINT:
+		fmt.Fprintln(s.out, "breakpoint")
+	case whilego.STOP_WATCHPOINT:
+		fmt.Fprintln(s.out, "watchpoint")
+	case whilego.STOP_LIMIT:
+		fmt.Fprintf(s.out, "stopped after %d steps\n", s.d.Limit)
+	}
+	s.printLocation()
+}
+
+// printLocation prints the current step and the source line executed next.
+func (s *debugSession) printLocation() {
+	in := s.d.Interpreter()
+	next := in.Next()
+	if next == nil {
+		fmt.Fprintf(s.out, "step %d: end, %s = %d\n", in.Steps(), s.names.Name(0), in.Var(0))
+		return
+	}
+
+	line := ""
+	if l := next.Pos.Line; l > 0 && l <= len(s.lines) {
+		line = strings.TrimSpace(s.lines[l-1])
+	}
+	fmt.Fprintf(s.out, "step %d at %s: %s\n", in.Steps(), next.Pos, line)
+}
+
+// intArg parses the single natural number argument of a command.
+func intArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a single number as argument")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", args[0])
+	}
+	return n, nil
+}
+
+// variableArg parses the single variable argument of a command, which is
+// either xN or a name of the program.
+func (s *debugSession) variableArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a single variable as argument")
+	}
+	if v, ok := s.names.Register(args[0]); ok {
+		return v, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(args[0], "x"))
+	if err != nil || n < 0 || !strings.HasPrefix(args[0], "x") {
+		return 0, fmt.Errorf("invalid variable %q", args[0])
+	}
+	return n, nil
+}
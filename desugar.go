@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var desugarCmd = &command{
+	name:  "desugar",
+	usage: "[-dialect name] file",
+	short: "print the core program of a program in the sugar dialect",
+}
+
+func init() {
+	desugarCmd.run = runDesugar
+}
+
+func runDesugar(args []string) error {
+	flags := newFlagSet(desugarCmd)
+	dialectName := flags.String("dialect", "sugar", "parse the program in the dialect `name`, one of "+dialectNames())
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	prog, err := parseCoreProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	fmt.Println(whilego.Format(prog))
+	return nil
+}
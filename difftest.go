@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var difftestCmd = &command{
+	name:  "difftest",
+	usage: "[-n count] [-seed s] [-limit steps] [-engines names] [-dialect name] [file...]",
+	short: "compare all engines with the interpreter on random or given programs",
+}
+
+func init() {
+	difftestCmd.run = runDifftest
+}
+
+// difftestInputs are the inputs every program is run with.
+var difftestInputs = [][]uint64{nil, {1}, {2, 1}, {0, 3, 1}, {4, 2, 3, 1}}
+
+func runDifftest(args []string) error {
+	flags := newFlagSet(difftestCmd)
+	count := flags.Int("n", 1000, "number of random programs if no files are given")
+	seed := flags.Int64("seed", 0, "seed of the random programs, 0 means the current time")
+	limit := flags.Int("limit", 10000, "maximum number of steps, programs running longer are skipped")
+	engineNames := flags.String("engines", "", "comma separated engines to compare, all by default")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+
+	var engines []whilego.Engine
+	if *engineNames != "" {
+		for _, name := range strings.Split(*engineNames, ",") {
+			e, ok := whilego.LookupEngine(name)
+			if !ok {
+				return fmt.Errorf("unknown engine %q", name)
+			}
+			engines = append(engines, e)
+		}
+	}
+
+	var progs []*whilego.Expr
+	for _, file := range flags.Args() {
+		prog, err := parseCoreProgram(file, dialect)
+		if err != nil {
+			return err
+		}
+		progs = append(progs, prog)
+	}
+	if len(progs) == 0 {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		rng := rand.New(rand.NewSource(*seed))
+		for i := 0; i < *count; i++ {
+			progs = append(progs, whilego.Generate(rng, whilego.DefaultGenerateOptions))
+		}
+	}
+
+	mismatches := 0
+	for _, prog := range progs {
+		for _, input := range difftestInputs {
+			if m := whilego.Diff(prog, *limit, input, engines); m != nil {
+				mismatches++
+				fmt.Printf("%s\n\n", m.Shrink(*limit))
+				break
+			}
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d programs differ", mismatches, len(progs))
+	}
+	fmt.Printf("%d programs agree\n", len(progs))
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var encodeCmd = &command{
+	name:  "encode",
+	usage: "[-dialect name] file",
+	short: "print the Gödel number of a program",
+}
+
+var decodeCmd = &command{
+	name:  "decode",
+	usage: "number",
+	short: "print the program with a Gödel number, - reads it from stdin",
+}
+
+func init() {
+	encodeCmd.run = runEncode
+	decodeCmd.run = runDecode
+}
+
+func runEncode(args []string) error {
+	flags := newFlagSet(encodeCmd)
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	prog, err := parseCoreProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	code, err := whilego.Encode(prog)
+	if err != nil {
+		return err
+	}
+	fmt.Println(code)
+	return nil
+}
+
+func runDecode(args []string) error {
+	flags := newFlagSet(decodeCmd)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single number")
+	}
+
+	text := flags.Arg(0)
+	if text == "-" {
+		src, err := readSource(text)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimSpace(string(src))
+	}
+	n, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return fmt.Errorf("invalid number %q", text)
+	}
+	prog, err := whilego.Decode(n)
+	if err != nil {
+		return err
+	}
+	fmt.Println(whilego.Format(prog))
+	return nil
+}
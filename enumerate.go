@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var enumerateCmd = &command{
+	name:  "enumerate",
+	usage: "[-max-size n] [-vars k] [-limit steps] [-parallel n]",
+	short: "run all programs up to a size and search for busy beavers",
+}
+
+func init() {
+	enumerateCmd.run = runEnumerate
+}
+
+// beaver is a halting program found by enumerate. index is its position in
+// the canonical order.
+type beaver struct {
+	index  int
+	prog   *whilego.Expr
+	output uint64
+	steps  int
+}
+
+// better reports whether b is better than c for the given value, where
+// programs earlier in the canonical order win ties.
+func (b *beaver) better(c *beaver, value func(*beaver) uint64) bool {
+	return c == nil || value(b) > value(c) || value(b) == value(c) && b.index < c.index
+}
+
+func runEnumerate(args []string) error {
+	flags := newFlagSet(enumerateCmd)
+	maxSize := flags.Int("max-size", 4, "maximum number of statements of the programs")
+	vars := flags.Int("vars", 2, "number of variables x0, ..., x(k-1) of the programs")
+	limit := flags.Int("limit", 10000, "maximum number of steps of a program")
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of programs to run in parallel")
+	flags.Parse(args)
+	if flags.NArg() != 0 || *maxSize < 1 || *vars < 1 || *limit < 1 || *parallel < 1 {
+		flags.Usage()
+		return fmt.Errorf("invalid arguments")
+	}
+
+	type job struct {
+		index int
+		prog  *whilego.Expr
+	}
+	jobs := make(chan job)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var mostOutput, mostSteps *beaver
+	halted := 0
+	for w := 0; w < *parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				in := whilego.NewInterpreter(j.prog)
+				if in.Run(*limit) != nil {
+					continue
+				}
+				b := &beaver{j.index, j.prog, in.Var(0), in.Steps()}
+				mu.Lock()
+				halted++
+				if b.better(mostOutput, func(b *beaver) uint64 { return b.output }) {
+					mostOutput = b
+				}
+				if b.better(mostSteps, func(b *beaver) uint64 { return uint64(b.steps) }) {
+					mostSteps = b
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	count := 0
+	whilego.Enumerate(*maxSize, *vars, func(prog *whilego.Expr) bool {
+		jobs <- job{count, prog}
+		count++
+		return true
+	})
+	close(jobs)
+	wg.Wait()
+
+	fmt.Printf("%d programs, %d halted, %d exceeded %d steps\n", count, halted, count-halted, *limit)
+	if mostOutput != nil {
+		fmt.Printf("\nlargest x0 = %d (%d steps):\n%s\n", mostOutput.output, mostOutput.steps, whilego.Format(mostOutput.prog))
+		fmt.Printf("\nmost steps = %d (x0 = %d):\n%s\n", mostSteps.steps, mostSteps.output, whilego.Format(mostSteps.prog))
+	}
+	return nil
+}
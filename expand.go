@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var expandCmd = &command{
+	name:  "expand",
+	usage: "file",
+	short: "print a program with all macros expanded",
+}
+
+func init() {
+	expandCmd.run = runExpand
+}
+
+func runExpand(args []string) error {
+	flags := newFlagSet(expandCmd)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file")
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	expanded, _, err := whilego.Preprocess(string(src))
+	if err != nil {
+		return fmt.Errorf("%s:%s", flags.Arg(0), err)
+	}
+	fmt.Println(expanded)
+	return nil
+}
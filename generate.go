@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var generateCmd = &command{
+	name:  "generate",
+	usage: "[-n count] [-seed s] [-depth d] [-vars k] [-statements n] [-loops p] [-terminating]",
+	short: "print random programs",
+}
+
+func init() {
+	generateCmd.run = runGenerate
+}
+
+func runGenerate(args []string) error {
+	opts := whilego.DefaultGenerateOptions
+	flags := newFlagSet(generateCmd)
+	count := flags.Int("n", 1, "number of programs")
+	seed := flags.Int64("seed", 0, "seed of the random numbers, 0 means the current time")
+	flags.IntVar(&opts.Depth, "depth", opts.Depth, "maximum nesting depth of loops")
+	flags.IntVar(&opts.Vars, "vars", opts.Vars, "number of variables x0, ..., x(k-1)")
+	flags.IntVar(&opts.Statements, "statements", opts.Statements, "maximum number of statements of a sequence")
+	flags.Float64Var(&opts.LoopProb, "loops", opts.LoopProb, "probability of a statement being a loop")
+	flags.BoolVar(&opts.Terminating, "terminating", false, "only generate bounded loops, so the programs always halt")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments")
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	for i := 0; i < *count; i++ {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(whilego.Format(whilego.Generate(rng, opts)))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var gotoCmd = &command{
+	name:  "goto",
+	usage: "[-dialect name | -reverse [-core]] file",
+	short: "translate a program to GOTO or a GOTO program back to WHILE",
+}
+
+func init() {
+	gotoCmd.run = runGoto
+}
+
+func runGoto(args []string) error {
+	flags := newFlagSet(gotoCmd)
+	reverse := flags.Bool("reverse", false, "translate a GOTO program to a WHILE program with a single loop")
+	core := flags.Bool("core", false, "desugar the conditionals of the single loop program")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file")
+	}
+
+	if !*reverse {
+		dialect, err := lookupDialect(*dialectName)
+		if err != nil {
+			return err
+		}
+		prog, err := parseCoreProgram(flags.Arg(0), dialect)
+		if err != nil {
+			return err
+		}
+		g, err := whilego.CompileGoto(prog)
+		if err != nil {
+			return err
+		}
+		fmt.Println(g)
+		return nil
+	}
+
+	if *dialectName != "strict" {
+		return fmt.Errorf("-dialect and -reverse can not be combined")
+	}
+	prog, err := parseGotoFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	while, err := whilego.GotoToWhile(prog)
+	if err != nil {
+		return err
+	}
+	if *core {
+		if while, err = whilego.Desugar(while); err != nil {
+			return err
+		}
+	}
+	fmt.Println(whilego.Format(while))
+	return nil
+}
+
+// parseGotoFile reads the GOTO program in the given file and parses it.
+func parseGotoFile(filename string) (*whilego.GotoProgram, error) {
+	src, err := readSource(filename)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := whilego.NewParser(bytes.NewReader(src)).ParseGoto()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", filename, err)
+	}
+	return prog, nil
+}
+
+// runGotoProgram runs the GOTO program in the given file and prints x0.
+func runGotoProgram(filename string, limit int, args []string) error {
+	prog, err := parseGotoFile(filename)
+	if err != nil {
+		return err
+	}
+	input, err := parseInput(args)
+	if err != nil {
+		return err
+	}
+	x0, err := whilego.RunGoto(prog, limit, input...)
+	if err != nil {
+		return err
+	}
+	fmt.Println(x0)
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var gradeCmd = &command{
+	name:  "grade",
+	usage: "-spec spec.json [-format text|json|junit] [-parallel n] [-dialect name] submission.while|dir|dir/... ...",
+	short: "grade submissions against hidden tests",
+}
+
+func init() {
+	gradeCmd.run = runGrade
+}
+
+func runGrade(args []string) error {
+	flags := newFlagSet(gradeCmd)
+	specFile := flags.String("spec", "", "grading specification in JSON")
+	format := flags.String("format", "text", "output format: text, json or junit")
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of submissions to grade in parallel")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if *specFile == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing specification or submissions")
+	}
+	if *parallel < 1 {
+		flags.Usage()
+		return fmt.Errorf("invalid arguments")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*specFile)
+	if err != nil {
+		return err
+	}
+	spec, err := whilego.ParseGradeSpec(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s", *specFile, err)
+	}
+
+	files, err := findPrograms(flags.Args())
+	if err != nil {
+		return err
+	}
+	results := gradeAll(files, spec, dialect, *parallel)
+
+	switch *format {
+	case "text":
+		for _, r := range results {
+			fmt.Printf("%s: %s (%d/%d passed)\n", r.Submission, r.Verdict, r.Passed, len(spec.Tests))
+			for _, e := range r.Errors {
+				fmt.Printf("    %s\n", e)
+			}
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "junit":
+		return whilego.WriteJUnit(os.Stdout, results)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	return nil
+}
+
+// gradeAll grades the submissions in the given dialect using parallel
+// workers. The results are in the order of the files.
+func gradeAll(files []string, spec *whilego.GradeSpec, d whilego.Dialect, parallel int) []whilego.GradeResult {
+	results := make([]whilego.GradeResult, len(files))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = gradeFile(files[i], spec, d)
+			}
+		}()
+	}
+
+	for i := range files {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// gradeFile parses and grades a single submission. Submissions are parsed
+// like by run, so they may use the macros, the standard library and
+// procedures, but they can not import other files, which could be read by
+// the grader otherwise. Like GradeProgram, a panic while parsing is reported
+// as VERDICT_CRASH.
+func gradeFile(file string, spec *whilego.GradeSpec, d whilego.Dialect) (result whilego.GradeResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = whilego.GradeResult{Submission: file, Verdict: whilego.VERDICT_CRASH, Errors: []string{fmt.Sprint(r)}}
+		}
+	}()
+
+	prog, _, _, err := parseFile(file, d, nil)
+	if err != nil {
+		return whilego.GradeResult{
+			Submission: file,
+			Verdict:    whilego.VERDICT_PARSE_ERROR,
+			Errors:     []string{err.Error()},
+		}
+	}
+	if d.Sugar {
+		if prog, err = whilego.Desugar(prog); err != nil {
+			return whilego.GradeResult{
+				Submission: file,
+				Verdict:    whilego.VERDICT_PARSE_ERROR,
+				Errors:     []string{err.Error()},
+			}
+		}
+	}
+	return whilego.GradeProgram(file, prog, spec)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var loopsCmd = &command{
+	name:  "loops",
+	usage: "[-dialect name] [-rewrite] file",
+	short: "classify the loops of a program as bounded or general",
+}
+
+func init() {
+	loopsCmd.run = runLoops
+}
+
+func runLoops(args []string) error {
+	flags := newFlagSet(loopsCmd)
+	rewrite := flags.Bool("rewrite", false, "print the program in the LOOP language if all loops are bounded")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single file")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	prog, _, names, err := parseProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	if *rewrite {
+		loop, err := whilego.ToLoop(prog)
+		if err != nil {
+			return fmt.Errorf("%s:%s", flags.Arg(0), err)
+		}
+		fmt.Println(names.Replace(whilego.Format(loop)))
+		return nil
+	}
+
+	for _, info := range whilego.ClassifyLoops(prog) {
+		fmt.Printf("%s:%s\n", flags.Arg(0), names.Replace(info.String()))
+	}
+	return nil
+}
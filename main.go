@@ -1,7 +1,225 @@
 package main
 
-import "fmt"
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+// command is a subcommand of whilego like run or debug.
+type command struct {
+	name  string
+	usage string
+	short string
+	run   func(args []string) error
+}
+
+// commands contains all available subcommands.
+// The run functions are set in the init functions of the commands, since
+// they refer to the command themselves for printing the usage.
+var commands = []*command{
+	runCmd,
+	debugCmd,
+	coverCmd,
+	testCmd,
+	gradeCmd,
+	expandCmd,
+	desugarCmd,
+	gotoCmd,
+	loopsCmd,
+	compileCmd,
+	encodeCmd,
+	decodeCmd,
+	universalCmd,
+	enumerateCmd,
+	generateCmd,
+	difftestCmd,
+	reduceCmd,
+	vetCmd,
+	proveCmd,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: whilego <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+}
 
 func main() {
-	fmt.Println("whilego!")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "whilego %s: %s\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "whilego: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// newFlagSet creates the flag set of a command with a usage message.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: whilego %s %s\n", cmd.name, cmd.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// readSource reads the file with the given name or stdin if the name is "-".
+func readSource(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// dialectFlag defines the -dialect flag of a command which parses programs.
+func dialectFlag(flags *flag.FlagSet) *string {
+	return flags.String("dialect", "strict", "parse programs in the dialect `name`, one of "+dialectNames())
+}
+
+// dialectNames returns the names of the built-in dialects for usage messages.
+func dialectNames() string {
+	names := make([]string, len(whilego.Dialects))
+	for i, d := range whilego.Dialects {
+		names[i] = d.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// lookupDialect returns the built-in dialect given by the -dialect flag.
+func lookupDialect(name string) (whilego.Dialect, error) {
+	d, ok := whilego.LookupDialect(name)
+	if !ok {
+		return d, fmt.Errorf("unknown dialect %q", name)
+	}
+	return d, nil
+}
+
+// parseProgram parses the program in the given file with parseFileWith and
+// desugars it if it is written in the sugar dialect, so it can be run by the
+// interpreter.
+func parseProgram(filename string, d whilego.Dialect) (*whilego.Expr, []byte, *whilego.Names, error) {
+	prog, src, names, err := parseFileWith(filename, d)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if d.Sugar {
+		if prog, err = whilego.Desugar(prog); err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+	return prog, src, names, nil
+}
+
+// parseCoreProgram is like parseProgram, but also lowers LOOP expressions and
+// general increments, so the result is a program of the core language.
+func parseCoreProgram(filename string, d whilego.Dialect) (*whilego.Expr, error) {
+	prog, _, _, err := parseFileWith(filename, d)
+	if err != nil {
+		return nil, err
+	}
+	if prog, err = whilego.Desugar(prog); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return prog, nil
+}
+
+// parseFileWith reads the program in the given file, expands its macros,
+// parses it in the given dialect and links its imports and procedures.
+// Programs with named variables can not have procedures. Their names are
+// returned to show the registers by name, otherwise the names are nil.
+func parseFileWith(filename string, d whilego.Dialect) (*whilego.Expr, []byte, *whilego.Names, error) {
+	return parseFile(filename, d, moduleLoader(d))
+}
+
+// parseFile is like parseFileWith, but loads imported modules with load.
+// Imports are rejected if load is nil.
+func parseFile(filename string, d whilego.Dialect, load func(*whilego.Module, string) (*whilego.Module, error)) (*whilego.Expr, []byte, *whilego.Names, error) {
+	src, err := readSource(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if d.Names {
+		prog, smap, err := whilego.ParseMacrosWith(string(src), d)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s:%s", filename, err)
+		}
+		return prog, src, smap.Names, nil
+	}
+
+	m, _, err := whilego.ParseModuleMacros(string(src), d)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s:%s", filename, err)
+	}
+	m.Path = filename
+	prog, err := whilego.Link(m, load)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return prog, src, nil, nil
+}
+
+// moduleLoader returns a function loading the modules imported by a file.
+// Relative paths are relative to the directory of the importing file.
+func moduleLoader(d whilego.Dialect) func(*whilego.Module, string) (*whilego.Module, error) {
+	return func(from *whilego.Module, path string) (*whilego.Module, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(from.Path), path)
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		m, _, err := whilego.ParseModuleMacros(string(src), d)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s", path, err)
+		}
+		m.Path = path
+		return m, nil
+	}
+}
+
+// parseInput converts the arguments to the input values x1, x2, ...
+func parseInput(args []string) ([]uint64, error) {
+	input := make([]uint64, len(args))
+	for i, arg := range args {
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input x%d: %s", i+1, err)
+		}
+		input[i] = n
+	}
+	return input, nil
+}
+
+// inputCount returns the number of inputs given by the -inputs flag or, if
+// it is unknown, by the INPUT header of a program with named variables.
+func inputCount(inputs int, names *whilego.Names) int {
+	if inputs < 0 && names != nil && len(names.Inputs) > 0 {
+		return len(names.Inputs)
+	}
+	return inputs
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+// writeProgram writes src to a file in dir and returns its name.
+func writeProgram(t *testing.T, dir, src string) string {
+	file := filepath.Join(dir, "prog.while")
+	if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParseFileWithSugarIf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whilego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := writeProgram(t, dir, "IF x1 = 0 THEN x0 := 5 ELSE x0 := x1 * x1 END")
+
+	prog, _, _, err := parseFileWith(file, whilego.SugarDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, expected := range map[uint64]uint64{0: 5, 3: 9} {
+		core, err := whilego.Desugar(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := whilego.Run(core, 0, input); err != nil || got != expected {
+			t.Errorf("%d: expected %d, got %d, %v", input, expected, got, err)
+		}
+	}
+}
+
+func TestParseCoreProgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whilego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		dialect string
+		src     string
+	}{
+		"Strict":    {"strict", "WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1; x0 := x0 + 1 END"},
+		"Sugar":     {"sugar", "x2 := 2; x0 := x1 * x2"},
+		"Loop":      {"loop", "LOOP x1 DO x0 := x0 + 1; x0 := x0 + 1 END"},
+		"Schoening": {"schoening", "x2 := x1 + 0; WHILE x2 ≠ 0 DO x2 := x2 - 1; x0 := x0 + 2 END"},
+	}
+	for caseName, testCase := range tests {
+		d, err := lookupDialect(testCase.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := parseCoreProgram(writeProgram(t, dir, testCase.src), d)
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		// Only programs of the core language can be read back strictly.
+		core, err := whilego.NewParser(strings.NewReader(whilego.Format(prog))).Parse()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		if got, err := whilego.Run(core, 0, 3); err != nil || got != 6 {
+			t.Errorf("%s: expected 6, got %d, %v", caseName, got, err)
+		}
+	}
+
+	if _, err = lookupDialect("unknown"); err == nil {
+		t.Errorf("expected an error for an unknown dialect")
+	}
+}
+
+func TestParseFileWithNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whilego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeProgram(t, dir, "INPUT a, b; OUTPUT r;\nMUL(r, a, b)")
+	prog, _, names, err := parseProgram(file, whilego.NamedDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := whilego.Run(prog, 0, 3, 4); err != nil || got != 12 {
+		t.Errorf("expected 12, got %d, %v", got, err)
+	}
+	if got := names.Replace("x0 := x2 + 0"); got != "r := b + 0" {
+		t.Errorf("expected the registers by name, got %q", got)
+	}
+
+	file = writeProgram(t, dir, "INPUT a; OUTPUT r; r := a + q")
+	if _, _, _, err = parseProgram(file, whilego.NamedDialect); err == nil || err.Error() != file+":1:29: undefined variable q" {
+		t.Errorf("expected undefined variable q, got %v", err)
+	}
+	if _, _, names, err = parseProgram(writeProgram(t, dir, "x0 := x0 + 1"), whilego.StrictDialect); err != nil || names != nil {
+		t.Errorf("expected no names, got %v, %v", names, err)
+	}
+}
+
+func TestInputCount(t *testing.T) {
+	p := whilego.NewParser(strings.NewReader("INPUT a, b; OUTPUT r; r := a + 0"), whilego.NamedDialect)
+	if _, err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	names := p.Names()
+	for _, c := range []struct {
+		inputs   int
+		names    *whilego.Names
+		expected int
+	}{{-1, names, 2}, {3, names, 3}, {-1, nil, -1}, {1, nil, 1}} {
+		if got := inputCount(c.inputs, c.names); got != c.expected {
+			t.Errorf("inputCount(%d): expected %d, got %d", c.inputs, c.expected, got)
+		}
+	}
+}
+
+func TestGradeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whilego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := &whilego.GradeSpec{
+		Tests:        []whilego.TestCase{{Input: []uint64{2}, Expected: 2}},
+		StepLimit:    1000,
+		Restrictions: whilego.Restrictions{NoNestedLoops: true, MaxVariables: 2, MaxLoops: 1},
+	}
+	tests := map[string]struct {
+		dialect whilego.Dialect
+		src     string
+		verdict whilego.Verdict
+	}{
+		"Pass":   {whilego.LoopDialect, "LOOP x1 DO x0 := x0 + 1 END", whilego.VERDICT_PASS},
+		"Nested": {whilego.LoopDialect, "LOOP x1 DO LOOP x2 DO LOOP x7 DO x8 := x8 + 1 END; x0 := x0 + 1 END END", whilego.VERDICT_RESTRICTED},
+		"Import": {whilego.StrictDialect, "IMPORT \"../spec.json\"\nx0 := x0 + 1", whilego.VERDICT_PARSE_ERROR},
+	}
+	for caseName, testCase := range tests {
+		r := gradeFile(writeProgram(t, dir, testCase.src), spec, testCase.dialect)
+		if r.Verdict != testCase.verdict {
+			t.Errorf("%s: expected %s, got %s %v", caseName, testCase.verdict, r.Verdict, r.Errors)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "fmt"
+
+// LoopKind is the classification of a while expression.
+type LoopKind int
+
+const (
+	// LOOP_GENERAL is a while expression which may not halt.
+	LOOP_GENERAL LoopKind = iota
+	// LOOP_BOUNDED is a while expression behaving like a LOOP expression.
+	LOOP_BOUNDED
+)
+
+// String returns the name of the loop kind.
+func (k LoopKind) String() string {
+	if k == LOOP_BOUNDED {
+		return "bounded"
+	}
+	return "general"
+}
+
+// LoopInfo is the classification of a while expression.
+type LoopInfo struct {
+	Loop *Expr
+	Kind LoopKind
+	// Reason explains why the loop is general.
+	Reason string
+}
+
+// String returns the classification in the form
+// `3:1: WHILE x1 != 0 DO: general, x1 is incremented in the body`.
+func (l LoopInfo) String() string {
+	s := fmt.Sprintf("%s: %s: %s", l.Loop.Pos, statementString(l.Loop), l.Kind)
+	if l.Reason != "" {
+		s += ", " + l.Reason
+	}
+	return s
+}
+
+// ClassifyLoops classifies the while expressions of prog in source order.
+//
+// A while expression `WHILE xN != 0 DO P END` is bounded if P decrements xN
+// exactly once per iteration and does not use xN otherwise. It then runs as
+// many times as the value of xN before the loop, just like
+// `LOOP xN DO P END`. Programs with only bounded loops always halt.
+func ClassifyLoops(prog *Expr) []LoopInfo {
+	var infos []LoopInfo
+	Walk(prog, func(e *Expr) bool {
+		if e.Type == WHILE_EXPR {
+			info := LoopInfo{Loop: e, Kind: LOOP_BOUNDED}
+			if info.Reason = unboundedReason(e.WhileExpr); info.Reason != "" {
+				info.Kind = LOOP_GENERAL
+			}
+			infos = append(infos, info)
+		}
+		return true
+	})
+	return infos
+}
+
+// unboundedReason returns why the loop is general or "" if it is bounded.
+func unboundedReason(w *WhileExpr) string {
+	v := w.Variable
+	decrements := 0
+	reason := ""
+	var check func(e *Expr, nested bool)
+	check = func(e *Expr, nested bool) {
+		if reason != "" {
+			return
+		}
+		switch e.Type {
+		case INCR_EXPR:
+			src, c := e.IncrExpr.operands()
+			switch {
+			case e.IncrExpr.Variable != v, src == v && c == 0:
+			case src != v:
+				reason = fmt.Sprintf("x%d is assigned in the body", v)
+			case !e.IncrExpr.Decrement:
+				reason = fmt.Sprintf("x%d is incremented in the body", v)
+			case c != 1:
+				reason = fmt.Sprintf("x%d is decremented by %d in the body", v, c)
+			case nested:
+				reason = fmt.Sprintf("x%d is decremented in a nested loop", v)
+			default:
+				decrements++
+			}
+		case SEQ_EXPR:
+			check(e.SeqExpr.P1, nested)
+			check(e.SeqExpr.P2, nested)
+		case WHILE_EXPR, LOOP_EXPR:
+			if e.Type == WHILE_EXPR && e.WhileExpr.Variable == v ||
+				e.Type == LOOP_EXPR && e.LoopExpr.Variable == v {
+				reason = fmt.Sprintf("x%d controls a nested loop", v)
+				return
+			}
+			check(loopBody(e), true)
+		default:
+			reason = fmt.Sprintf("the body contains %s", statementString(e))
+		}
+	}
+	check(w.P, false)
+
+	switch {
+	case reason != "":
+		return reason
+	case decrements == 0:
+		return fmt.Sprintf("x%d is not decremented in the body", v)
+	case decrements > 1:
+		return fmt.Sprintf("x%d is decremented %d times per iteration", v, decrements)
+	}
+	return ""
+}
+
+// ToLoop rewrites a program with only bounded while expressions into the
+// LOOP language by replacing every while expression by a LOOP expression
+// with the same body. The decrement in the body sets the variable to 0 at the
+// end, like the while expression does. It returns an error for the first
+// general loop.
+func ToLoop(prog *Expr) (*Expr, error) {
+	for _, info := range ClassifyLoops(prog) {
+		if info.Kind != LOOP_BOUNDED {
+			return nil, &Error{info.Loop.Pos, "loop is not bounded: " + info.Reason}
+		}
+	}
+	return toLoop(prog), nil
+}
+
+// toLoop returns a copy of e with while expressions replaced by LOOP
+// expressions.
+func toLoop(e *Expr) *Expr {
+	c := *e
+	switch e.Type {
+	case SEQ_EXPR:
+		c.SeqExpr = &SeqExpr{toLoop(e.SeqExpr.P1), toLoop(e.SeqExpr.P2)}
+	case WHILE_EXPR:
+		c.Type, c.WhileExpr = LOOP_EXPR, nil
+		c.LoopExpr = &LoopExpr{Variable: e.WhileExpr.Variable, P: toLoop(e.WhileExpr.P)}
+	case LOOP_EXPR:
+		c.LoopExpr = &LoopExpr{Variable: e.LoopExpr.Variable, P: toLoop(e.LoopExpr.P)}
+	}
+	return &c
+}
@@ -0,0 +1,145 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestClassifyLoops(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		kinds  []LoopKind
+		reason string
+	}{
+		"Add":             {addProg, []LoopKind{LOOP_BOUNDED, LOOP_BOUNDED}, ""},
+		"Mul":             {mulProg, []LoopKind{LOOP_BOUNDED, LOOP_BOUNDED, LOOP_BOUNDED}, ""},
+		"Decrement first": {"WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END", []LoopKind{LOOP_BOUNDED}, ""},
+		"Increment": {"WHILE x1 != 0 DO x1 := x1 + 1; x1 := x1 - 1; x1 := x1 - 1 END",
+			[]LoopKind{LOOP_GENERAL}, "x1 is incremented in the body"},
+		"No decrement": {"WHILE x1 != 0 DO x0 := x0 + 1 END",
+			[]LoopKind{LOOP_GENERAL}, "x1 is not decremented in the body"},
+		"Twice": {"WHILE x1 != 0 DO x1 := x1 - 1; x1 := x1 - 1 END",
+			[]LoopKind{LOOP_GENERAL}, "x1 is decremented 2 times per iteration"},
+		"Nested decrement": {"WHILE x1 != 0 DO WHILE x2 != 0 DO x2 := x2 - 1; x1 := x1 - 1 END END",
+			[]LoopKind{LOOP_GENERAL, LOOP_BOUNDED}, "x1 is decremented in a nested loop"},
+		"Nested loop on variable": {"WHILE x1 != 0 DO x1 := x1 - 1; WHILE x1 != 0 DO x1 := x1 - 1 END END",
+			[]LoopKind{LOOP_GENERAL, LOOP_BOUNDED}, "x1 controls a nested loop"},
+		"Loop": {loopProg, []LoopKind{LOOP_GENERAL}, "x1 is not decremented in the body"},
+	}
+
+	for caseName, testCase := range tests {
+		infos := ClassifyLoops(mustParse(t, testCase.input))
+		if len(infos) != len(testCase.kinds) {
+			t.Errorf("%s: expected %d loops, got %d", caseName, len(testCase.kinds), len(infos))
+			continue
+		}
+		for i, info := range infos {
+			if info.Kind != testCase.kinds[i] {
+				t.Errorf("%s: loop %d: expected %s, got %s", caseName, i, testCase.kinds[i], info)
+			}
+		}
+		if infos[0].Reason != testCase.reason {
+			t.Errorf("%s: expected reason %q, got %q", caseName, testCase.reason, infos[0].Reason)
+		}
+	}
+}
+
+func TestClassifyGeneralIncr(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		kind   LoopKind
+		reason string
+	}{
+		"Decrement by 1": {"WHILE x1 != 0 DO x1 := x1 - 1; x0 := x1 + 2 END", LOOP_BOUNDED, ""},
+		"Add 0":          {"WHILE x1 != 0 DO x1 := x1 + 0; x1 := x1 - 1 END", LOOP_BOUNDED, ""},
+		"Decrement by 2": {"WHILE x1 != 0 DO x1 := x1 - 2 END", LOOP_GENERAL, "x1 is decremented by 2 in the body"},
+		"Assigned":       {"WHILE x1 != 0 DO x1 := x2 - 1 END", LOOP_GENERAL, "x1 is assigned in the body"},
+		"Incremented":    {"WHILE x1 != 0 DO x1 := x1 + 3; x1 := x1 - 1 END", LOOP_GENERAL, "x1 is incremented in the body"},
+	}
+
+	for caseName, testCase := range tests {
+		prog, err := NewParser(strings.NewReader(testCase.input), SchoeningDialect).Parse()
+		if err != nil {
+			t.Fatalf("%s: %s", caseName, err)
+		}
+		info := ClassifyLoops(prog)[0]
+		if info.Kind != testCase.kind || info.Reason != testCase.reason {
+			t.Errorf("%s: expected %s, %q, got %s", caseName, testCase.kind, testCase.reason, info)
+		}
+	}
+}
+
+func TestLoopInfoString(t *testing.T) {
+	infos := ClassifyLoops(mustParse(t, "x1 := x1 + 1;\nWHILE x1 != 0 DO x0 := x0 + 1 END"))
+	expected := "2:1: WHILE x1 != 0 DO: general, x1 is not decremented in the body"
+	if len(infos) != 1 || infos[0].String() != expected {
+		t.Errorf("expected %q, got %v", expected, infos)
+	}
+}
+
+func TestToLoop(t *testing.T) {
+	prog := mustParse(t, mulProg)
+	loop, err := ToLoop(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rewritten program is a valid LOOP program.
+	reparsed := mustParseLoop(t, Format(loop))
+	for x1 := uint64(0); x1 < 5; x1++ {
+		for x2 := uint64(0); x2 < 5; x2++ {
+			expected, _ := Run(prog, 0, x1, x2)
+			if got, _ := Run(reparsed, 0, x1, x2); got != expected {
+				t.Errorf("%d, %d: expected %d, got %d", x1, x2, expected, got)
+			}
+		}
+	}
+
+	_, err = ToLoop(mustParse(t, "x1 := x1 + 1;\nWHILE x1 != 0 DO x0 := x0 + 1 END"))
+	if err == nil || !strings.HasPrefix(err.Error(), "2:1: loop is not bounded") {
+		t.Errorf("expected error for general loop, got %v", err)
+	}
+}
+
+func TestToLoopRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	bounded := 0
+	for i := 0; i < 500; i++ {
+		prog := randomProg(rng, 2, 3)
+		loop, err := ToLoop(prog)
+		if err != nil {
+			continue
+		}
+		bounded++
+		for x1 := uint64(0); x1 < 3; x1++ {
+			// Bounded programs always halt.
+			expected, err := Run(prog, 0, x1, 2)
+			if got, _ := Run(loop, 0, x1, 2); err != nil || got != expected {
+				t.Fatalf("%s\nexpected %d, got %d, %v", Format(prog), expected, got, err)
+			}
+		}
+	}
+	if bounded < 50 {
+		t.Errorf("only %d random programs are bounded", bounded)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Coverage records which statements of a program were executed, aggregated
+// over many runs. It implements Tracer.
+//
+// Every while expression is treated as a branch with two outcomes: it is
+// entered if the body is executed at least once and skipped if the
+// condition is false when the loop is reached.
+type Coverage struct {
+	// Runs is the number of runs recorded.
+	Runs int
+
+	stmts []*Expr
+	// counts contains the executions of increment expressions and how
+	// often while expressions were reached.
+	counts map[*Expr]uint64
+	// skipped contains how often while expressions were skipped.
+	skipped map[*Expr]uint64
+	// active contains the loops currently iterating in this run.
+	active map[*Expr]bool
+}
+
+// NewCoverage creates an empty coverage for prog.
+func NewCoverage(prog *Expr) *Coverage {
+	c := &Coverage{
+		counts:  make(map[*Expr]uint64),
+		skipped: make(map[*Expr]uint64),
+		active:  make(map[*Expr]bool),
+	}
+	Walk(prog, func(e *Expr) bool {
+		if e.Type != SEQ_EXPR {
+			c.stmts = append(c.stmts, e)
+		}
+		return true
+	})
+	return c
+}
+
+// Attach starts recording a new run executed by in.
+func (c *Coverage) Attach(in *Interpreter) {
+	c.Runs++
+	c.active = make(map[*Expr]bool)
+	in.SetTracer(c)
+}
+
+// Step records the execution of e.
+func (c *Coverage) Step(e *Expr, cond bool) {
+	if e.Type == INCR_EXPR {
+		c.counts[e]++
+		return
+	}
+
+	// Only the first check of the condition decides whether the loop
+	// is entered or skipped.
+	if !c.active[e] {
+		c.counts[e]++
+		if !cond {
+			c.skipped[e]++
+		}
+	}
+	c.active[e] = cond
+}
+
+// Count returns how often an increment expression was executed or a while
+// expression was reached.
+func (c *Coverage) Count(e *Expr) uint64 { return c.counts[e] }
+
+// Entered returns how often the body of a while expression was entered.
+func (c *Coverage) Entered(e *Expr) uint64 { return c.counts[e] - c.skipped[e] }
+
+// Skipped returns how often a while expression was skipped.
+func (c *Coverage) Skipped(e *Expr) uint64 { return c.skipped[e] }
+
+// CoverSummary contains the number of covered statements and branches.
+type CoverSummary struct {
+	Statements, CoveredStatements int
+	Branches, CoveredBranches     int
+}
+
+// String returns the summary in the form used by go test -cover.
+func (s CoverSummary) String() string {
+	return fmt.Sprintf("coverage: %.1f%% of statements, %.1f%% of branches",
+		percent(s.CoveredStatements, s.Statements), percent(s.CoveredBranches, s.Branches))
+}
+
+// percent returns n/total in percent or 100 if total is 0.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// Summary counts the covered statements and branches.
+func (c *Coverage) Summary() CoverSummary {
+	var s CoverSummary
+	for _, e := range c.stmts {
+		s.Statements++
+		if c.counts[e] > 0 {
+			s.CoveredStatements++
+		}
+		if !isLoop(e) {
+			continue
+		}
+		s.Branches += 2
+		if c.Entered(e) > 0 {
+			s.CoveredBranches++
+		}
+		if c.Skipped(e) > 0 {
+			s.CoveredBranches++
+		}
+	}
+	return s
+}
+
+// coverBlock is a range of source code with a count, as it is written to
+// coverage profiles.
+type coverBlock struct {
+	start, end Pos
+	numStmt    int
+	// counts is the map containing the count of expr.
+	counts map[*Expr]uint64
+	expr   *Expr
+}
+
+// blocks returns the blocks of the coverage profile in source order.
+//
+// Increment expressions are a block of their own. While expressions consist
+// of two blocks: the head up to the body, counting how often the loop was
+// reached, and the END keyword without statements, counting how often the
+// loop was skipped. Whether the loop was entered can be seen from the first
+// statement of the body.
+func (c *Coverage) blocks() []coverBlock {
+	var blocks []coverBlock
+	for _, e := range c.stmts {
+		switch e.Type {
+		case INCR_EXPR:
+			blocks = append(blocks, coverBlock{e.Pos, e.End, 1, c.counts, e})
+		case WHILE_EXPR, LOOP_EXPR:
+			end := Pos{e.End.Line, e.End.Column - len("END")}
+			blocks = append(blocks,
+				coverBlock{e.Pos, loopBody(e).Pos, 1, c.counts, e},
+				coverBlock{end, e.End, 0, c.skipped, e})
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		a, b := blocks[i].start, blocks[j].start
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return blocks
+}
+
+// WriteProfile writes the coverage of the program in the file filename to w.
+// The format is the same as the one of go test -coverprofile.
+func (c *Coverage) WriteProfile(w io.Writer, filename string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "mode: count")
+	for _, b := range c.blocks() {
+		fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", filename,
+			b.start.Line, b.start.Column, b.end.Line, b.end.Column,
+			b.numStmt, b.counts[b.expr])
+	}
+	return bw.Flush()
+}
+
+// ReadProfile adds the counts of a profile written by WriteProfile to the
+// coverage. Only blocks of the file filename are read and they have to match
+// the blocks of the program.
+func (c *Coverage) ReadProfile(r io.Reader, filename string) error {
+	blocks := make(map[[2]Pos]coverBlock)
+	for _, b := range c.blocks() {
+		blocks[[2]Pos{b.start, b.end}] = b
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 && strings.HasPrefix(line, "mode: ") {
+			continue
+		}
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			return fmt.Errorf("line %d: invalid block %q", lineNum, line)
+		}
+		if line[:i] != filename {
+			continue
+		}
+
+		var start, end Pos
+		var numStmt int
+		var count uint64
+		_, err := fmt.Sscanf(line[i+1:], "%d.%d,%d.%d %d %d",
+			&start.Line, &start.Column, &end.Line, &end.Column, &numStmt, &count)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid block %q: %s", lineNum, line, err)
+		}
+		b, ok := blocks[[2]Pos{start, end}]
+		if !ok {
+			return fmt.Errorf("line %d: block %s-%s does not match the program", lineNum, start, end)
+		}
+		b.counts[b.expr] += count
+	}
+	return scanner.Err()
+}
+
+// WriteHTML writes an HTML page to w showing the source code src with the
+// covered statements highlighted. Loops which were entered and skipped are
+// green, loops which were only entered or only skipped are yellow.
+func (c *Coverage) WriteHTML(w io.Writer, src []byte, filename string) error {
+	lines := strings.SplitAfter(string(src), "\n")
+
+	// offset converts a position to a byte offset in src.
+	offset := func(p Pos) int {
+		off := 0
+		for i := 0; i < p.Line-1 && i < len(lines); i++ {
+			off += len(lines[i])
+		}
+		if p.Line-1 < len(lines) {
+			line := []rune(lines[p.Line-1])
+			if p.Column-1 <= len(line) {
+				off += len(string(line[:p.Column-1]))
+			}
+		}
+		return off
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, htmlHeader, html.EscapeString(filename), html.EscapeString(filename),
+		html.EscapeString(c.Summary().String()))
+
+	pos := 0
+	for _, b := range c.blocks() {
+		if b.numStmt == 0 {
+			continue
+		}
+		start, end := offset(b.start), offset(b.end)
+		class, title := c.blockClass(b.expr)
+		fmt.Fprintf(bw, "%s<span class=\"%s\" title=\"%s\">%s</span>",
+			html.EscapeString(string(src[pos:start])), class, title,
+			html.EscapeString(string(src[start:end])))
+		pos = end
+	}
+	fmt.Fprintf(bw, "%s</pre>\n</body>\n</html>\n", html.EscapeString(string(src[pos:])))
+	return bw.Flush()
+}
+
+// blockClass returns the CSS class and the title of the block of e.
+func (c *Coverage) blockClass(e *Expr) (class, title string) {
+	if e.Type == INCR_EXPR {
+		title = fmt.Sprintf("executed %d times", c.counts[e])
+		if c.counts[e] == 0 {
+			return "nocov", title
+		}
+		return "cov", title
+	}
+
+	title = fmt.Sprintf("reached %d times, entered %d times, skipped %d times",
+		c.counts[e], c.Entered(e), c.Skipped(e))
+	switch {
+	case c.counts[e] == 0:
+		return "nocov", title
+	case c.Entered(e) == 0 || c.Skipped(e) == 0:
+		return "partial", title
+	}
+	return "cov", title
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: monospace; }
+.cov { background: #c0f0c0; }
+.partial { background: #f0f0a0; }
+.nocov { background: #f0c0c0; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+<p>%s</p>
+<pre>
+`
@@ -0,0 +1,133 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// coverageOf runs the program once for every input and returns the
+// aggregated coverage.
+func coverageOf(t *testing.T, prog *Expr, inputs ...[]uint64) *Coverage {
+	cover := NewCoverage(prog)
+	for _, input := range inputs {
+		in := NewInterpreter(prog, input...)
+		cover.Attach(in)
+		if err := in.Run(1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cover
+}
+
+func TestCoverageSummary(t *testing.T) {
+	type TestCase struct {
+		inputs   [][]uint64
+		expected CoverSummary
+	}
+
+	tests := map[string]TestCase{
+		"No runs":        {nil, CoverSummary{9, 0, 6, 0}},
+		"Outer skipped":  {[][]uint64{{0, 3}}, CoverSummary{9, 1, 6, 1}},
+		"Inner skipped":  {[][]uint64{{2, 0}}, CoverSummary{9, 4, 6, 3}},
+		"All entered":    {[][]uint64{{2, 3}}, CoverSummary{9, 9, 6, 3}},
+		"All aggregated": {[][]uint64{{0, 3}, {2, 0}, {2, 3}}, CoverSummary{9, 9, 6, 6}},
+	}
+
+	for caseName, testCase := range tests {
+		cover := coverageOf(t, mustParse(t, mulProg), testCase.inputs...)
+		if got := cover.Summary(); got != testCase.expected {
+			t.Errorf("%s: expected %+v, got %+v", caseName, testCase.expected, got)
+		}
+		if cover.Runs != len(testCase.inputs) {
+			t.Errorf("%s: expected %d runs, got %d", caseName, len(testCase.inputs), cover.Runs)
+		}
+	}
+}
+
+func TestCoverageLoopCounts(t *testing.T) {
+	prog := mustParse(t, mulProg)
+	cover := coverageOf(t, prog, []uint64{3, 0}, []uint64{0, 0}, []uint64{1, 1})
+	inner := prog.WhileExpr.P.SeqExpr.P2.SeqExpr.P1
+
+	if c, e, s := cover.Count(prog), cover.Entered(prog), cover.Skipped(prog); c != 3 || e != 2 || s != 1 {
+		t.Errorf("outer loop: expected 3 reached, 2 entered, 1 skipped, got %d, %d, %d", c, e, s)
+	}
+	if c, e, s := cover.Count(inner), cover.Entered(inner), cover.Skipped(inner); c != 4 || e != 1 || s != 3 {
+		t.Errorf("inner loop: expected 4 reached, 1 entered, 3 skipped, got %d, %d, %d", c, e, s)
+	}
+}
+
+func TestCoverageProfile(t *testing.T) {
+	prog := mustParse(t, addProg)
+	cover := coverageOf(t, prog, []uint64{1, 0})
+
+	var buf bytes.Buffer
+	if err := cover.WriteProfile(&buf, "add.while"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `mode: count
+add.while:1.1,1.18 1 1
+add.while:1.18,1.30 1 1
+add.while:1.32,1.44 1 1
+add.while:1.45,1.48 0 0
+add.while:2.1,2.18 1 1
+add.while:2.18,2.30 1 0
+add.while:2.32,2.44 1 0
+add.while:2.45,2.48 0 1
+`
+	if buf.String() != expected {
+		t.Fatalf("expected profile\n%s\ngot\n%s", expected, buf.String())
+	}
+
+	// Reading the profile into another coverage aggregates the counts.
+	other := coverageOf(t, prog, []uint64{0, 1})
+	if err := other.ReadProfile(strings.NewReader(expected), "add.while"); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.Summary(); got.CoveredStatements != 6 || got.CoveredBranches != 4 {
+		t.Fatalf("expected everything to be covered, got %+v", got)
+	}
+
+	if err := other.ReadProfile(strings.NewReader("add.while:1.1,1.2 1 1"), "add.while"); err == nil {
+		t.Fatal("expected error for block not matching the program")
+	}
+}
+
+func TestCoverageHTML(t *testing.T) {
+	cover := coverageOf(t, mustParse(t, addProg), []uint64{0, 1})
+
+	var buf bytes.Buffer
+	if err := cover.WriteHTML(&buf, []byte(addProg), "add.while"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<span class="partial" title="reached 1 times, entered 0 times, skipped 1 times">WHILE x1 != 0 DO </span>`,
+		`<span class="nocov" title="executed 0 times">x1 := x1 - 1</span>`,
+		`<span class="cov" title="executed 1 times">x0 := x0 + 1</span> END</pre>`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in HTML report", expected)
+		}
+	}
+}
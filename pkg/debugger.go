@@ -0,0 +1,154 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "sort"
+
+// snapshotEvery is the number of steps between two snapshots of a debugged
+// program. It bounds the number of steps replayed when travelling back.
+const snapshotEvery = 1024
+
+// Stop is the reason why the debugger stopped executing.
+type Stop int
+
+const (
+	// STOP_END indicates that the end (or the start when going backwards)
+	// of the program was reached.
+	STOP_END Stop = iota
+	// STOP_STEP indicates that a single step was executed.
+	STOP_STEP
+	// STOP_BREAKPOINT indicates that the next expression is on a line with
+	// a breakpoint.
+	STOP_BREAKPOINT
+	// STOP_WATCHPOINT indicates that a watched variable changed.
+	STOP_WATCHPOINT
+	// STOP_LIMIT indicates that the step limit of the debugger was reached.
+	STOP_LIMIT
+)
+
+// Debugger runs a WHILE program under control of the user.
+// The whole execution is recorded, so it can also run backwards to find the
+// step where a variable first got a wrong value.
+type Debugger struct {
+	// Limit is the maximum number of steps a single Continue or
+	// ReverseContinue executes. 0 means no limit.
+	Limit int
+
+	in          *Interpreter
+	breakpoints map[int]bool // set of line numbers
+	watches     map[int]bool // set of variable numbers
+}
+
+// NewDebugger creates a debugger for prog with the given input.
+func NewDebugger(prog *Expr, input ...uint64) *Debugger {
+	in := NewInterpreter(prog, input...)
+	in.Record(snapshotEvery)
+	return &Debugger{
+		in:          in,
+		breakpoints: make(map[int]bool),
+		watches:     make(map[int]bool),
+	}
+}
+
+// Interpreter returns the interpreter running the program, e.g. to inspect
+// variables.
+func (d *Debugger) Interpreter() *Interpreter { return d.in }
+
+// SetBreakpoint sets a breakpoint on the given line.
+func (d *Debugger) SetBreakpoint(line int) { d.breakpoints[line] = true }
+
+// ClearBreakpoint removes the breakpoint on the given line.
+func (d *Debugger) ClearBreakpoint(line int) { delete(d.breakpoints, line) }
+
+// Breakpoints returns the lines with breakpoints in ascending order.
+func (d *Debugger) Breakpoints() []int { return sortedKeys(d.breakpoints) }
+
+// Watch stops Continue and ReverseContinue when variable xN changes.
+func (d *Debugger) Watch(variable int) { d.watches[variable] = true }
+
+// Unwatch removes the watchpoint on variable xN.
+func (d *Debugger) Unwatch(variable int) { delete(d.watches, variable) }
+
+// Watches returns the watched variables in ascending order.
+func (d *Debugger) Watches() []int { return sortedKeys(d.watches) }
+
+// Step executes a single step.
+func (d *Debugger) Step() Stop {
+	return d.run(1, d.in.Step)
+}
+
+// ReverseStep reverts the last step.
+func (d *Debugger) ReverseStep() Stop {
+	return d.run(1, d.in.StepBack)
+}
+
+// Continue executes the program until a breakpoint or watchpoint is hit or
+// the program halts.
+func (d *Debugger) Continue() Stop {
+	return d.run(d.Limit, d.in.Step)
+}
+
+// ReverseContinue executes the program backwards until a breakpoint or
+// watchpoint is hit or the start is reached.
+func (d *Debugger) ReverseContinue() Stop {
+	return d.run(d.Limit, d.in.StepBack)
+}
+
+// Goto jumps to the given step.
+func (d *Debugger) Goto(step int) error { return d.in.Goto(step) }
+
+// run calls step until a breakpoint or watchpoint is hit, step returns false
+// or limit steps have been taken. A limit of 0 means no limit.
+func (d *Debugger) run(limit int, step func() bool) Stop {
+	for n := 0; limit == 0 || n < limit; n++ {
+		old := make(map[int]uint64, len(d.watches))
+		for v := range d.watches {
+			old[v] = d.in.Var(v)
+		}
+		if !step() {
+			return STOP_END
+		}
+
+		for v, val := range old {
+			if d.in.Var(v) != val {
+				return STOP_WATCHPOINT
+			}
+		}
+		if next := d.in.Next(); next != nil && d.breakpoints[next.Pos.Line] {
+			return STOP_BREAKPOINT
+		}
+	}
+
+	if limit == 1 {
+		return STOP_STEP
+	}
+	return STOP_LIMIT
+}
+
+// sortedKeys returns the keys of the set in ascending order.
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "testing"
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	// Line 3 is the increment of x0 in the first loop.
+	d := NewDebugger(mustParse(t, "WHILE x1 != 0 DO\n  x1 := x1 - 1;\n  x0 := x0 + 1\nEND"), 3)
+	d.SetBreakpoint(3)
+	in := d.Interpreter()
+
+	for i := uint64(0); i < 3; i++ {
+		if stop := d.Continue(); stop != STOP_BREAKPOINT {
+			t.Fatalf("iteration %d: expected breakpoint, got %d", i, stop)
+		}
+		if in.Var(0) != i || in.Next().Pos.Line != 3 {
+			t.Fatalf("iteration %d: stopped with x0 = %d at %s", i, in.Var(0), in.Next().Pos)
+		}
+	}
+	if stop := d.Continue(); stop != STOP_END || in.Var(0) != 3 {
+		t.Fatalf("expected end with x0 = 3, got %d with x0 = %d", stop, in.Var(0))
+	}
+
+	// Going backwards stops at the last breakpoint again.
+	if stop := d.ReverseContinue(); stop != STOP_BREAKPOINT || in.Var(0) != 2 {
+		t.Fatalf("expected breakpoint with x0 = 2, got %d with x0 = %d", stop, in.Var(0))
+	}
+	d.ClearBreakpoint(3)
+	if stop := d.ReverseContinue(); stop != STOP_END || in.Steps() != 0 {
+		t.Fatalf("expected start, got %d at step %d", stop, in.Steps())
+	}
+}
+
+func TestDebuggerWatchpoints(t *testing.T) {
+	d := NewDebugger(mustParse(t, mulProg), 2, 2)
+	d.Watch(0)
+	in := d.Interpreter()
+
+	// Go back to the step which changed x0 from 3 to 4.
+	if err := d.Goto(100); err == nil {
+		t.Fatal("expected program to halt before step 100")
+	}
+	for in.Var(0) > 3 {
+		if stop := d.ReverseContinue(); stop != STOP_WATCHPOINT {
+			t.Fatalf("expected watchpoint, got %d", stop)
+		}
+	}
+	if next := in.Next(); next.Type != INCR_EXPR || next.IncrExpr.Variable != 0 {
+		t.Fatalf("expected increment of x0 as next expression, got %s", next)
+	}
+	if d.Step() != STOP_WATCHPOINT || in.Var(0) != 4 {
+		t.Fatalf("expected x0 = 4 after one step, got %d", in.Var(0))
+	}
+}
+
+func TestDebuggerLimit(t *testing.T) {
+	d := NewDebugger(mustParse(t, loopProg))
+	d.Limit = 100
+	if stop := d.Continue(); stop != STOP_LIMIT || d.Interpreter().Steps() != 100 {
+		t.Fatalf("expected limit after 100 steps, got %d after %d steps",
+			stop, d.Interpreter().Steps())
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+// Dialect selects the notation accepted by a scanner and parser. Textbooks
+// and course notes write WHILE programs in slightly different ways, so every
+// option enables one of the variants. Except for Loop, the options only add
+// notations: the notation of the core language is still accepted, so the
+// macros of the standard library can be used. The LOOP language has no while
+// expressions, so only macros without them can be used in the loop dialect.
+//
+// The zero value is the strict core language.
+type Dialect struct {
+	// Name identifies the dialect, e.g. on the command line.
+	Name string
+
+	// Unicode accepts `≠` as an alternative to `!=`.
+	Unicode bool
+	// OD accepts OD as an alternative to END at the end of loops, as in
+	// `WHILE x1 != 0 DO P OD`.
+	OD bool
+	// Lowercase accepts keywords in lower case, e.g. `while` and `do`.
+	Lowercase bool
+	// Subscripts accepts variables with an underscore like `x_1`.
+	Subscripts bool
+	// Names accepts named variables like `sum` and the header
+	// `INPUT a, b; OUTPUT r;`, see Names.
+	Names bool
+	// Assign accepts the assignments `xN := xM + c` and `xN := xM - c` for
+	// arbitrary variables and natural constants c as generalised increment
+	// expressions, see IncrExpr. Desugar lowers them to the minimal form.
+	Assign bool
+
+	// Sugar enables all statements of the sugar dialect.
+	Sugar bool
+	// Loop selects the LOOP language, which has LOOP instead of WHILE.
+	// WHILE is rejected, also in the expansion of macros.
+	Loop bool
+}
+
+// The built-in dialects.
+var (
+	// StrictDialect is the core language.
+	StrictDialect = Dialect{Name: "strict"}
+	// SugarDialect is the sugar dialect, see Desugar.
+	SugarDialect = Dialect{Name: "sugar", Sugar: true}
+	// LoopDialect is the LOOP language.
+	LoopDialect = Dialect{Name: "loop", Loop: true}
+	// SchoeningDialect is the notation of Schöning, Theoretische Informatik
+	// – kurz gefasst: `WHILE xi ≠ 0 DO P END` and `xi := xj + c`.
+	SchoeningDialect = Dialect{Name: "schoening", Unicode: true, Assign: true}
+	// AlgolDialect is the Algol-like notation of many lecture notes:
+	// `while x_i != 0 do P od` with lower case keywords.
+	AlgolDialect = Dialect{Name: "algol", Lowercase: true, OD: true, Subscripts: true}
+	// NamedDialect has named variables and assignments like `r := a + 0`.
+	NamedDialect = Dialect{Name: "named", Names: true, Assign: true}
+)
+
+// Dialects lists the built-in dialects.
+var Dialects = []Dialect{StrictDialect, SugarDialect, LoopDialect, SchoeningDialect, AlgolDialect, NamedDialect}
+
+// LookupDialect returns the built-in dialect with the given name.
+func LookupDialect(name string) (Dialect, bool) {
+	for _, d := range Dialects {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Dialect{}, false
+}
+
+// firstDialect returns the optional dialect passed to a constructor or the
+// strict core language if there is none.
+func firstDialect(dialect []Dialect) Dialect {
+	if len(dialect) == 0 {
+		return StrictDialect
+	}
+	return dialect[0]
+}
@@ -0,0 +1,161 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDialectTokens(t *testing.T) {
+	tests := map[string]struct {
+		dialect Dialect
+		input   string
+		tok     Token
+		lit     string
+	}{
+		"Unicode not equal":      {Dialect{Unicode: true}, "≠", NOTEQUAL, "≠"},
+		"Strict not equal":       {StrictDialect, "≠", ILLEGAL, "≠"},
+		"Lowercase keyword":      {Dialect{Lowercase: true}, "while", WHILE, "while"},
+		"Lowercase OD":           {Dialect{Lowercase: true}, "od", OD, "od"},
+		"Uppercase keyword":      {Dialect{Lowercase: true}, "WHILE", WHILE, "WHILE"},
+		"Unknown lowercase":      {Dialect{Lowercase: true}, "whil", ILLEGAL, "whil"},
+		"Strict lowercase":       {StrictDialect, "while", ILLEGAL, "w"},
+		"Subscript":              {Dialect{Subscripts: true}, "x_12", VARIABLE, "x_12"},
+		"Subscript optional":     {Dialect{Subscripts: true}, "x12", VARIABLE, "x12"},
+		"Subscript only x":       {Dialect{Subscripts: true}, "x", VARIABLE, "x"},
+		"Strict subscript":       {StrictDialect, "x_12", VARIABLE, "x"},
+		"Mixed case keywords":    {Dialect{Lowercase: true}, "While", ILLEGAL, "W"},
+		"Name":                   {Dialect{Names: true}, "sum_2b", NAME, "sum_2b"},
+		"Name x":                 {Dialect{Names: true}, "x", NAME, "x"},
+		"Name variable":          {Dialect{Names: true}, "x12", VARIABLE, "x12"},
+		"Name subscript":         {Dialect{Names: true}, "x_1", NAME, "x_1"},
+		"Variable subscript":     {Dialect{Names: true, Subscripts: true}, "x_1", VARIABLE, "x_1"},
+		"Name keyword":           {Dialect{Names: true}, "while", NAME, "while"},
+		"Lowercase keyword name": {Dialect{Names: true, Lowercase: true}, "while", WHILE, "while"},
+	}
+
+	for caseName, testCase := range tests {
+		tok, lit, err := NewScanner(strings.NewReader(testCase.input), testCase.dialect).Scan()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		if tok != testCase.tok || lit != testCase.lit {
+			t.Errorf("%s: expected %s \"%s\", got %s \"%s\"", caseName, testCase.tok, testCase.lit, tok, lit)
+		}
+	}
+}
+
+func TestDialects(t *testing.T) {
+	core := "x2 := x2 + 1; WHILE x1 != 0 DO x1 := x1 - 1; x2 := x2 + 1 END"
+	tests := map[string]struct {
+		dialect Dialect
+		input   string
+	}{
+		"Strict":    {StrictDialect, core},
+		"Schoening": {SchoeningDialect, "x2 := x2 + 1; WHILE x1 ≠ 0 DO x1 := x1 - 1; x2 := x2 + 1 END"},
+		"Algol":     {AlgolDialect, "x_2 := x_2 + 1; while x_1 != 0 do x_1 := x_1 - 1; x_2 := x_2 + 1 od"},
+		"Algol END": {AlgolDialect, "x_2 := x_2 + 1; while x1 != 0 do x1 := x1 - 1; x_2 := x_2 + 1 END"},
+		"Core in every dialect": {Dialect{Unicode: true, OD: true, Lowercase: true, Subscripts: true, Assign: true},
+			core},
+	}
+
+	expected, err := NewParser(strings.NewReader(core)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearPos(expected)
+	for caseName, testCase := range tests {
+		expr, err := NewParser(strings.NewReader(testCase.input), testCase.dialect).Parse()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		clearPos(expr)
+		if !reflect.DeepEqual(expr, expected) {
+			t.Errorf("%s: expected %s, got %s", caseName, expected, expr)
+		}
+	}
+}
+
+func TestDialectAssign(t *testing.T) {
+	prog, err := NewParser(strings.NewReader("x0 := x1 + 3; x0 := x0 - 1; x2 := x0 - 10"), SchoeningDialect).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assign := prog.SeqExpr.P1
+	if assign.Type != INCR_EXPR || *assign.IncrExpr != (IncrExpr{Variable: 0, General: true, Source: 1, Constant: 3}) {
+		t.Errorf("expected assignment x0 := x1 + 3, got %s", assign)
+	}
+	if incr := prog.SeqExpr.P2.SeqExpr.P1; incr.Type != INCR_EXPR || incr.IncrExpr.General {
+		t.Errorf("expected decrement, got %s", incr)
+	}
+
+	for _, input := range [][]uint64{{0}, {5}, {12}} {
+		for name, p := range map[string]*Expr{"Direct": prog, "Desugared": mustDesugar(t, prog)} {
+			got, err := Run(p, 0, input...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := input[0] + 2; got != expected {
+				t.Errorf("%s: input %d: expected %d, got %d", name, input[0], expected, got)
+			}
+		}
+	}
+}
+
+func TestDialectErrors(t *testing.T) {
+	tests := map[string]struct {
+		dialect Dialect
+		input   string
+	}{
+		"Strict unicode":     {StrictDialect, "WHILE x1 ≠ 0 DO x1 := x1 - 1 END"},
+		"Strict OD":          {StrictDialect, "WHILE x1 != 0 DO x1 := x1 - 1 OD"},
+		"Strict lowercase":   {StrictDialect, "while x1 != 0 do x1 := x1 - 1 end"},
+		"Strict subscript":   {StrictDialect, "x_1 := x_1 + 1"},
+		"Strict assign":      {StrictDialect, "x1 := x2 + 3"},
+		"OD after IF":        {Dialect{OD: true, Sugar: true}, "IF x1 = 0 THEN x1 := x1 + 1 OD"},
+		"Assign constant":    {SchoeningDialect, "x1 := 5"},
+		"Assign variable":    {SchoeningDialect, "x1 := x2"},
+		"Assign product":     {SchoeningDialect, "x1 := x2 * x3"},
+		"Assign without IF":  {SchoeningDialect, "IF x1 = 0 THEN x1 := x1 + 1 END"},
+		"Subscript no digit": {AlgolDialect, "x_ := x_ + 1"},
+	}
+
+	for caseName, testCase := range tests {
+		if expr, err := NewParser(strings.NewReader(testCase.input), testCase.dialect).Parse(); err == nil {
+			t.Errorf("%s: expected error, got %s", caseName, expr)
+		}
+	}
+}
+
+func TestLookupDialect(t *testing.T) {
+	for _, d := range Dialects {
+		if got, ok := LookupDialect(d.Name); !ok || got != d {
+			t.Errorf("%s: expected %v, got %v", d.Name, d, got)
+		}
+	}
+	if d, ok := LookupDialect("unknown"); ok {
+		t.Errorf("expected unknown dialect, got %v", d)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported is returned by engines which can not run a program.
+var ErrUnsupported = errors.New("program not supported by the engine")
+
+// Engine is a way to execute core programs, which Diff compares to the
+// interpreter.
+type Engine struct {
+	Name string
+	// Run executes prog with the given input and returns the value of x0
+	// and the number of steps. The limit is given in steps of the
+	// interpreter, engines counting steps differently scale it.
+	Run func(prog *Expr, limit int, input ...uint64) (uint64, int, error)
+	// SameSteps reports whether the engine counts steps like the
+	// interpreter, so the number of steps is compared, too.
+	SameSteps bool
+}
+
+// Engines are the available engines. The first one is the interpreter,
+// which is the reference for the others.
+var Engines = []Engine{
+	{"interpreter", runInterpreter, true},
+	{"reparse", runReparsed, true},
+	{"goto", runGotoEngine, true},
+	{"kleene", runKleene, false},
+	{"loop", runLoopEngine, true},
+}
+
+// LookupEngine returns the engine with the given name.
+func LookupEngine(name string) (Engine, bool) {
+	for _, e := range Engines {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Engine{}, false
+}
+
+// runInterpreter runs prog on the interpreter.
+func runInterpreter(prog *Expr, limit int, input ...uint64) (uint64, int, error) {
+	in := NewInterpreter(prog, input...)
+	err := in.Run(limit)
+	return in.Var(0), in.Steps(), err
+}
+
+// runReparsed formats and parses prog again before running it, which
+// checks the parser and Format.
+func runReparsed(prog *Expr, limit int, input ...uint64) (uint64, int, error) {
+	reparsed, err := NewParser(bytes.NewBufferString(Format(prog))).Parse()
+	if err != nil {
+		return 0, 0, err
+	}
+	return runInterpreter(reparsed, limit, input...)
+}
+
+// runGotoEngine runs the GOTO program of prog. A while expression takes at
+// most two instructions per step. The jumps closing the loops and the final
+// HALT are not counted, so the steps are those of the interpreter.
+func runGotoEngine(prog *Expr, limit int, input ...uint64) (uint64, int, error) {
+	g, err := CompileGoto(prog)
+	if err != nil {
+		return 0, 0, err
+	}
+	return runGoto(g, 2*limit+1, input)
+}
+
+// runKleene runs the program with a single loop computed from the GOTO
+// program of prog. Every iteration of the loop checks all instructions.
+// The steps are not compared, since the desugared conditionals copy the
+// variables they test, so an iteration takes a number of steps depending
+// on the values of the variables.
+func runKleene(prog *Expr, limit int, input ...uint64) (uint64, int, error) {
+	g, err := CompileGoto(prog)
+	if err != nil {
+		return 0, 0, err
+	}
+	while, err := GotoToWhile(g)
+	if err != nil {
+		return 0, 0, err
+	}
+	core, err := Desugar(while)
+	if err != nil {
+		return 0, 0, err
+	}
+	in := NewInterpreter(core, input...)
+	err = in.Run((2*limit + 1) * 50 * (len(g.Instrs) + 1))
+	return in.Var(0), in.Steps(), err
+}
+
+// runLoopEngine runs the LOOP program of prog if all loops are bounded. A
+// LOOP expression takes as many steps as the bounded while expression it
+// replaces, which checks its condition once more than it iterates.
+func runLoopEngine(prog *Expr, limit int, input ...uint64) (uint64, int, error) {
+	loop, err := ToLoop(prog)
+	if err != nil {
+		return 0, 0, ErrUnsupported
+	}
+	return runInterpreter(loop, limit, input...)
+}
+
+// Mismatch is a difference between an engine and the interpreter.
+type Mismatch struct {
+	Prog   *Expr
+	Input  []uint64
+	Engine string
+	// Expected and ExpectedSteps are the results of the interpreter.
+	Expected, Got           uint64
+	ExpectedSteps, GotSteps int
+	// Err is the error of the engine.
+	Err error
+
+	engine Engine
+}
+
+// String describes the mismatch and the program.
+func (m *Mismatch) String() string {
+	var what string
+	switch {
+	case m.Err != nil:
+		what = fmt.Sprintf("expected x0 = %d, got error: %s", m.Expected, m.Err)
+	case m.Got != m.Expected:
+		what = fmt.Sprintf("expected x0 = %d, got %d", m.Expected, m.Got)
+	default:
+		what = fmt.Sprintf("expected %d steps, got %d", m.ExpectedSteps, m.GotSteps)
+	}
+	return fmt.Sprintf("%s with input %v: %s\n%s", m.Engine, m.Input, what, Format(m.Prog))
+}
+
+// Diff runs prog with the given input on the interpreter and the engines,
+// all Engines if nil, and returns the first mismatch or nil. Programs which
+// do not halt within limit steps on the interpreter are skipped, as are
+// engines not supporting the program.
+func Diff(prog *Expr, limit int, input []uint64, engines []Engine) *Mismatch {
+	if engines == nil {
+		engines = Engines
+	}
+	expected, steps, err := runInterpreter(prog, limit, input...)
+	if err != nil {
+		return nil
+	}
+	for _, e := range engines {
+		got, gotSteps, err := e.Run(prog, limit, input...)
+		if err == ErrUnsupported {
+			continue
+		}
+		if err != nil || got != expected || e.SameSteps && gotSteps != steps {
+			return &Mismatch{prog, input, e.Name, expected, got, steps, gotSteps, err, e}
+		}
+	}
+	return nil
+}
+
+// Shrink reduces the program of the mismatch, see Reduce, as long as the
+// engine of the mismatch still differs from the interpreter.
+func (m *Mismatch) Shrink(limit int) *Mismatch {
+	engines := []Engine{m.engine}
+	prog := Reduce(m.Prog, func(prog *Expr) bool {
+		return Diff(prog, limit, m.Input, engines) != nil
+	})
+	return Diff(prog, limit, m.Input, engines)
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// diffInputs are the inputs of the differential tests. The last one gives
+// input to variables not used by the programs.
+var diffInputs = [][]uint64{nil, {1}, {2, 1}, {0, 3, 1}, {2, 0, 1, 3, 5, 5, 5, 5, 5, 5, 5, 5}}
+
+func TestEnginesAgree(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	opts := GenerateOptions{Depth: 2, Vars: 4, Statements: 4, LoopProb: 0.3}
+	for i := 0; i < 200; i++ {
+		opts.Terminating = i%2 == 0
+		prog := Generate(rng, opts)
+		for _, input := range diffInputs {
+			if m := Diff(prog, 1000, input, nil); m != nil {
+				t.Fatalf("%s", m.Shrink(1000))
+			}
+		}
+	}
+	for _, input := range [][]uint64{{3, 4}, {0, 2}, {3, 4, 5, 6, 7, 8, 9}} {
+		if m := Diff(mustParse(t, mulProg), 1000, input, nil); m != nil {
+			t.Errorf("%s", m)
+		}
+	}
+}
+
+func TestDiffShrink(t *testing.T) {
+	// broken miscounts the steps of decrements of x2 in a loop.
+	broken := Engine{Name: "broken", SameSteps: true}
+	broken.Run = func(prog *Expr, limit int, input ...uint64) (uint64, int, error) {
+		x0, steps, err := runInterpreter(prog, limit, input...)
+		Walk(prog, func(e *Expr) bool {
+			if e.Type == WHILE_EXPR {
+				Walk(e.WhileExpr.P, func(e *Expr) bool {
+					if e.Type == INCR_EXPR && e.IncrExpr.Decrement && e.IncrExpr.Variable == 2 {
+						steps++
+					}
+					return true
+				})
+			}
+			return true
+		})
+		return x0, steps, err
+	}
+
+	prog := mustParse(t, `x1 := x1 + 1; x0 := x0 + 1;
+WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1; WHILE x3 != 0 DO x2 := x2 - 1; x3 := x3 - 1 END END;
+x0 := x0 - 1`)
+	m := Diff(prog, 1000, []uint64{1, 2, 3}, []Engine{Engines[0], broken})
+	if m == nil || m.Engine != "broken" || m.GotSteps <= m.ExpectedSteps {
+		t.Fatalf("expected a mismatch of broken, got %v", m)
+	}
+	shrunk := m.Shrink(1000)
+	if shrunk == nil || shrunk.Engine != "broken" {
+		t.Fatalf("expected the shrunk program to differ, got %v", shrunk)
+	}
+	if Size(shrunk.Prog) >= Size(prog) {
+		t.Errorf("expected a smaller program, got\n%s", shrunk)
+	}
+	// Every decrement of x2 in a loop is miscounted, so one is left.
+	if expected := "  x2 := x2 - 1"; !strings.Contains(Format(shrunk.Prog), expected) {
+		t.Errorf("expected %q in\n%s", expected, shrunk)
+	}
+}
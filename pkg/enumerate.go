@@ -0,0 +1,95 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+// Size returns the number of increment, decrement and while statements of
+// the core program e. Sequences do not count.
+func Size(e *Expr) int {
+	size := 0
+	Walk(e, func(e *Expr) bool {
+		if e.Type != SEQ_EXPR {
+			size++
+		}
+		return true
+	})
+	return size
+}
+
+// Enumerate calls visit for all core programs up to the given size using the
+// variables x0, ..., x(vars-1), until visit returns false. The programs are
+// enumerated in canonical order: by size, then by the size of their first
+// statement, where increments come before decrements and lower variables
+// first. Sequences are always nested to the right, so every program is
+// visited exactly once. The programs may share subexpressions.
+func Enumerate(maxSize, vars int, visit func(*Expr) bool) {
+	en := enumerator{vars}
+	for size := 1; size <= maxSize; size++ {
+		if !en.programs(size, visit) {
+			return
+		}
+	}
+}
+
+// enumerator generates programs of a given size.
+type enumerator struct {
+	vars int
+}
+
+// programs calls f for the programs of the given size until f returns false.
+// It reports whether all programs have been visited.
+func (en enumerator) programs(size int, f func(*Expr) bool) bool {
+	var b builder
+	for first := 1; first <= size; first++ {
+		ok := en.statements(first, func(stmt *Expr) bool {
+			if first == size {
+				return f(stmt)
+			}
+			return en.programs(size-first, func(rest *Expr) bool {
+				return f(b.seq(stmt, rest))
+			})
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// statements calls f for the single statements of the given size until f
+// returns false. It reports whether all statements have been visited.
+func (en enumerator) statements(size int, f func(*Expr) bool) bool {
+	var b builder
+	for v := 0; v < en.vars; v++ {
+		if size == 1 {
+			if !f(b.incr(v)) || !f(b.decr(v)) {
+				return false
+			}
+			continue
+		}
+		ok := en.programs(size-1, func(body *Expr) bool {
+			return f(b.while(v, body))
+		})
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"testing"
+)
+
+func TestSize(t *testing.T) {
+	if size := Size(mustParse(t, mulProg)); size != 9 {
+		t.Errorf("expected size 9, got %d", size)
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	// With one variable there are 2 statements of size 1, so 2 programs of
+	// size 1 and 2·2 sequences and 2 loops of size 2. With two variables
+	// there are 4 programs of size 1, 4·4 + 2·4 = 24 of size 2 and
+	// 4·24 + 8·4 + 2·24 = 176 of size 3.
+	tests := []struct {
+		maxSize, vars, count int
+	}{
+		{1, 1, 2},
+		{2, 1, 8},
+		{1, 3, 6},
+		{3, 2, 4 + 24 + 176},
+	}
+	for _, test := range tests {
+		seen := make(map[string]bool)
+		size := 0
+		Enumerate(test.maxSize, test.vars, func(e *Expr) bool {
+			src := Format(e)
+			if seen[src] {
+				t.Fatalf("%s is enumerated twice", src)
+			}
+			seen[src] = true
+			if Size(e) < size || Size(e) > test.maxSize {
+				t.Fatalf("%s has size %d after size %d", src, Size(e), size)
+			}
+			size = Size(e)
+			if maxVariable(e) >= test.vars {
+				t.Fatalf("%s uses more than %d variables", src, test.vars)
+			}
+			mustParse(t, src)
+			return true
+		})
+		if len(seen) != test.count {
+			t.Errorf("size %d with %d variables: expected %d programs, got %d",
+				test.maxSize, test.vars, test.count, len(seen))
+		}
+	}
+}
+
+func TestEnumerateOrder(t *testing.T) {
+	var progs []string
+	Enumerate(3, 1, func(e *Expr) bool {
+		progs = append(progs, Format(e))
+		return len(progs) < 5
+	})
+	expected := []string{
+		"x0 := x0 + 1",
+		"x0 := x0 - 1",
+		"x0 := x0 + 1;\nx0 := x0 + 1",
+		"x0 := x0 + 1;\nx0 := x0 - 1",
+		"x0 := x0 - 1;\nx0 := x0 + 1",
+	}
+	if len(progs) != len(expected) {
+		t.Fatalf("expected %d programs, got %d", len(expected), len(progs))
+	}
+	for i := range expected {
+		if progs[i] != expected[i] {
+			t.Errorf("%d: expected %q, got %q", i, expected[i], progs[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Format returns the source code of e with one statement per line and the
+// bodies of loops and conditionals indented by two spaces.
+func Format(e *Expr) string {
+	var buf bytes.Buffer
+	format(&buf, e, 0)
+	return buf.String()
+}
+
+// format writes e indented by depth levels to buf.
+func format(buf *bytes.Buffer, e *Expr, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch e.Type {
+	case SEQ_EXPR:
+		format(buf, e.SeqExpr.P1, depth)
+		buf.WriteString(";\n")
+		format(buf, e.SeqExpr.P2, depth)
+	case WHILE_EXPR:
+		formatBlock(buf, e, e.WhileExpr.P, depth)
+	case LOOP_EXPR:
+		formatBlock(buf, e, e.LoopExpr.P, depth)
+	case IF_EXPR:
+		buf.WriteString(indent + statementString(e) + "\n")
+		format(buf, e.IfExpr.Then, depth+1)
+		if e.IfExpr.Else != nil {
+			buf.WriteString("\n" + indent + "ELSE\n")
+			format(buf, e.IfExpr.Else, depth+1)
+		}
+		buf.WriteString("\n" + indent + "END")
+	default:
+		buf.WriteString(indent + statementString(e))
+	}
+}
+
+// formatBlock writes the head of e followed by the body and END.
+func formatBlock(buf *bytes.Buffer, e, body *Expr, depth int) {
+	indent := strings.Repeat("  ", depth)
+	buf.WriteString(indent + statementString(e) + "\n")
+	format(buf, body, depth+1)
+	buf.WriteString("\n" + indent + "END")
+}
+
+// statementString returns the source code of an increment expression or
+// assignment or the head of a loop or conditional.
+func statementString(e *Expr) string {
+	switch e.Type {
+	case INCR_EXPR:
+		op := "+"
+		if e.IncrExpr.Decrement {
+			op = "-"
+		}
+		src, c := e.IncrExpr.operands()
+		return fmt.Sprintf("x%d := x%d %s %d", e.IncrExpr.Variable, src, op, c)
+	case WHILE_EXPR:
+		return fmt.Sprintf("WHILE x%d != 0 DO", e.WhileExpr.Variable)
+	case ASSIGN_EXPR:
+		a := e.AssignExpr
+		switch a.Op {
+		case CONSTANT:
+			return fmt.Sprintf("x%d := %d", a.Variable, a.Constant)
+		case TIMES:
+			return fmt.Sprintf("x%d := x%d * x%d", a.Variable, a.Source, a.Factor)
+		case MINUS:
+			return fmt.Sprintf("x%d := x%d - %d", a.Variable, a.Source, a.Constant)
+		}
+		return fmt.Sprintf("x%d := x%d + %d", a.Variable, a.Source, a.Constant)
+	case IF_EXPR:
+		return fmt.Sprintf("IF x%d = 0 THEN", e.IfExpr.Variable)
+	case LOOP_EXPR:
+		return fmt.Sprintf("LOOP x%d DO", e.LoopExpr.Variable)
+	case CALL_EXPR:
+		args := make([]string, len(e.CallExpr.Args))
+		for i, v := range e.CallExpr.Args {
+			args[i] = fmt.Sprintf("x%d", v)
+		}
+		return fmt.Sprintf("%s(%s)", e.CallExpr.Name, strings.Join(args, ", "))
+	}
+	return e.String()
+}
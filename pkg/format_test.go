@@ -0,0 +1,82 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	input := "x1 := x1 + 1; WHILE x1 != 0 DO x1 := x1 - 1; WHILE x2 != 0 DO x2 := x2 - 1 END END"
+	expected := `x1 := x1 + 1;
+WHILE x1 != 0 DO
+  x1 := x1 - 1;
+  WHILE x2 != 0 DO
+    x2 := x2 - 1
+  END
+END`
+	if got := Format(mustParse(t, input)); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestFormatSugar(t *testing.T) {
+	input := "x1 := 3; x2 := x1 - 2; x3 := x1 * x2; IF x1 = 0 THEN x0 := x1 ELSE LOOP x2 DO x0 := x0 + 1 END END"
+	expected := `x1 := 3;
+x2 := x1 - 2;
+x3 := x1 * x2;
+IF x1 = 0 THEN
+  x0 := x1 + 0
+ELSE
+  LOOP x2 DO
+    x0 := x0 + 1
+  END
+END`
+	if got := Format(mustParseSugar(t, input)); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestFormatGeneralIncr(t *testing.T) {
+	input := "x0 := x1 + 12; x2 := x2 - 3; x1 := x1 - 1"
+	expected := "x0 := x1 + 12;\nx2 := x2 - 3;\nx1 := x1 - 1"
+	prog, err := NewParser(strings.NewReader(input), SchoeningDialect).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Format(prog); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestFormatReparse(t *testing.T) {
+	for _, input := range []string{addProg, mulProg, loopProg} {
+		prog := mustParse(t, input)
+		reparsed := mustParse(t, Format(prog))
+		clearPos(prog)
+		clearPos(reparsed)
+		if !reflect.DeepEqual(prog, reparsed) {
+			t.Errorf("%q changed after formatting to %q", input, Format(prog))
+		}
+	}
+}
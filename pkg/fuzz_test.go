@@ -0,0 +1,76 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// The seed corpus of the fuzz targets is in testdata/fuzz.
+
+// FuzzScanner checks that the scanner terminates on arbitrary input in every
+// dialect. Every token but EOF consumes at least one character.
+func FuzzScanner(f *testing.F) {
+	f.Fuzz(func(t *testing.T, src []byte) {
+		for _, d := range Dialects {
+			s := NewScanner(bytes.NewReader(src), d)
+			for n := 0; ; n++ {
+				if n > len(src) {
+					t.Fatalf("%s: more than %d tokens for %q", d.Name, len(src), src)
+				}
+				tok, _, err := s.Scan()
+				if err != nil || tok == EOF {
+					break
+				}
+			}
+		}
+	})
+}
+
+// FuzzParser checks that parsing arbitrary input does not panic and that a
+// parsed program is parsed to the same expression again after formatting.
+// Programs with named variables are not formatted with their names, so that
+// dialect is skipped.
+func FuzzParser(f *testing.F) {
+	f.Fuzz(func(t *testing.T, src []byte) {
+		for _, d := range Dialects {
+			if d.Names {
+				continue
+			}
+			prog, err := NewParser(bytes.NewReader(src), d).Parse()
+			if err != nil {
+				continue
+			}
+			formatted := Format(prog)
+			reparsed, err := NewParser(bytes.NewBufferString(formatted), d).Parse()
+			if err != nil {
+				t.Fatalf("%s: error parsing formatted %q of %q: %s", d.Name, formatted, src, err)
+			}
+			clearPos(prog)
+			clearPos(reparsed)
+			if !reflect.DeepEqual(prog, reparsed) {
+				t.Fatalf("%s: %q changed after formatting to %q", d.Name, src, formatted)
+			}
+		}
+	})
+}
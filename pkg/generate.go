@@ -0,0 +1,118 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "math/rand"
+
+// GenerateOptions configures the random programs of Generate.
+type GenerateOptions struct {
+	// Depth is the maximum nesting depth of while expressions.
+	Depth int
+	// Vars is the number of variables x0, ..., x(Vars-1), at least 1.
+	Vars int
+	// Statements is the maximum number of statements of a sequence, at
+	// least 1.
+	Statements int
+	// LoopProb is the probability of a statement being a while expression
+	// if the depth allows it.
+	LoopProb float64
+	// Terminating restricts the program to bounded loops, see ClassifyLoops,
+	// so it always halts. Otherwise most, but not all, loop bodies decrement
+	// the loop variable.
+	Terminating bool
+}
+
+// DefaultGenerateOptions are the options used by the generate command.
+var DefaultGenerateOptions = GenerateOptions{Depth: 2, Vars: 3, Statements: 4, LoopProb: 0.3}
+
+// Generate returns a random core program. The same state of rng gives the
+// same program.
+func Generate(rng *rand.Rand, opts GenerateOptions) *Expr {
+	if opts.Vars < 1 {
+		opts.Vars = 1
+	}
+	if opts.Statements < 1 {
+		opts.Statements = 1
+	}
+	g := generator{rng, opts}
+	return g.seq(opts.Depth, make([]bool, opts.Vars))
+}
+
+// generator creates random programs.
+type generator struct {
+	rng  *rand.Rand
+	opts GenerateOptions
+}
+
+// seq returns a random sequence with loops nested at most depth deep. The
+// loop variables of enclosing bounded loops are reserved and not used.
+func (g generator) seq(depth int, reserved []bool) *Expr {
+	var b builder
+	var free []int
+	for v, r := range reserved {
+		if !r {
+			free = append(free, v)
+		}
+	}
+	if len(free) == 0 {
+		// There is no statement without the reserved variables, so only
+		// the enclosing loop's decrement remains.
+		return nil
+	}
+
+	var stmts []*Expr
+	for n := 1 + g.rng.Intn(g.opts.Statements); n > 0; n-- {
+		v := free[g.rng.Intn(len(free))]
+		switch {
+		case depth > 0 && g.rng.Float64() < g.opts.LoopProb:
+			stmts = append(stmts, g.loop(v, depth, reserved))
+		case g.rng.Intn(3) == 0:
+			stmts = append(stmts, b.decr(v))
+		default:
+			stmts = append(stmts, b.incr(v))
+		}
+	}
+	return b.seq(stmts...)
+}
+
+// loop returns a random while expression over xV.
+func (g generator) loop(v, depth int, reserved []bool) *Expr {
+	var b builder
+	if g.opts.Terminating {
+		inner := append([]bool(nil), reserved...)
+		inner[v] = true
+		body := g.seq(depth-1, inner)
+		switch {
+		case body == nil:
+			return b.while(v, b.decr(v))
+		case g.rng.Intn(2) == 0:
+			return b.while(v, b.decr(v), body)
+		default:
+			return b.while(v, body, b.decr(v))
+		}
+	}
+
+	body := g.seq(depth-1, reserved)
+	if g.rng.Intn(4) != 0 {
+		body = b.seq(body, b.decr(v))
+	}
+	return b.while(v, body)
+}
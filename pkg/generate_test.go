@@ -0,0 +1,90 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// loopDepth returns the maximum nesting depth of while expressions in e.
+func loopDepth(e *Expr) int {
+	switch e.Type {
+	case SEQ_EXPR:
+		d1, d2 := loopDepth(e.SeqExpr.P1), loopDepth(e.SeqExpr.P2)
+		if d1 > d2 {
+			return d1
+		}
+		return d2
+	case WHILE_EXPR:
+		return 1 + loopDepth(e.WhileExpr.P)
+	}
+	return 0
+}
+
+func TestGenerate(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	opts := GenerateOptions{Depth: 3, Vars: 4, Statements: 3, LoopProb: 0.5}
+	loops := 0
+	for i := 0; i < 300; i++ {
+		prog := Generate(rng, opts)
+		mustParse(t, Format(prog))
+		if d := loopDepth(prog); d > opts.Depth {
+			t.Fatalf("%s: expected depth at most %d, got %d", Format(prog), opts.Depth, d)
+		}
+		if v := maxVariable(prog); v >= opts.Vars {
+			t.Fatalf("%s: expected variables below x%d", Format(prog), opts.Vars)
+		}
+		loops += len(ClassifyLoops(prog))
+	}
+	if loops == 0 {
+		t.Errorf("expected loops")
+	}
+
+	opts.LoopProb = 0
+	if prog := Generate(rng, opts); loopDepth(prog) != 0 {
+		t.Errorf("expected no loops, got %s", Format(prog))
+	}
+
+	// The same seed gives the same program.
+	opts.LoopProb = 0.5
+	p1 := Generate(rand.New(rand.NewSource(1)), opts)
+	p2 := Generate(rand.New(rand.NewSource(1)), opts)
+	if Format(p1) != Format(p2) {
+		t.Errorf("expected the same programs, got %s and %s", Format(p1), Format(p2))
+	}
+}
+
+func TestGenerateTerminating(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	opts := GenerateOptions{Depth: 4, Vars: 3, Statements: 3, LoopProb: 0.6, Terminating: true}
+	for i := 0; i < 300; i++ {
+		prog := Generate(rng, opts)
+		for _, info := range ClassifyLoops(prog) {
+			if info.Kind != LOOP_BOUNDED {
+				t.Fatalf("%s: %s", Format(prog), info)
+			}
+		}
+		if _, err := Run(prog, 100000, 1, 2); err != nil {
+			t.Fatalf("%s: %s", Format(prog), err)
+		}
+	}
+}
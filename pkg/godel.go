@@ -0,0 +1,149 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Programs of the core language are numbered by
+//
+//	code(xN := xN + 1)           = 4·N
+//	code(xN := xN - 1)           = 4·N + 1
+//	code(P1; P2)                 = 4·pair(code(P1), code(P2)) + 2
+//	code(WHILE xN != 0 DO P END) = 4·pair(N, code(P)) + 3
+//
+// where pair is the Cantor pairing function
+//
+//	pair(a, b) = (a + b)·(a + b + 1)/2 + b
+//
+// Since pair is a bijection between pairs of natural numbers and natural
+// numbers, every natural number is the code of exactly one program. The
+// numbering ignores positions and keeps the nesting of sequences.
+
+// Encode returns the Gödel number of the program. Programs of the sugar
+// dialect or the LOOP language are desugared first, which fails if their
+// temporary variables do not fit into an int.
+func Encode(e *Expr) (*big.Int, error) {
+	core, err := Desugar(e)
+	if err != nil {
+		return nil, err
+	}
+	return encode(core), nil
+}
+
+// encode returns the Gödel number of the core expression e.
+func encode(e *Expr) *big.Int {
+	code := new(big.Int)
+	switch e.Type {
+	case INCR_EXPR:
+		code.SetInt64(int64(e.IncrExpr.Variable))
+		code.Lsh(code, 2)
+		if e.IncrExpr.Decrement {
+			code.SetBit(code, 0, 1)
+		}
+	case SEQ_EXPR:
+		code.Lsh(Pair(encode(e.SeqExpr.P1), encode(e.SeqExpr.P2)), 2)
+		code.SetBit(code, 1, 1)
+	case WHILE_EXPR:
+		code.Lsh(Pair(big.NewInt(int64(e.WhileExpr.Variable)), encode(e.WhileExpr.P)), 2)
+		code.SetBit(code, 0, 1)
+		code.SetBit(code, 1, 1)
+	}
+	return code
+}
+
+// Decode returns the program with the Gödel number n. Variables have to fit
+// into an int.
+func Decode(n *big.Int) (*Expr, error) {
+	if n.Sign() < 0 {
+		return nil, fmt.Errorf("negative number %s is not a program", n)
+	}
+	return decode(n)
+}
+
+// decode returns the program with the natural Gödel number n.
+func decode(n *big.Int) (*Expr, error) {
+	var b builder
+	rest := new(big.Int).Rsh(n, 2)
+	variable := func(v *big.Int) (int, error) {
+		if !v.IsInt64() || v.Int64() != int64(int(v.Int64())) {
+			return 0, fmt.Errorf("variable x%s is too large", v)
+		}
+		return int(v.Int64()), nil
+	}
+
+	switch n.Bit(0) + 2*n.Bit(1) {
+	case 0, 1:
+		v, err := variable(rest)
+		if err != nil {
+			return nil, err
+		}
+		if n.Bit(0) == 1 {
+			return b.decr(v), nil
+		}
+		return b.incr(v), nil
+	case 2:
+		c1, c2 := Unpair(rest)
+		p1, err := decode(c1)
+		if err != nil {
+			return nil, err
+		}
+		p2, err := decode(c2)
+		if err != nil {
+			return nil, err
+		}
+		return b.seq(p1, p2), nil
+	}
+	a, c := Unpair(rest)
+	v, err := variable(a)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(c)
+	if err != nil {
+		return nil, err
+	}
+	return b.while(v, p), nil
+}
+
+// Pair returns the Cantor pairing (a + b)·(a + b + 1)/2 + b of the natural
+// numbers a and b.
+func Pair(a, b *big.Int) *big.Int {
+	s := new(big.Int).Add(a, b)
+	t := new(big.Int).Add(s, big.NewInt(1))
+	t.Mul(t, s).Rsh(t, 1)
+	return t.Add(t, b)
+}
+
+// Unpair returns the natural numbers a and b with Pair(a, b) = n.
+func Unpair(n *big.Int) (a, b *big.Int) {
+	// s = a + b is the largest number with s·(s + 1)/2 <= n, which is
+	// ⌊(√(8n + 1) - 1)/2⌋.
+	s := new(big.Int).Lsh(n, 3)
+	s.Add(s, big.NewInt(1)).Sqrt(s).Sub(s, big.NewInt(1)).Rsh(s, 1)
+	t := new(big.Int).Add(s, big.NewInt(1))
+	t.Mul(t, s).Rsh(t, 1)
+	b = new(big.Int).Sub(n, t)
+	a = new(big.Int).Sub(s, b)
+	return a, b
+}
@@ -0,0 +1,120 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPair(t *testing.T) {
+	// The pairs are numbered along the diagonals a + b = s.
+	n := int64(0)
+	for s := int64(0); s < 20; s++ {
+		for b := int64(0); b <= s; b++ {
+			code := Pair(big.NewInt(s-b), big.NewInt(b))
+			if code.Int64() != n {
+				t.Fatalf("pair(%d, %d): expected %d, got %s", s-b, b, n, code)
+			}
+			if a2, b2 := Unpair(code); a2.Int64() != s-b || b2.Int64() != b {
+				t.Fatalf("unpair(%d): expected %d, %d, got %s, %s", n, s-b, b, a2, b2)
+			}
+			n++
+		}
+	}
+}
+
+func mustEncode(t testing.TB, e *Expr) *big.Int {
+	t.Helper()
+	code, err := Encode(e)
+	if err != nil {
+		t.Fatalf("%s: %s", Format(e), err)
+	}
+	return code
+}
+
+func TestEncode(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		code  int64
+	}{
+		"Increment": {"x3 := x3 + 1", 12},
+		"Decrement": {"x0 := x0 - 1", 1},
+		// pair(0, 1) = 2
+		"Sequence": {"x0 := x0 + 1; x0 := x0 - 1", 4*2 + 2},
+		// pair(1, 1) = 4
+		"While": {"WHILE x1 != 0 DO x0 := x0 - 1 END", 4*4 + 3},
+	}
+	for caseName, testCase := range tests {
+		code := mustEncode(t, mustParse(t, testCase.input))
+		if code.Int64() != testCase.code {
+			t.Errorf("%s: expected %d, got %s", caseName, testCase.code, code)
+		}
+	}
+
+	// Sugar is desugared first.
+	prog, err := NewSugarParser(strings.NewReader("x1 := 2")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mustEncode(t, prog).Cmp(mustEncode(t, mustDesugar(t, prog))) != 0 {
+		t.Errorf("expected the code of the desugared program")
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for i := 0; i < 500; i++ {
+		prog := randomProg(rng, 3, 4)
+		code := mustEncode(t, prog)
+		decoded, err := Decode(code)
+		if err != nil {
+			t.Fatalf("%s: %s", Format(prog), err)
+		}
+		if Format(decoded) != Format(prog) || mustEncode(t, decoded).Cmp(code) != 0 {
+			t.Fatalf("expected %s, got %s", Format(prog), Format(decoded))
+		}
+	}
+
+	// Every number is the code of a program.
+	for i := 0; i < 500; i++ {
+		code := new(big.Int).Rand(rng, big.NewInt(1<<62))
+		prog, err := Decode(code)
+		if err != nil {
+			t.Fatalf("%s: %s", code, err)
+		}
+		if got := mustEncode(t, prog); got.Cmp(code) != 0 {
+			t.Fatalf("%s: got %s for %s", code, got, Format(prog))
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(big.NewInt(-1)); err == nil || err.Error() != "negative number -1 is not a program" {
+		t.Errorf("expected error for negative number, got %v", err)
+	}
+	huge := new(big.Int).Lsh(big.NewInt(1), 100)
+	if _, err := Decode(huge); err == nil || err.Error() != "variable x"+new(big.Int).Rsh(huge, 2).String()+" is too large" {
+		t.Errorf("expected error for huge variable, got %v", err)
+	}
+}
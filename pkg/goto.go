@@ -0,0 +1,384 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// GotoOp is the operation of a GOTO instruction.
+type GotoOp int
+
+const (
+	// GOTO_INCR is the instruction `xN := xN + 1`
+	GOTO_INCR GotoOp = iota
+	// GOTO_DECR is the instruction `xN := xN - 1`
+	GOTO_DECR
+	// GOTO_IF is the instruction `IF xN = 0 GOTO Mk`
+	GOTO_IF
+	// GOTO_JUMP is the instruction `GOTO Mk`
+	GOTO_JUMP
+	// GOTO_HALT is the instruction `HALT`
+	GOTO_HALT
+)
+
+// Instr is an instruction of a GOTO program.
+type Instr struct {
+	Op GotoOp
+	// Variable is the variable N of increments, decrements and conditional
+	// jumps.
+	Variable int
+	// Target is the index of the instruction jumped to. An index after the
+	// last instruction halts the program.
+	Target int
+	// Pos is the position of the instruction in the source code.
+	Pos Pos
+}
+
+// GotoProgram is a program of the GOTO language, which consists of labelled
+// instructions separated by semicolons, e.g.
+//
+//	M1: IF x1 = 0 GOTO M4;
+//	M2: x1 := x1 - 1;
+//	M3: GOTO M1;
+//	M4: HALT
+//
+// A program halts at HALT or after the last instruction.
+type GotoProgram struct {
+	Instrs []Instr
+}
+
+// String returns the source code of the program. The instruction with
+// index i gets the label M(i+1).
+func (g *GotoProgram) String() string {
+	var buf bytes.Buffer
+	for i, instr := range g.Instrs {
+		if i > 0 {
+			buf.WriteString(";\n")
+		}
+		fmt.Fprintf(&buf, "M%d: ", i+1)
+		switch instr.Op {
+		case GOTO_INCR:
+			fmt.Fprintf(&buf, "x%d := x%d + 1", instr.Variable, instr.Variable)
+		case GOTO_DECR:
+			fmt.Fprintf(&buf, "x%d := x%d - 1", instr.Variable, instr.Variable)
+		case GOTO_IF:
+			fmt.Fprintf(&buf, "IF x%d = 0 GOTO M%d", instr.Variable, instr.Target+1)
+		case GOTO_JUMP:
+			fmt.Fprintf(&buf, "GOTO M%d", instr.Target+1)
+		case GOTO_HALT:
+			buf.WriteString("HALT")
+		}
+	}
+	return buf.String()
+}
+
+// ParseGoto parses the input as GOTO program. Labels are optional, but must
+// be unique.
+func (p *Parser) ParseGoto() (*GotoProgram, error) {
+	if p.names != nil {
+		return nil, &Error{Pos{1, 1}, "GOTO programs can not have named variables"}
+	}
+	prog := &GotoProgram{}
+	labels := make(map[string]int)
+	type jump struct {
+		instr int
+		label string
+		pos   Pos
+	}
+	var jumps []jump
+
+	for {
+		tok, lit, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, p.errorf("error tokenizing: %s", err)
+		}
+		if tok == LABEL {
+			if _, ok := labels[lit]; ok {
+				return nil, p.errorf("label %s is already defined", lit)
+			}
+			labels[lit] = len(prog.Instrs)
+			if _, err = p.expect(COLON); err != nil {
+				return nil, err
+			}
+			if tok, lit, err = p.scanIgnoreWhitespace(); err != nil {
+				return nil, p.errorf("error tokenizing: %s", err)
+			}
+		}
+
+		instr := Instr{Pos: p.buf.pos}
+		switch tok {
+		case VARIABLE:
+			p.unscan()
+			incr, err := p.parseIncr()
+			if err != nil {
+				return nil, err
+			}
+			instr.Op, instr.Variable = GOTO_INCR, incr.Variable
+			if incr.Decrement {
+				instr.Op = GOTO_DECR
+			}
+		case IF:
+			instr.Op = GOTO_IF
+			if instr.Variable, err = p.parseVariable(); err != nil {
+				return nil, err
+			}
+			if _, err = p.expect(EQUAL); err != nil {
+				return nil, err
+			}
+			if lit, err = p.expect(CONSTANT); err != nil {
+				return nil, err
+			}
+			if lit != "0" {
+				return nil, p.errorf("if condition has to compare with 0, got \"%s\"", lit)
+			}
+			if _, err = p.expect(GOTO); err != nil {
+				return nil, err
+			}
+			fallthrough
+		case GOTO:
+			if instr.Op != GOTO_IF {
+				instr.Op = GOTO_JUMP
+			}
+			if lit, err = p.expect(LABEL); err != nil {
+				return nil, err
+			}
+			jumps = append(jumps, jump{len(prog.Instrs), lit, p.buf.pos})
+		case HALT:
+			instr.Op = GOTO_HALT
+		default:
+			return nil, p.errorf("expected instruction, got %s", describeToken(tok, lit))
+		}
+		prog.Instrs = append(prog.Instrs, instr)
+
+		if tok, _, err = p.scanIgnoreWhitespace(); err != nil {
+			return nil, p.errorf("error tokenizing: %s", err)
+		}
+		if tok != SEMICOLON {
+			p.unscan()
+			break
+		}
+	}
+
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, p.errorf("error tokenizing: %s", err)
+	}
+	if tok != EOF {
+		return nil, p.errorf("unexpected %s after end of program", describeToken(tok, lit))
+	}
+
+	for _, j := range jumps {
+		target, ok := labels[j.label]
+		if !ok {
+			return nil, &Error{j.pos, fmt.Sprintf("undefined label %s", j.label)}
+		}
+		prog.Instrs[j.instr].Target = target
+	}
+	return prog, nil
+}
+
+// RunGoto executes prog with the given input and returns the value of x0.
+// Every instruction takes one step and increments stop at the largest value
+// of a variable like in the interpreter. If limit is greater than zero and the
+// program does not halt within limit steps, ErrStepLimit is returned.
+func RunGoto(prog *GotoProgram, limit int, input ...uint64) (uint64, error) {
+	x0, _, err := runGoto(prog, limit, input)
+	return x0, err
+}
+
+// runGoto is like RunGoto, but also returns the number of executed
+// increments, decrements and conditional jumps. For programs translated by
+// CompileGoto these are the steps of the interpreter, since the other
+// instructions only close loops and halt.
+func runGoto(prog *GotoProgram, limit int, input []uint64) (uint64, int, error) {
+	// The variables are numbered by their first use, so large variable
+	// numbers do not need a large slice. slots maps the instructions to the
+	// indices of their variables.
+	index := make(map[int]int)
+	for v := 0; v <= len(input); v++ {
+		index[v] = v
+	}
+	slots := make([]int, len(prog.Instrs))
+	for i, instr := range prog.Instrs {
+		slot, ok := index[instr.Variable]
+		if !ok {
+			slot = len(index)
+			index[instr.Variable] = slot
+		}
+		slots[i] = slot
+	}
+	vars := make([]uint64, len(index))
+	copy(vars[1:], input)
+
+	counted := 0
+	for pc, steps := 0, 0; pc < len(prog.Instrs); steps++ {
+		if limit > 0 && steps >= limit {
+			return vars[0], counted, ErrStepLimit
+		}
+		instr, slot := prog.Instrs[pc], slots[pc]
+		pc++
+		if instr.Op != GOTO_JUMP && instr.Op != GOTO_HALT {
+			counted++
+		}
+		switch instr.Op {
+		case GOTO_INCR:
+			if vars[slot] < math.MaxUint64 {
+				vars[slot]++
+			}
+		case GOTO_DECR:
+			if vars[slot] > 0 {
+				vars[slot]--
+			}
+		case GOTO_IF:
+			if vars[slot] == 0 {
+				pc = instr.Target
+			}
+		case GOTO_JUMP:
+			pc = instr.Target
+		case GOTO_HALT:
+			return vars[0], counted, nil
+		}
+	}
+	return vars[0], counted, nil
+}
+
+// CompileGoto translates a program to an equivalent GOTO program. Programs
+// of the sugar dialect or the LOOP language are desugared first, which fails
+// if their temporary variables do not fit into an int.
+//
+// A while expression `WHILE xN != 0 DO P END` becomes
+//
+//	Mi: IF xN = 0 GOTO Mk;
+//	    P;
+//	    GOTO Mi;
+//	Mk: ...
+func CompileGoto(e *Expr) (*GotoProgram, error) {
+	core, err := Desugar(e)
+	if err != nil {
+		return nil, err
+	}
+	prog := &GotoProgram{}
+	compileGoto(prog, core)
+	prog.Instrs = append(prog.Instrs, Instr{Op: GOTO_HALT, Pos: e.End})
+	return prog, nil
+}
+
+// compileGoto appends the instructions of the core expression e to prog.
+func compileGoto(prog *GotoProgram, e *Expr) {
+	switch e.Type {
+	case INCR_EXPR:
+		op := GOTO_INCR
+		if e.IncrExpr.Decrement {
+			op = GOTO_DECR
+		}
+		prog.Instrs = append(prog.Instrs, Instr{Op: op, Variable: e.IncrExpr.Variable, Pos: e.Pos})
+	case SEQ_EXPR:
+		compileGoto(prog, e.SeqExpr.P1)
+		compileGoto(prog, e.SeqExpr.P2)
+	case WHILE_EXPR:
+		start := len(prog.Instrs)
+		prog.Instrs = append(prog.Instrs, Instr{Op: GOTO_IF, Variable: e.WhileExpr.Variable, Pos: e.Pos})
+		compileGoto(prog, e.WhileExpr.P)
+		prog.Instrs = append(prog.Instrs, Instr{Op: GOTO_JUMP, Target: start, Pos: e.Pos})
+		prog.Instrs[start].Target = len(prog.Instrs)
+	}
+}
+
+// GotoToWhile translates a GOTO program to an equivalent program with exactly
+// one while expression, which shows Kleene's normal form theorem. The body
+// of the loop uses IF expressions of the sugar dialect, which Desugar lowers
+// to loops that always terminate.
+//
+// The loop runs while the variable h is not 0. Every instruction i has a
+// variable g_i, which is 0 if the instruction is executed next and 1
+// otherwise. These helper variables follow the variables used by g. They are
+// set by assignments of the sugar dialect, since they may have been given as
+// input, and are 0 again at the end. An error is returned if their numbers
+// would not fit into an int.
+func GotoToWhile(g *GotoProgram) (*Expr, error) {
+	n := len(g.Instrs)
+	max := 0
+	for _, instr := range g.Instrs {
+		if instr.Variable > max {
+			max = instr.Variable
+		}
+	}
+	if max > maxInt-1-n {
+		return nil, fmt.Errorf("x%d is too large to number helper variables after it", max)
+	}
+	h := max + 1
+	flag := func(i int) int { return h + 1 + i }
+
+	var b builder
+	if n == 0 {
+		return b.seq(b.incr(0), b.decr(0)), nil
+	}
+	init := []*Expr{b.set(h, 1), b.set(flag(0), 0)}
+	cleanup := []*Expr{}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			init = append(init, b.set(flag(i), 1))
+		}
+		cleanup = append(cleanup, b.decr(flag(i)))
+	}
+
+	var body []*Expr
+	for i, instr := range g.Instrs {
+		b := builder{instr.Pos, instr.Pos}
+		// activate makes instruction k the next one or halts.
+		activate := func(k int) *Expr {
+			if k >= n {
+				return b.decr(h)
+			}
+			return b.decr(flag(k))
+		}
+
+		stmts := []*Expr{b.incr(flag(i))}
+		switch instr.Op {
+		case GOTO_INCR:
+			stmts = append(stmts, b.incr(instr.Variable), activate(i+1))
+		case GOTO_DECR:
+			stmts = append(stmts, b.decr(instr.Variable), activate(i+1))
+		case GOTO_IF:
+			stmts = append(stmts, b.ifZero(instr.Variable, activate(instr.Target), activate(i+1)))
+		case GOTO_JUMP:
+			stmts = append(stmts, activate(instr.Target))
+		case GOTO_HALT:
+			stmts = append(stmts, b.decr(h))
+		}
+		body = append(body, b.ifZero(flag(i), b.seq(stmts...), nil))
+	}
+
+	return b.seq(append(append(init, b.while(h, body...)), cleanup...)...), nil
+}
+
+// set returns the assignment `xN := c`.
+func (b builder) set(n int, c uint64) *Expr {
+	return &Expr{Type: ASSIGN_EXPR, Pos: b.pos, End: b.end, AssignExpr: &AssignExpr{Variable: n, Op: CONSTANT, Constant: c}}
+}
+
+// ifZero returns `IF xN = 0 THEN P ELSE Q END`, where Q may be nil.
+func (b builder) ifZero(n int, p, q *Expr) *Expr {
+	return &Expr{Type: IF_EXPR, Pos: b.pos, End: b.end, IfExpr: &IfExpr{n, p, q}}
+}
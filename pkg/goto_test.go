@@ -0,0 +1,275 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const gotoMulProg = `M1: IF x1 = 0 GOTO M9;
+M2: x1 := x1 - 1;
+M3: IF x2 = 0 GOTO M8;
+M4: x2 := x2 - 1;
+M5: x0 := x0 + 1;
+M6: x3 := x3 + 1;
+M7: GOTO M3;
+M8: IF x3 = 0 GOTO M1;
+    x3 := x3 - 1;
+    x2 := x2 + 1;
+    GOTO M8;
+M9: HALT`
+
+func mustCompileGoto(t testing.TB, e *Expr) *GotoProgram {
+	t.Helper()
+	prog, err := CompileGoto(e)
+	if err != nil {
+		t.Fatalf("%s: %s", Format(e), err)
+	}
+	return prog
+}
+
+func mustGotoToWhile(t testing.TB, g *GotoProgram) *Expr {
+	t.Helper()
+	while, err := GotoToWhile(g)
+	if err != nil {
+		t.Fatalf("%s: %s", g, err)
+	}
+	return while
+}
+
+func mustParseGoto(t testing.TB, input string) *GotoProgram {
+	t.Helper()
+	prog, err := NewParser(strings.NewReader(input)).ParseGoto()
+	if err != nil {
+		t.Fatalf("%q: %s", input, err)
+	}
+	return prog
+}
+
+// randomProg returns a random WHILE program with loops nested at most depth
+// times. Most loops decrement their variable at the end, so many programs
+// halt.
+func randomProg(rng *rand.Rand, depth, vars int) *Expr {
+	var b builder
+	var stmts []*Expr
+	for n := 1 + rng.Intn(3); n > 0; n-- {
+		v := rng.Intn(vars)
+		switch {
+		case depth > 0 && rng.Intn(3) == 0:
+			body := randomProg(rng, depth-1, vars)
+			if rng.Intn(4) != 0 {
+				body = b.seq(body, b.decr(v))
+			}
+			stmts = append(stmts, b.while(v, body))
+		case rng.Intn(3) == 0:
+			stmts = append(stmts, b.decr(v))
+		default:
+			stmts = append(stmts, b.incr(v))
+		}
+	}
+	return b.seq(stmts...)
+}
+
+// randomGoto returns a random GOTO program.
+func randomGoto(rng *rand.Rand, vars int) *GotoProgram {
+	prog := &GotoProgram{Instrs: make([]Instr, 1+rng.Intn(8))}
+	for i := range prog.Instrs {
+		prog.Instrs[i] = Instr{
+			Op:       GotoOp(rng.Intn(5)),
+			Variable: rng.Intn(vars),
+			Target:   rng.Intn(len(prog.Instrs) + 1),
+		}
+	}
+	return prog
+}
+
+func TestParseGoto(t *testing.T) {
+	prog := mustParseGoto(t, gotoMulProg)
+	if len(prog.Instrs) != 12 {
+		t.Fatalf("expected 12 instructions, got %d", len(prog.Instrs))
+	}
+	expected := []Instr{
+		{Op: GOTO_IF, Variable: 1, Target: 11, Pos: Pos{1, 5}},
+		{Op: GOTO_DECR, Variable: 1, Pos: Pos{2, 5}},
+	}
+	for i, instr := range expected {
+		if prog.Instrs[i] != instr {
+			t.Errorf("instruction %d: expected %v, got %v", i, instr, prog.Instrs[i])
+		}
+	}
+	if j := prog.Instrs[10]; j.Op != GOTO_JUMP || j.Target != 7 {
+		t.Errorf("expected jump to M8, got %v", j)
+	}
+
+	// Formatting gives the same program.
+	reparsed := mustParseGoto(t, prog.String())
+	if reparsed.String() != prog.String() {
+		t.Errorf("expected\n%s\ngot\n%s", prog, reparsed)
+	}
+}
+
+func TestParseGotoErrors(t *testing.T) {
+	tests := map[string]string{
+		"Undefined label":  "M1: GOTO M2",
+		"Duplicate label":  "M1: x1 := x1 + 1; M1: HALT",
+		"Compare with 1":   "IF x1 = 1 GOTO M1",
+		"Missing colon":    "M1 HALT",
+		"Missing label":    "GOTO",
+		"While":            "WHILE x1 != 0 DO x1 := x1 - 1 END",
+		"Label only":       "M1:",
+		"Different vars":   "x1 := x2 + 1",
+		"Trailing garbage": "HALT HALT",
+	}
+
+	for caseName, input := range tests {
+		if prog, err := NewParser(strings.NewReader(input)).ParseGoto(); err == nil {
+			t.Errorf("%s: expected error, got %s", caseName, prog)
+		}
+	}
+}
+
+func TestRunGoto(t *testing.T) {
+	prog := mustParseGoto(t, gotoMulProg)
+	for x1 := uint64(0); x1 < 5; x1++ {
+		for x2 := uint64(0); x2 < 5; x2++ {
+			if x0, err := RunGoto(prog, 0, x1, x2); err != nil || x0 != x1*x2 {
+				t.Errorf("%d * %d: expected %d, got %d, %v", x1, x2, x1*x2, x0, err)
+			}
+		}
+	}
+
+	huge := mustParseGoto(t, "x9000000000000000000 := x9000000000000000000 + 1; IF x9000000000000000000 = 0 GOTO M4; x0 := x0 + 1; M4: HALT")
+	if x0, err := RunGoto(huge, 0); err != nil || x0 != 1 {
+		t.Errorf("expected 1, got %d, %v", x0, err)
+	}
+
+	saturate := mustParseGoto(t, "x1 := x1 + 1; x1 := x1 - 1; IF x1 = 0 GOTO M5; x0 := x0 + 1; M5: HALT")
+	if x0, err := RunGoto(saturate, 0, math.MaxUint64); err != nil || x0 != 1 {
+		t.Errorf("expected the increment to saturate, got %d, %v", x0, err)
+	}
+
+	loop := mustParseGoto(t, "M1: x0 := x0 + 1; GOTO M1")
+	if _, err := RunGoto(loop, 100); err != ErrStepLimit {
+		t.Errorf("expected step limit, got %v", err)
+	}
+	// Running past the end and jumping past the end halts.
+	if x0, err := RunGoto(&GotoProgram{Instrs: []Instr{{Op: GOTO_JUMP, Target: 1}}}, 10); err != nil || x0 != 0 {
+		t.Errorf("expected halt, got %d, %v", x0, err)
+	}
+}
+
+// countWhile returns the number of while expressions in e.
+func countWhile(e *Expr) int {
+	n := 0
+	Walk(e, func(e *Expr) bool {
+		if e.Type == WHILE_EXPR {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+func TestGotoToWhile(t *testing.T) {
+	while := mustGotoToWhile(t, mustParseGoto(t, gotoMulProg))
+	if n := countWhile(while); n != 1 {
+		t.Errorf("expected exactly one loop, got %d", n)
+	}
+	core := mustDesugar(t, while)
+	for x1 := uint64(0); x1 < 4; x1++ {
+		for x2 := uint64(0); x2 < 4; x2++ {
+			in := NewInterpreter(core, x1, x2)
+			if err := in.Run(0); err != nil || in.Var(0) != x1*x2 {
+				t.Errorf("%d * %d: expected %d, got %d, %v", x1, x2, x1*x2, in.Var(0), err)
+			}
+			for i, v := range in.Vars()[4:] {
+				if v != 0 {
+					t.Errorf("helper variable x%d is %d at the end", i+4, v)
+				}
+			}
+		}
+	}
+
+	// Input for the helper variables is ignored, x3 is a variable of the
+	// program.
+	if x0, err := Run(core, 100000, 3, 4, 0, 5, 5, 5, 5, 5, 5, 5); err != nil || x0 != 12 {
+		t.Errorf("expected 12 with extra input, got %d, %v", x0, err)
+	}
+
+	if _, err := GotoToWhile(mustParseGoto(t, "x9223372036854775807 := x9223372036854775807 + 1")); err == nil {
+		t.Errorf("expected an error for the helper variables")
+	}
+}
+
+func TestGotoRoundTrip(t *testing.T) {
+	const limit = 100
+	rng := rand.New(rand.NewSource(1))
+	halting := 0
+	for i := 0; i < 300; i++ {
+		prog := randomProg(rng, 2, 3)
+		input := []uint64{uint64(rng.Intn(4)), uint64(rng.Intn(4))}[:maxVariable(prog)]
+		expected, err := Run(prog, limit, input...)
+		if err != nil {
+			continue
+		}
+		halting++
+
+		g := mustCompileGoto(t, prog)
+		if got, err := RunGoto(g, 0, input...); err != nil || got != expected {
+			t.Fatalf("%s\ncompiled to\n%s\nexpected %d, got %d, %v", Format(prog), g, expected, got, err)
+		}
+		while := mustGotoToWhile(t, mustParseGoto(t, g.String()))
+		if n := countWhile(while); n != 1 {
+			t.Fatalf("expected exactly one loop, got %d", n)
+		}
+		if got, err := Run(mustDesugar(t, while), 0, input...); err != nil || got != expected {
+			t.Fatalf("%s\ntranslated to\n%s\nexpected %d, got %d, %v", g, Format(while), expected, got, err)
+		}
+	}
+	if halting < 100 {
+		t.Errorf("only %d random programs halted", halting)
+	}
+}
+
+func TestGotoRandom(t *testing.T) {
+	const limit = 100
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 300; i++ {
+		g := randomGoto(rng, 3)
+		max := 0
+		for _, instr := range g.Instrs {
+			if instr.Variable > max {
+				max = instr.Variable
+			}
+		}
+		input := []uint64{uint64(rng.Intn(4)), uint64(rng.Intn(4))}[:max]
+		expected, err := RunGoto(g, limit, input...)
+		if err != nil {
+			continue
+		}
+		if got, err := Run(mustDesugar(t, mustGotoToWhile(t, g)), 0, input...); err != nil || got != expected {
+			t.Fatalf("%s\nexpected %d, got %d, %v", g, expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Verdict classifies the result of a graded submission or test.
+type Verdict int
+
+const (
+	// VERDICT_PASS indicates that all tests passed.
+	VERDICT_PASS Verdict = iota
+	// VERDICT_PARSE_ERROR indicates that the submission could not be parsed.
+	VERDICT_PARSE_ERROR
+	// VERDICT_RESTRICTED indicates that the submission uses a construct
+	// forbidden by the restrictions of the specification.
+	VERDICT_RESTRICTED
+	// VERDICT_WRONG_ANSWER indicates that x0 had an unexpected value.
+	VERDICT_WRONG_ANSWER
+	// VERDICT_STEP_LIMIT indicates that the step limit was exceeded.
+	VERDICT_STEP_LIMIT
+	// VERDICT_TIME_LIMIT indicates that the time limit was exceeded.
+	VERDICT_TIME_LIMIT
+	// VERDICT_CRASH indicates that grading the submission failed
+	// unexpectedly, which is counted as failure of the submission.
+	VERDICT_CRASH
+)
+
+var verdictNames = []string{"pass", "parse error", "restricted", "wrong answer", "step limit", "time limit", "crash"}
+
+// String returns the name of the verdict, e.g. "wrong answer".
+func (v Verdict) String() string {
+	if v < 0 || int(v) >= len(verdictNames) {
+		return fmt.Sprintf("Verdict(%d)", v)
+	}
+	return verdictNames[v]
+}
+
+// MarshalText encodes the verdict as its name.
+func (v Verdict) MarshalText() ([]byte, error) { return []byte(v.String()), nil }
+
+// Duration is a time.Duration written as a string like "1.5s" in JSON.
+type Duration time.Duration
+
+// MarshalText encodes the duration as a string.
+func (d Duration) MarshalText() ([]byte, error) { return []byte(time.Duration(d).String()), nil }
+
+// UnmarshalText decodes a duration from a string like "1.5s".
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	*d = Duration(duration)
+	return err
+}
+
+// Restrictions limit the constructs a submission may use. Zero values mean no
+// restriction.
+type Restrictions struct {
+	NoNestedLoops bool `json:"noNestedLoops,omitempty"`
+	MaxVariables  int  `json:"maxVariables,omitempty"`
+	MaxLoops      int  `json:"maxLoops,omitempty"`
+}
+
+// Check returns an error for every violated restriction. WHILE and LOOP
+// expressions both count as loops. Expressions other than increments,
+// sequences and loops can not be checked and are reported as errors, so
+// programs have to be desugared first.
+func (r Restrictions) Check(prog *Expr) []error {
+	var errs []error
+	vars := make(map[int]bool)
+	loops := 0
+
+	var check func(e *Expr, inLoop bool)
+	check = func(e *Expr, inLoop bool) {
+		switch e.Type {
+		case INCR_EXPR:
+			vars[e.IncrExpr.Variable] = true
+			if e.IncrExpr.General {
+				vars[e.IncrExpr.Source] = true
+			}
+		case SEQ_EXPR:
+			check(e.SeqExpr.P1, inLoop)
+			check(e.SeqExpr.P2, inLoop)
+		case WHILE_EXPR:
+			vars[e.WhileExpr.Variable] = true
+			loops++
+			if r.NoNestedLoops && inLoop {
+				errs = append(errs, fmt.Errorf("%s: nested loops are not allowed", e.Pos))
+			}
+			check(e.WhileExpr.P, true)
+		case LOOP_EXPR:
+			vars[e.LoopExpr.Variable] = true
+			loops++
+			if r.NoNestedLoops && inLoop {
+				errs = append(errs, fmt.Errorf("%s: nested loops are not allowed", e.Pos))
+			}
+			check(e.LoopExpr.P, true)
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s can not be checked", e.Pos, statementString(e)))
+		}
+	}
+	check(prog, false)
+
+	if r.MaxVariables > 0 && len(vars) > r.MaxVariables {
+		errs = append(errs, fmt.Errorf("%d variables used, at most %d are allowed",
+			len(vars), r.MaxVariables))
+	}
+	if r.MaxLoops > 0 && loops > r.MaxLoops {
+		errs = append(errs, fmt.Errorf("%d loops used, at most %d are allowed",
+			loops, r.MaxLoops))
+	}
+	return errs
+}
+
+// GradeSpec specifies how submissions are graded. It is usually read from
+// JSON like
+//
+//	{
+//		"tests": [{"input": [2, 3], "output": 5}],
+//		"stepLimit": 100000,
+//		"timeLimit": "1s",
+//		"restrictions": {"noNestedLoops": true, "maxVariables": 4}
+//	}
+type GradeSpec struct {
+	Tests []TestCase `json:"tests"`
+	// StepLimit is the maximum number of steps per test. 0 means no limit.
+	StepLimit int `json:"stepLimit"`
+	// TimeLimit is the maximum time per test. 0 means no limit.
+	TimeLimit    Duration     `json:"timeLimit"`
+	Restrictions Restrictions `json:"restrictions"`
+}
+
+// ParseGradeSpec reads a grading specification in JSON.
+func ParseGradeSpec(r io.Reader) (*GradeSpec, error) {
+	spec := &GradeSpec{}
+	if err := json.NewDecoder(r).Decode(spec); err != nil {
+		return nil, err
+	}
+	if spec.StepLimit == 0 && spec.TimeLimit == 0 {
+		return nil, fmt.Errorf("either stepLimit or timeLimit has to be set")
+	}
+	return spec, nil
+}
+
+// GradeTestResult is the result of a single hidden test. The input and the
+// expected output are left out on purpose.
+type GradeTestResult struct {
+	Verdict Verdict  `json:"verdict"`
+	Steps   int      `json:"steps"`
+	Time    Duration `json:"time"`
+}
+
+// GradeResult is the result of grading a single submission.
+type GradeResult struct {
+	Submission string  `json:"submission"`
+	Verdict    Verdict `json:"verdict"`
+	// Errors contains the parse error or the violated restrictions.
+	Errors []string          `json:"errors,omitempty"`
+	Passed int               `json:"passed"`
+	Tests  []GradeTestResult `json:"tests,omitempty"`
+}
+
+// Grade grades the core program read from r, see GradeProgram. The
+// submission is rejected if it can not be parsed.
+func Grade(name string, r io.Reader, spec *GradeSpec) GradeResult {
+	prog, err := NewParser(r).Parse()
+	if err != nil {
+		return GradeResult{Submission: name, Verdict: VERDICT_PARSE_ERROR, Errors: []string{err.Error()}}
+	}
+	return GradeProgram(name, prog, spec)
+}
+
+// GradeProgram grades the core program of the submission with the given
+// name. The submission is rejected without running it, if it violates the
+// restrictions. Otherwise the verdict is the one of the first failed test.
+// Submissions are untrusted, so a panic while grading one is reported as
+// VERDICT_CRASH instead of stopping the grader.
+func GradeProgram(name string, prog *Expr, spec *GradeSpec) (result GradeResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = GradeResult{Submission: name, Verdict: VERDICT_CRASH, Errors: []string{fmt.Sprint(r)}}
+		}
+	}()
+
+	result = GradeResult{Submission: name}
+	if errs := spec.Restrictions.Check(prog); len(errs) > 0 {
+		result.Verdict = VERDICT_RESTRICTED
+		for _, err := range errs {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		return result
+	}
+
+	for _, tc := range spec.Tests {
+		test := gradeTest(prog, tc, spec)
+		result.Tests = append(result.Tests, test)
+		if test.Verdict == VERDICT_PASS {
+			result.Passed++
+		} else if result.Verdict == VERDICT_PASS {
+			result.Verdict = test.Verdict
+		}
+	}
+	return result
+}
+
+// gradeBatch is the number of steps executed between checks of the time
+// limit.
+const gradeBatch = 10000
+
+// gradeTest runs a single test within the limits of the specification.
+func gradeTest(prog *Expr, tc TestCase, spec *GradeSpec) GradeTestResult {
+	in := NewInterpreter(prog, tc.Input...)
+	start := time.Now()
+	result := GradeTestResult{}
+	for !in.Done() {
+		if spec.StepLimit > 0 && in.Steps() >= spec.StepLimit {
+			result.Verdict = VERDICT_STEP_LIMIT
+			break
+		}
+		if spec.TimeLimit > 0 && time.Since(start) > time.Duration(spec.TimeLimit) {
+			result.Verdict = VERDICT_TIME_LIMIT
+			break
+		}
+
+		limit := in.Steps() + gradeBatch
+		if spec.StepLimit > 0 && limit > spec.StepLimit {
+			limit = spec.StepLimit
+		}
+		in.Run(limit)
+	}
+
+	result.Steps = in.Steps()
+	result.Time = Duration(time.Since(start))
+	if in.Done() && in.Var(0) != tc.Expected {
+		result.Verdict = VERDICT_WRONG_ANSWER
+	}
+	return result
+}
+
+// junitTestSuites is the root element of JUnit XML reports.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as JUnit XML report to w. Every submission
+// is a test suite. Submissions rejected before running or crashing the
+// grader get a single test case "check" with an error.
+func WriteJUnit(w io.Writer, results []GradeResult) error {
+	var report junitTestSuites
+	for _, r := range results {
+		suite := junitTestSuite{Name: r.Submission}
+		if r.Verdict == VERDICT_PARSE_ERROR || r.Verdict == VERDICT_RESTRICTED || r.Verdict == VERDICT_CRASH {
+			suite.Tests, suite.Errors = 1, 1
+			suite.Cases = []junitTestCase{{
+				Name:      "check",
+				ClassName: r.Submission,
+				Time:      "0",
+				Error:     &junitMessage{r.Verdict.String(), strings.Join(r.Errors, "\n")},
+			}}
+		}
+
+		for i, test := range r.Tests {
+			tc := junitTestCase{
+				Name:      fmt.Sprintf("test %d", i+1),
+				ClassName: r.Submission,
+				Time:      fmt.Sprintf("%.3f", time.Duration(test.Time).Seconds()),
+			}
+			if test.Verdict != VERDICT_PASS {
+				suite.Failures++
+				tc.Failure = &junitMessage{test.Verdict.String(),
+					fmt.Sprintf("%s after %d steps", test.Verdict, test.Steps)}
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, tc)
+		}
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,187 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const gradeSpec = `{
+	"tests": [
+		{"input": [2, 3], "output": 5},
+		{"input": [0, 0], "output": 0},
+		{"input": [4, 1], "output": 5}
+	],
+	"stepLimit": 1000,
+	"timeLimit": "10s",
+	"restrictions": {"noNestedLoops": true, "maxVariables": 3}
+}`
+
+func TestParseGradeSpec(t *testing.T) {
+	spec, err := ParseGradeSpec(strings.NewReader(gradeSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Tests) != 3 || spec.StepLimit != 1000 || spec.TimeLimit != Duration(10*time.Second) ||
+		!spec.Restrictions.NoNestedLoops || spec.Restrictions.MaxVariables != 3 {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+
+	if _, err := ParseGradeSpec(strings.NewReader(`{"tests": []}`)); err == nil {
+		t.Fatal("expected error for spec without limits")
+	}
+}
+
+func TestGrade(t *testing.T) {
+	type TestCase struct {
+		input    string
+		verdict  Verdict
+		passed   int
+		verdicts []Verdict
+	}
+
+	pass, wrong, steps := VERDICT_PASS, VERDICT_WRONG_ANSWER, VERDICT_STEP_LIMIT
+	tests := map[string]TestCase{
+		"Correct":     {addProg, pass, 3, []Verdict{pass, pass, pass}},
+		"Parse error": {"x1 := x1 +", VERDICT_PARSE_ERROR, 0, nil},
+		"Nested":      {mulProg, VERDICT_RESTRICTED, 0, nil},
+		"Wrong answer": {"WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END", wrong, 1,
+			[]Verdict{wrong, pass, wrong}},
+		"Step limit": {"x1 := x1 + 1; " + addProg + "; x1 := x1 + 1; WHILE x1 != 0 DO x0 := x0 + 1 END",
+			steps, 0, []Verdict{steps, steps, steps}},
+	}
+
+	spec, err := ParseGradeSpec(strings.NewReader(gradeSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for caseName, testCase := range tests {
+		r := Grade(caseName, strings.NewReader(testCase.input), spec)
+		if r.Verdict != testCase.verdict || r.Passed != testCase.passed {
+			t.Errorf("%s: expected %s with %d passed, got %s with %d passed: %v",
+				caseName, testCase.verdict, testCase.passed, r.Verdict, r.Passed, r.Errors)
+		}
+		if len(r.Tests) != len(testCase.verdicts) {
+			t.Errorf("%s: expected %d test results, got %d", caseName, len(testCase.verdicts), len(r.Tests))
+			continue
+		}
+		for i, test := range r.Tests {
+			if test.Verdict != testCase.verdicts[i] {
+				t.Errorf("%s: test %d: expected %s, got %s", caseName, i, testCase.verdicts[i], test.Verdict)
+			}
+		}
+	}
+}
+
+func TestRestrictions(t *testing.T) {
+	prog := mustParse(t, mulProg)
+	type TestCase struct {
+		restrictions Restrictions
+		violations   int
+	}
+
+	tests := map[string]TestCase{
+		"None":            {Restrictions{}, 0},
+		"No nested loops": {Restrictions{NoNestedLoops: true}, 2},
+		"Variables":       {Restrictions{MaxVariables: 3}, 1},
+		"Enough vars":     {Restrictions{MaxVariables: 4}, 0},
+		"Loops":           {Restrictions{MaxLoops: 2}, 1},
+	}
+
+	for caseName, testCase := range tests {
+		if errs := testCase.restrictions.Check(prog); len(errs) != testCase.violations {
+			t.Errorf("%s: expected %d violations, got %v", caseName, testCase.violations, errs)
+		}
+	}
+}
+
+func TestRestrictionsLoop(t *testing.T) {
+	prog := mustParseLoop(t, "LOOP x1 DO LOOP x2 DO LOOP x7 DO x8 := x8 + 1 END; x0 := x0 + 1 END END")
+	r := Restrictions{NoNestedLoops: true, MaxVariables: 2, MaxLoops: 1}
+	// Two nested loops, too many variables and too many loops.
+	if errs := r.Check(prog); len(errs) != 4 {
+		t.Errorf("expected 4 violations, got %v", errs)
+	}
+
+	prog = mustParseSugar(t, "IF x1 = 0 THEN x0 := 1 END")
+	if errs := (Restrictions{}).Check(prog); len(errs) != 1 {
+		t.Errorf("expected an error for the conditional, got %v", errs)
+	}
+	if errs := (Restrictions{}).Check(mustDesugar(t, prog)); len(errs) != 0 {
+		t.Errorf("expected no errors for the desugared program, got %v", errs)
+	}
+}
+
+func TestGradeTimeLimit(t *testing.T) {
+	spec := &GradeSpec{Tests: []TestCase{{Expected: 0}}, TimeLimit: Duration(10 * time.Millisecond)}
+	r := Grade("loop", strings.NewReader(loopProg), spec)
+	if r.Verdict != VERDICT_TIME_LIMIT {
+		t.Fatalf("expected time limit, got %s", r.Verdict)
+	}
+}
+
+func TestGradeCrash(t *testing.T) {
+	spec := &GradeSpec{Tests: []TestCase{{Expected: 0}}, StepLimit: 100}
+	// A while expression without its parts makes the interpreter panic.
+	r := GradeProgram("broken", &Expr{Type: WHILE_EXPR}, spec)
+	if r.Verdict != VERDICT_CRASH || len(r.Errors) != 1 || r.Passed != 0 {
+		t.Fatalf("expected crash, got %+v", r)
+	}
+}
+
+func TestGradeOutput(t *testing.T) {
+	spec, err := ParseGradeSpec(strings.NewReader(gradeSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []GradeResult{
+		Grade("a.while", strings.NewReader("WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END"), spec),
+		Grade("b.while", strings.NewReader("x1 :="), spec),
+	}
+
+	data, err := json.Marshal(results[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"submission":"b.while","verdict":"parse error","errors":["1:6: expected variable, got end of file"],"passed":0}`
+	if string(data) != expected {
+		t.Errorf("expected JSON\n%s\ngot\n%s", expected, data)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<testsuite name="a.while" tests="3" failures="2" errors="0">`,
+		`<failure message="wrong answer">wrong answer after 13 steps</failure>`,
+		`<testsuite name="b.while" tests="1" failures="0" errors="1">`,
+		`<error message="parse error">1:6: expected variable, got end of file</error>`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in JUnit report\n%s", s, buf.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "fmt"
+
+// undo contains everything needed to revert a single step.
+// Since a step changes at most one variable and only the top of the stack,
+// this is much smaller than a copy of the whole state.
+type undo struct {
+	// variable is the number of the changed variable or -1 if none changed.
+	variable int
+	// value is the value of the variable before the step.
+	value uint64
+	// base is the lowest stack height during the step. Everything below
+	// it was left untouched.
+	base int
+	// popped contains the expressions above base before the step,
+	// starting with the top of the stack.
+	popped []*Expr
+}
+
+// snapshot is a full copy of the state of an interpreter.
+type snapshot struct {
+	steps int
+	vars  []uint64
+	stack []*Expr
+}
+
+// history records the execution of an interpreter, so it can be run
+// backwards.
+//
+// Every snapshotEvery steps a snapshot is taken and the undo log is
+// restarted. The undo log therefore always covers the steps since the
+// latest snapshot, which bounds both its size and the number of steps that
+// have to be replayed to reach any earlier step.
+type history struct {
+	snapshotEvery int
+	snapshots     []snapshot
+	undos         []undo
+}
+
+// Record enables recording of the execution from now on. Afterwards
+// StepBack and Goto can be used to travel back to any recorded step.
+// Every snapshotEvery steps a full snapshot of the state is taken.
+func (in *Interpreter) Record(snapshotEvery int) {
+	if snapshotEvery < 1 {
+		snapshotEvery = 1
+	}
+	in.history = &history{snapshotEvery: snapshotEvery}
+	in.history.snapshots = []snapshot{in.snapshot()}
+}
+
+// snapshot returns a copy of the current state.
+func (in *Interpreter) snapshot() snapshot {
+	stack := make([]*Expr, len(in.stack))
+	copy(stack, in.stack)
+	return snapshot{steps: in.steps, vars: in.Vars(), stack: stack}
+}
+
+// restore resets the state to the snapshot.
+func (in *Interpreter) restore(s snapshot) {
+	in.steps = s.steps
+	in.vars = make([]uint64, len(s.vars))
+	copy(in.vars, s.vars)
+	in.stack = make([]*Expr, len(s.stack))
+	copy(in.stack, s.stack)
+	in.history.undos = in.history.undos[:0]
+}
+
+// start returns the first step that was recorded.
+func (h *history) start() int { return h.snapshots[0].steps }
+
+// record adds the undo entry of the step that was just executed and takes a
+// snapshot if necessary.
+func (h *history) record(in *Interpreter) {
+	i := (in.steps - h.start()) / h.snapshotEvery
+	if (in.steps-h.start())%h.snapshotEvery != 0 {
+		h.undos = append(h.undos, in.undo)
+		return
+	}
+
+	// Snapshots stay valid when going back in time, since execution is
+	// deterministic. So a snapshot only has to be taken the first time.
+	if i == len(h.snapshots) {
+		h.snapshots = append(h.snapshots, in.snapshot())
+	}
+	h.undos = h.undos[:0]
+}
+
+// StepBack reverts the last step.
+// It returns false if recording is disabled or there is no step to revert.
+func (in *Interpreter) StepBack() bool {
+	h := in.history
+	if h == nil || in.steps == h.start() {
+		return false
+	}
+
+	// At a snapshot the undo log is empty, so it has to be rebuilt by
+	// replaying from the previous snapshot.
+	if len(h.undos) == 0 {
+		target := in.steps - 1
+		in.restore(h.snapshots[(target-h.start())/h.snapshotEvery])
+		for in.steps < target {
+			in.Step()
+		}
+		return true
+	}
+
+	u := h.undos[len(h.undos)-1]
+	h.undos = h.undos[:len(h.undos)-1]
+	in.stack = in.stack[:u.base]
+	for i := len(u.popped) - 1; i >= 0; i-- {
+		in.push(u.popped[i])
+	}
+	if u.variable >= 0 {
+		in.setVar(u.variable, u.value)
+	}
+	in.steps--
+	return true
+}
+
+// Goto moves the execution forwards or backwards to the given step.
+// Going backwards requires recording to be enabled.
+func (in *Interpreter) Goto(step int) error {
+	h := in.history
+	if step < in.steps {
+		if h == nil {
+			return fmt.Errorf("can not go back to step %d without recording", step)
+		}
+		if step < h.start() {
+			return fmt.Errorf("step %d is before the recording started at step %d",
+				step, h.start())
+		}
+
+		// Use the undo log if it reaches back far enough, otherwise
+		// start from the latest snapshot before the step.
+		if in.steps-len(h.undos) > step {
+			in.restore(h.snapshots[(step-h.start())/h.snapshotEvery])
+		} else {
+			for in.steps > step {
+				in.StepBack()
+			}
+		}
+	}
+
+	for in.steps < step {
+		if !in.Step() {
+			return fmt.Errorf("program halted after %d steps", in.steps)
+		}
+	}
+	return nil
+}
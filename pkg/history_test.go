@@ -0,0 +1,115 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"reflect"
+	"testing"
+)
+
+// state is the observable state of an interpreter at some step.
+type state struct {
+	vars []uint64
+	next *Expr
+}
+
+func stateOf(in *Interpreter) state {
+	vars := in.Vars()
+	// Trailing zeros are not part of the observable state.
+	for len(vars) > 0 && vars[len(vars)-1] == 0 {
+		vars = vars[:len(vars)-1]
+	}
+	return state{vars, in.Next()}
+}
+
+// recordStates runs the program and returns the state after every step.
+func recordStates(t *testing.T, input string, args ...uint64) []state {
+	in := NewInterpreter(mustParse(t, input), args...)
+	states := []state{stateOf(in)}
+	for in.Step() {
+		states = append(states, stateOf(in))
+	}
+	return states
+}
+
+func TestStepBack(t *testing.T) {
+	for _, every := range []int{1, 3, 7, 1000} {
+		prog := mustParse(t, mulProg)
+		states := recordStates(t, mulProg, 3, 4)
+
+		in := NewInterpreter(prog, 3, 4)
+		in.Record(every)
+		if err := in.Run(0); err != nil {
+			t.Fatal(err)
+		}
+		for i := len(states) - 1; i >= 0; i-- {
+			if in.Steps() != i {
+				t.Fatalf("every %d: expected step %d, got %d", every, i, in.Steps())
+			}
+			if got := stateOf(in); !reflect.DeepEqual(got, states[i]) {
+				t.Fatalf("every %d: step %d: expected %v, got %v", every, i, states[i], got)
+			}
+			if !in.StepBack() && i != 0 {
+				t.Fatalf("every %d: could not step back from step %d", every, i)
+			}
+		}
+		if in.StepBack() {
+			t.Fatalf("every %d: stepped back before the start", every)
+		}
+
+		// Execution after going back has to be the same again.
+		if err := in.Run(0); err != nil || in.Var(0) != 12 {
+			t.Fatalf("every %d: expected 12 after rerun, got %d, %v", every, in.Var(0), err)
+		}
+	}
+}
+
+func TestGoto(t *testing.T) {
+	states := recordStates(t, mulProg, 3, 4)
+	in := NewInterpreter(mustParse(t, mulProg), 3, 4)
+	in.Record(5)
+
+	for _, step := range []int{10, 3, 40, 39, 0, len(states) - 1, 21, 22, 20, 1} {
+		if err := in.Goto(step); err != nil {
+			t.Fatalf("goto %d: %s", step, err)
+		}
+		if got := stateOf(in); in.Steps() != step || !reflect.DeepEqual(got, states[step]) {
+			t.Fatalf("goto %d: expected %v, got %v at step %d", step, states[step], got, in.Steps())
+		}
+	}
+
+	if err := in.Goto(len(states)); err == nil {
+		t.Fatalf("expected error going past the end of the program")
+	}
+}
+
+func TestGotoWithoutRecording(t *testing.T) {
+	in := NewInterpreter(mustParse(t, addProg), 1, 1)
+	if err := in.Goto(3); err != nil {
+		t.Fatal(err)
+	}
+	if in.StepBack() {
+		t.Fatal("stepped back without recording")
+	}
+	if err := in.Goto(1); err == nil {
+		t.Fatal("expected error going back without recording")
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// ErrStepLimit is returned when a program did not halt within the given
+// number of steps.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// Tracer is notified by an interpreter after every step.
+type Tracer interface {
+	// Step is called with the executed increment or while expression.
+	// For while expressions cond is the value of the condition, so it is
+	// true if the body is executed next.
+	Step(e *Expr, cond bool)
+}
+
+// Interpreter executes a WHILE or LOOP program one step at a time.
+//
+// A step is either the execution of an increment expression or the check of
+// the condition of a while expression. Sequences do not take any steps.
+// LOOP expressions take a step for reading the number of iterations and after
+// every iteration, just like a while expression counting down a variable.
+type Interpreter struct {
+	vars []uint64
+	// regs are the numbers of the variables in vars if the program uses a
+	// variable above denseVariables. Otherwise it is nil and vars is
+	// indexed by the numbers of the variables.
+	regs  []int
+	steps int
+
+	// stack contains the expressions left to execute, the top is executed next.
+	// It only ever has increment, while or LOOP expressions on top.
+	stack []*Expr
+
+	// history records the undo log for reverse execution, see history.go.
+	history *history
+	// undo is the undo entry of the currently executing step.
+	undo undo
+
+	tracer Tracer
+}
+
+// denseVariables is the largest variable number up to which the variables
+// are kept in a slice indexed by their numbers. Programs with larger numbers
+// only keep the variables they use, so they can not exhaust the memory.
+const denseVariables = 1 << 16
+
+// NewInterpreter creates an interpreter for prog with the input variables
+// x1, x2, ... set to the given input. All other variables start with 0.
+func NewInterpreter(prog *Expr, input ...uint64) *Interpreter {
+	in := &Interpreter{vars: make([]uint64, len(input)+1)}
+	if maxVariable(prog) > denseVariables {
+		in.regs = usedVariables(prog, len(input))
+		in.vars = make([]uint64, len(in.regs))
+	}
+	copy(in.vars[1:], input)
+	in.push(prog)
+	in.expandSeq()
+	return in
+}
+
+// Run executes prog with the given input and returns the value of x0.
+// If limit is greater than zero and the program does not halt within limit
+// steps, ErrStepLimit is returned.
+func Run(prog *Expr, limit int, input ...uint64) (uint64, error) {
+	in := NewInterpreter(prog, input...)
+	err := in.Run(limit)
+	return in.Var(0), err
+}
+
+// Run executes the program until it halts or limit steps have been executed
+// in total. A limit of 0 means no limit.
+func (in *Interpreter) Run(limit int) error {
+	for !in.Done() {
+		if limit > 0 && in.steps >= limit {
+			return ErrStepLimit
+		}
+		in.Step()
+	}
+	return nil
+}
+
+// Done reports whether the program has halted.
+func (in *Interpreter) Done() bool { return len(in.stack) == 0 }
+
+// Steps returns the number of steps executed so far.
+func (in *Interpreter) Steps() int { return in.steps }
+
+// Next returns the increment, while or LOOP expression executed by the next
+// step. It returns nil if the program has halted.
+func (in *Interpreter) Next() *Expr {
+	if in.Done() {
+		return nil
+	}
+	e := in.stack[len(in.stack)-1]
+	if e.Type == LOOP_EXPR && e.LoopExpr.loop != nil {
+		return e.LoopExpr.loop
+	}
+	return e
+}
+
+// usedVariables returns the numbers of the variables x0, ..., xk for k
+// inputs and of the variables used by prog in ascending order.
+func usedVariables(prog *Expr, inputs int) []int {
+	used := make(map[int]bool)
+	for v := 0; v <= inputs; v++ {
+		used[v] = true
+	}
+	mapVariables(cloneExpr(prog), func(v int) int {
+		used[v] = true
+		return v
+	})
+	var regs []int
+	for v := range used {
+		regs = append(regs, v)
+	}
+	sort.Ints(regs)
+	return regs
+}
+
+// slot returns the index of the variable xN in vars or -1 if it has not
+// been used yet.
+func (in *Interpreter) slot(n int) int {
+	if in.regs == nil {
+		if n < 0 || n >= len(in.vars) {
+			return -1
+		}
+		return n
+	}
+	if i := sort.SearchInts(in.regs, n); i < len(in.regs) && in.regs[i] == n {
+		return i
+	}
+	return -1
+}
+
+// Var returns the value of the variable xN.
+func (in *Interpreter) Var(n int) uint64 {
+	if i := in.slot(n); i >= 0 {
+		return in.vars[i]
+	}
+	return 0
+}
+
+// setVar sets the variable xN, which is used by the program, to value.
+func (in *Interpreter) setVar(n int, value uint64) {
+	if in.regs != nil {
+		in.vars[in.slot(n)] = value
+		return
+	}
+	if n >= len(in.vars) {
+		vars := make([]uint64, n+1)
+		copy(vars, in.vars)
+		in.vars = vars
+	}
+	in.vars[n] = value
+}
+
+// Vars returns a copy of the values of all variables that have been used so
+// far, in the order of Registers.
+func (in *Interpreter) Vars() []uint64 {
+	vars := make([]uint64, len(in.vars))
+	copy(vars, in.vars)
+	return vars
+}
+
+// Registers returns the numbers of the variables returned by Vars. They
+// are 0, 1, ... unless the program uses very large variable numbers, in
+// which case only the used variables are kept.
+func (in *Interpreter) Registers() []int {
+	if in.regs != nil {
+		return in.regs
+	}
+	regs := make([]int, len(in.vars))
+	for i := range regs {
+		regs[i] = i
+	}
+	return regs
+}
+
+// SetTracer sets the tracer which is notified about every executed step.
+// A nil tracer disables tracing. Note that steps replayed by StepBack and Goto
+// are traced again.
+func (in *Interpreter) SetTracer(t Tracer) { in.tracer = t }
+
+// Step executes the next step of the program.
+// It returns false if the program had already halted.
+func (in *Interpreter) Step() bool {
+	if in.Done() {
+		return false
+	}
+	if in.history != nil {
+		in.undo = undo{variable: -1, base: len(in.stack)}
+	}
+
+	e := in.pop()
+	cond := false
+	switch e.Type {
+	case INCR_EXPR:
+		in.execIncr(e.IncrExpr)
+	case WHILE_EXPR:
+		// The loop is executed by putting the body and the loop itself
+		// back on the stack, so the condition is checked again afterwards.
+		cond = in.Var(e.WhileExpr.Variable) != 0
+		if cond {
+			in.push(e)
+			in.push(e.WhileExpr.P)
+		}
+	case LOOP_EXPR:
+		e, cond = in.execLoop(e)
+	}
+	in.expandSeq()
+	in.steps++
+
+	if in.tracer != nil {
+		in.tracer.Step(e, cond)
+	}
+	if in.history != nil {
+		in.history.record(in)
+	}
+	return true
+}
+
+// execIncr executes `xN := xM +/- c`, which increments or decrements a
+// variable in the minimal form. Subtraction stops at 0 and addition stops at
+// the largest value of a variable instead of wrapping around.
+func (in *Interpreter) execIncr(e *IncrExpr) {
+	old := in.Var(e.Variable)
+	src, c := e.operands()
+	value := in.Var(src)
+	switch {
+	case !e.Decrement && value > math.MaxUint64-c:
+		value = math.MaxUint64
+	case !e.Decrement:
+		value += c
+	case value < c:
+		value = 0
+	default:
+		value -= c
+	}
+	if value == old {
+		return
+	}
+	if in.history != nil {
+		in.undo.variable, in.undo.value = e.Variable, old
+	}
+	in.setVar(e.Variable, value)
+}
+
+// execLoop enters or continues a LOOP expression. The remaining iterations are
+// kept in a new expression on the stack, which is never modified, so it can be
+// restored by the history. It returns the LOOP expression of the program and
+// whether the body is executed next.
+func (in *Interpreter) execLoop(e *Expr) (*Expr, bool) {
+	l := *e.LoopExpr
+	if l.loop == nil {
+		l.loop, l.remaining = e, in.Var(l.Variable)
+	}
+	if l.remaining == 0 {
+		return l.loop, false
+	}
+	l.remaining--
+	in.push(&Expr{Type: LOOP_EXPR, Pos: e.Pos, End: e.End, LoopExpr: &l})
+	in.push(l.P)
+	return l.loop, true
+}
+
+// expandSeq replaces sequences on top of the stack with their parts until an
+// increment or while expression is on top.
+func (in *Interpreter) expandSeq() {
+	for !in.Done() && in.Next().Type == SEQ_EXPR {
+		seq := in.pop().SeqExpr
+		in.push(seq.P2)
+		in.push(seq.P1)
+	}
+}
+
+// push puts e on top of the stack.
+func (in *Interpreter) push(e *Expr) { in.stack = append(in.stack, e) }
+
+// pop removes the top of the stack and returns it.
+// Expressions that were on the stack before the current step are remembered
+// in the undo entry, so the step can be reverted.
+func (in *Interpreter) pop() *Expr {
+	n := len(in.stack) - 1
+	e := in.stack[n]
+	in.stack = in.stack[:n]
+	if in.history != nil && n < in.undo.base {
+		in.undo.base = n
+		in.undo.popped = append(in.undo.popped, e)
+	}
+	return e
+}
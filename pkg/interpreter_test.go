@@ -0,0 +1,188 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Some programs used by several tests.
+const (
+	// addProg computes x0 = x1 + x2.
+	addProg = `WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END;
+WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 1 END`
+	// mulProg computes x0 = x1 * x2 using x3 as temporary variable.
+	mulProg = `WHILE x1 != 0 DO
+  x1 := x1 - 1;
+  WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 1; x3 := x3 + 1 END;
+  WHILE x3 != 0 DO x3 := x3 - 1; x2 := x2 + 1 END
+END`
+	// loopProg never halts.
+	loopProg = "x1 := x1 + 1; WHILE x1 != 0 DO x2 := x2 + 1 END"
+)
+
+func mustParse(t testing.TB, input string) *Expr {
+	expr, err := NewParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		t.Fatalf("error parsing %q: %s", input, err)
+	}
+	return expr
+}
+
+func TestRun(t *testing.T) {
+	type TestCase struct {
+		input    string
+		args     []uint64
+		expected uint64
+		steps    int
+	}
+
+	tests := map[string]TestCase{
+		"Increment":         {"x0 := x0 + 1", nil, 1, 1},
+		"Decrement zero":    {"x0 := x0 - 1", nil, 0, 1},
+		"Decrement":         {"x0 := x0 + 1; x0 := x0 + 1; x0 := x0 - 1", nil, 1, 3},
+		"Unused input":      {"x0 := x0 + 1", []uint64{5, 6}, 1, 1},
+		"Loop not entered":  {"WHILE x1 != 0 DO x0 := x0 + 1 END", nil, 0, 1},
+		"Add 0+0":           {addProg, []uint64{0, 0}, 0, 2},
+		"Add 2+3":           {addProg, []uint64{2, 3}, 5, 17},
+		"Mul 3*4":           {mulProg, []uint64{3, 4}, 12, 0},
+		"Mul 0*4":           {mulProg, []uint64{0, 4}, 0, 1},
+		"Large variable":    {"x100 := x100 + 1; WHILE x100 != 0 DO x100 := x100 - 1; x0 := x0 + 1 END", nil, 1, 5},
+		"Mul without input": {mulProg, nil, 0, 1},
+	}
+
+	for caseName, testCase := range tests {
+		in := NewInterpreter(mustParse(t, testCase.input), testCase.args...)
+		if err := in.Run(0); err != nil {
+			t.Errorf("%s: %s", caseName, err)
+		}
+		if in.Var(0) != testCase.expected {
+			t.Errorf("%s: expected x0 = %d, got %d", caseName, testCase.expected, in.Var(0))
+		}
+		if testCase.steps != 0 && in.Steps() != testCase.steps {
+			t.Errorf("%s: expected %d steps, got %d", caseName, testCase.steps, in.Steps())
+		}
+	}
+}
+
+func TestRunGeneralIncr(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		args     []uint64
+		expected uint64
+	}{
+		"Copy":             {"x0 := x1 + 0", []uint64{7}, 7},
+		"Add constant":     {"x0 := x1 + 40", []uint64{2}, 42},
+		"Subtract":         {"x0 := x1 - 3", []uint64{10}, 7},
+		"Subtract to zero": {"x0 := x1 - 30", []uint64{10}, 0},
+		"Same variable":    {"x1 := x1 + 5; x0 := x1 - 2", []uint64{1}, 4},
+		"Overwrite":        {"x0 := x0 + 9; x0 := x2 + 1", []uint64{5, 0}, 1},
+		"Large constant":   {"x0 := x0 + 18446744073709551615", nil, 18446744073709551615},
+		"Saturate":         {"x0 := x1 + 18446744073709551615", []uint64{1}, 18446744073709551615},
+		"Saturate minimal": {"x1 := x1 + 1; x0 := x1 - 1", []uint64{18446744073709551615}, 18446744073709551614},
+		"Loop": {"x2 := x1 + 0; WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 3 END",
+			[]uint64{4}, 12},
+	}
+
+	for caseName, testCase := range tests {
+		prog, err := NewParser(strings.NewReader(testCase.input), SchoeningDialect).Parse()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		in := NewInterpreter(prog, testCase.args...)
+		if err = in.Run(0); err != nil {
+			t.Errorf("%s: %s", caseName, err)
+		}
+		if in.Var(0) != testCase.expected {
+			t.Errorf("%s: expected x0 = %d, got %d", caseName, testCase.expected, in.Var(0))
+		}
+	}
+
+	// Every increment expression is a single step.
+	prog, err := NewParser(strings.NewReader("x0 := x1 + 100; x1 := x0 - 50"), SchoeningDialect).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := NewInterpreter(prog)
+	if in.Run(0); in.Steps() != 2 || in.Var(1) != 50 {
+		t.Errorf("expected 2 steps and x1 = 50, got %d steps and x1 = %d", in.Steps(), in.Var(1))
+	}
+}
+
+func TestRunStepLimit(t *testing.T) {
+	_, err := Run(mustParse(t, loopProg), 1000)
+	if err != ErrStepLimit {
+		t.Fatalf("expected %s, got %v", ErrStepLimit, err)
+	}
+
+	// A program halting exactly at the limit is fine.
+	x0, err := Run(mustParse(t, addProg), 17, 2, 3)
+	if err != nil || x0 != 5 {
+		t.Fatalf("expected 5, got %d, %v", x0, err)
+	}
+}
+
+func TestRunLargeVariables(t *testing.T) {
+	prog := mustParse(t, `x900000000000 := x900000000000 + 1;
+WHILE x900000000000 != 0 DO
+  x900000000000 := x900000000000 - 1;
+  x9000000000000000000 := x9000000000000000000 + 1;
+  x0 := x0 + 1
+END;
+x0 := x0 + 1`)
+	in := NewInterpreter(prog, 5)
+	trace := NewTraceTail(in, 1)
+	in.Record(2)
+	if err := in.Run(0); err != nil || in.Var(0) != 2 || in.Var(9000000000000000000) != 1 {
+		t.Fatalf("expected x0 = 2, got %d, %v", in.Var(0), err)
+	}
+	regs, vars := in.Registers(), in.Vars()
+	if fmt.Sprint(regs) != "[0 1 900000000000 9000000000000000000]" || fmt.Sprint(vars) != "[2 5 0 1]" {
+		t.Errorf("unexpected variables %v = %v", regs, vars)
+	}
+	if expected := "step 7 at 7:1: x0 := x0 + 1 [x0=2 x1=5 x900000000000=0 x9000000000000000000=1]"; trace.Entries()[0].String() != expected {
+		t.Errorf("expected %q, got %q", expected, trace.Entries()[0])
+	}
+	for in.StepBack() {
+	}
+	if in.Var(0) != 0 || in.Var(900000000000) != 0 || in.Var(9000000000000000000) != 0 {
+		t.Errorf("expected the initial state, got %v", in.Vars())
+	}
+}
+
+func TestNext(t *testing.T) {
+	prog := mustParse(t, "x1 := x1 + 1; WHILE x1 != 0 DO x1 := x1 - 1 END")
+	in := NewInterpreter(prog)
+
+	expected := []ExprType{INCR_EXPR, WHILE_EXPR, INCR_EXPR, WHILE_EXPR}
+	for i, exprType := range expected {
+		if next := in.Next(); next == nil || next.Type != exprType {
+			t.Fatalf("step %d: expected %d, got %v", i, exprType, next)
+		}
+		in.Step()
+	}
+	if !in.Done() || in.Next() != nil || in.Step() {
+		t.Fatalf("expected program to halt after %d steps", len(expected))
+	}
+}
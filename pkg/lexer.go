@@ -25,6 +25,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 )
 
 // The following line enables go generate together with the tool
@@ -50,17 +51,41 @@ const (
 	// VARIABLE represents the name of a variable like x0, x1, x2, ...
 	VARIABLE
 
-	// CONSTANT is a numerical constant that is either 0 or 1
+	// CONSTANT is a natural number like 0, 1 or 42. The core language only
+	// allows 0 and 1, which is checked by the parser.
 	CONSTANT
 
+	// LABEL represents the label of a GOTO instruction like M1, M2, ...
+	LABEL
+
+	// NAME represents the name of a named variable like sum or counter.
+	NAME
+
+	// IDENT represents the name of a procedure like ADD or MUL_2. It is only
+	// scanned in modules, see ParseModule.
+	IDENT
+
+	// STRING represents a string in double quotes like "lib.while".
+	STRING
+
 	// Symbols
 
 	// SEMICOLON represents a ;
 	SEMICOLON
 	// ASSIGN is represented by :=
 	ASSIGN
+	// COLON is represented by :
+	COLON
+	// COMMA is represented by ,
+	COMMA
+	// LPAREN is represented by (
+	LPAREN
+	// RPAREN is represented by )
+	RPAREN
 	// NOTEQUAL is represented by !=
 	NOTEQUAL
+	// EQUAL is represented by =
+	EQUAL
 
 	// Operators
 
@@ -70,6 +95,9 @@ const (
 	// MINUS is represented by -
 	MINUS
 
+	// TIMES is represented by *
+	TIMES
+
 	// Keywords
 
 	// WHILE is the keyword represented by the string "WHILE"
@@ -80,8 +108,66 @@ const (
 
 	// END is the keyword represented by the string "END"
 	END
+
+	// OD is the keyword represented by the string "OD", which ends loops in
+	// some dialects
+	OD
+
+	// IF is the keyword represented by the string "IF"
+	IF
+
+	// THEN is the keyword represented by the string "THEN"
+	THEN
+
+	// ELSE is the keyword represented by the string "ELSE"
+	ELSE
+
+	// LOOP is the keyword represented by the string "LOOP"
+	LOOP
+
+	// GOTO is the keyword represented by the string "GOTO"
+	GOTO
+
+	// HALT is the keyword represented by the string "HALT"
+	HALT
+
+	// INPUT is the keyword represented by the string "INPUT"
+	INPUT
+
+	// OUTPUT is the keyword represented by the string "OUTPUT"
+	OUTPUT
+
+	// PROC is the keyword represented by the string "PROC"
+	PROC
+
+	// BEGIN is the keyword represented by the string "BEGIN"
+	BEGIN
+
+	// IMPORT is the keyword represented by the string "IMPORT"
+	IMPORT
 )
 
+// keywords maps the keywords to their tokens.
+var keywords = map[string]Token{
+	"WHILE": WHILE,
+	"DO":    DO,
+	"END":   END,
+	"OD":    OD,
+	"IF":    IF,
+	"THEN":  THEN,
+	"ELSE":  ELSE,
+	"LOOP":  LOOP,
+	"GOTO":  GOTO,
+	"HALT":  HALT,
+
+	"INPUT":  INPUT,
+	"OUTPUT": OUTPUT,
+
+	"PROC":   PROC,
+	"BEGIN":  BEGIN,
+	"IMPORT": IMPORT,
+}
+
 func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n'
 }
@@ -90,34 +176,90 @@ func isDigit(ch rune) bool {
 	return (ch >= '0' && ch <= '9')
 }
 
+func isUpper(ch rune) bool {
+	return ch >= 'A' && ch <= 'Z'
+}
+
+func isLower(ch rune) bool {
+	return ch >= 'a' && ch <= 'z'
+}
+
 var eof = rune(0)
 
+// Pos is a position in the source code. Lines and columns start at 1.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+// String returns the position in the form line:column.
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 // Scanner is the lexical scanner for the WHILE language.
 type Scanner struct {
 	r *bufio.Reader
+	d Dialect
+	// idents enables the names of procedures.
+	idents bool
+
+	pos    Pos // position of the next rune
+	prev   Pos // position before the last read rune, used by unread
+	tokPos Pos // start position of the last scanned token
 }
 
-// NewScanner creates and returns a new instance of a WHILE scanner.
-func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+// NewScanner creates and returns a new instance of a WHILE scanner. An
+// optional dialect enables additional notations, by default the scanner
+// accepts the notation of the core language only.
+func NewScanner(r io.Reader, dialect ...Dialect) *Scanner {
+	return &Scanner{r: bufio.NewReader(r), d: firstDialect(dialect), pos: Pos{Line: 1, Column: 1}}
 }
 
+// Pos returns the start position of the last scanned token.
+func (s *Scanner) Pos() Pos { return s.tokPos }
+
+// End returns the position right after the last scanned token.
+func (s *Scanner) End() Pos { return s.pos }
+
 // read reads the next rune from the buffered reader.
 func (s *Scanner) read() (rune, error) {
 	ch, _, err := s.r.ReadRune() // _ ignores the rune size
 	if err != nil {
 		return eof, err
 	}
+
+	// Keep track of the position for error messages and breakpoints.
+	s.prev = s.pos
+	if ch == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return ch, nil
 }
 
 // unread places the previously read rune back on the reader.
-func (s *Scanner) unread() error { return s.r.UnreadRune() }
+func (s *Scanner) unread() error {
+	s.pos = s.prev
+	return s.r.UnreadRune()
+}
 
 // Scan returns the next token and literal value.
 // If an error occurs during reading it returns an error.
 func (s *Scanner) Scan() (tok Token, lit string, err error) {
+	s.tokPos = s.pos
 	ch, err := s.read()
+	if err == io.EOF {
+		return EOF, "", nil
+	}
 	if err != nil {
 		return scanError(fmt.Errorf("error reading next character: %s", err))
 	}
@@ -131,37 +273,180 @@ func (s *Scanner) Scan() (tok Token, lit string, err error) {
 		return s.scanWhitespace()
 	}
 
+	if isLower(ch) && s.d.Names {
+		return s.scanName(ch)
+	}
+
 	// Scan single character tokens
 	switch ch {
 	case eof:
 		return EOF, "", nil
 	case 'x':
 		return s.scanVariable()
-	case '0':
-		return CONSTANT, string(ch), nil
-	case '1':
-		return CONSTANT, string(ch), nil
 	case ':':
-		return s.scanString(ASSIGN, ":=")
+		return s.scanColon()
 	case '!':
 		return s.scanString(NOTEQUAL, "!=")
 	case ';':
 		return SEMICOLON, string(ch), nil
+	case ',':
+		return COMMA, string(ch), nil
+	case '(':
+		return LPAREN, string(ch), nil
+	case ')':
+		return RPAREN, string(ch), nil
+	case '"':
+		return s.scanQuoted()
 	case '+':
 		return PLUS, string(ch), nil
 	case '-':
 		return MINUS, string(ch), nil
-	case 'W':
-		return s.scanString(WHILE, "WHILE")
-	case 'D':
-		return s.scanString(DO, "DO")
-	case 'E':
-		return s.scanString(END, "END")
+	case '*':
+		return TIMES, string(ch), nil
+	case '=':
+		return EQUAL, string(ch), nil
+	case '≠':
+		if s.d.Unicode {
+			return NOTEQUAL, string(ch), nil
+		}
+	}
+	if isDigit(ch) {
+		return s.scanWhile(CONSTANT, ch, isDigit)
+	}
+	if isUpper(ch) {
+		tok, lit, err := s.scanWhile(ILLEGAL, ch, func(ch rune) bool {
+			return isUpper(ch) || isDigit(ch) || ch == '_' && s.idents
+		})
+		if kw, ok := keywords[lit]; ok {
+			tok = kw
+		} else if isLabel(lit) {
+			tok = LABEL
+		} else if s.idents {
+			tok = IDENT
+		}
+		return tok, lit, err
+	}
+	if isLower(ch) && s.d.Lowercase {
+		tok, lit, err := s.scanWhile(ILLEGAL, ch, isLower)
+		if kw, ok := keywords[strings.ToUpper(lit)]; ok {
+			tok = kw
+		}
+		return tok, lit, err
 	}
 
 	return ILLEGAL, string(ch), nil
 }
 
+// scanColon scans := or a single colon after the already read colon.
+func (s *Scanner) scanColon() (Token, string, error) {
+	ch, err := s.read()
+	if err == io.EOF {
+		return COLON, ":", nil
+	}
+	if err != nil {
+		return scanError(fmt.Errorf("error reading next character: %s", err))
+	}
+	if ch == '=' {
+		return ASSIGN, ":=", nil
+	}
+	if err = s.unread(); err != nil {
+		return scanError(fmt.Errorf("error unreading character: %s", err))
+	}
+	return COLON, ":", nil
+}
+
+// scanQuoted scans a string after the already read double quote. The string
+// ends at the next double quote and must not contain newlines.
+func (s *Scanner) scanQuoted() (Token, string, error) {
+	var buf bytes.Buffer
+	for {
+		ch, err := s.read()
+		if err == io.EOF || ch == '\n' {
+			return ILLEGAL, "\"" + buf.String(), nil
+		}
+		if err != nil {
+			return scanError(fmt.Errorf("error reading string: %s", err))
+		}
+		if ch == '"' {
+			return STRING, buf.String(), nil
+		}
+		buf.WriteRune(ch)
+	}
+}
+
+// scanName scans an identifier starting with the already read lower case
+// letter ch. It is a keyword if the dialect allows lower case keywords, a
+// variable if it has the form of one and a name otherwise.
+func (s *Scanner) scanName(ch rune) (Token, string, error) {
+	tok, lit, err := s.scanWhile(NAME, ch, func(ch rune) bool {
+		return isLower(ch) || isUpper(ch) || isDigit(ch) || ch == '_'
+	})
+	if kw, ok := keywords[strings.ToUpper(lit)]; ok && s.d.Lowercase {
+		tok = kw
+	} else if isVariable(lit, s.d.Subscripts) {
+		tok = VARIABLE
+	}
+	return tok, lit, err
+}
+
+// isVariable reports whether lit is a variable, which is x followed by
+// digits, or by an underscore and digits if subscripts are allowed.
+func isVariable(lit string, subscripts bool) bool {
+	if !strings.HasPrefix(lit, "x") {
+		return false
+	}
+	digits := lit[1:]
+	if subscripts {
+		digits = strings.TrimPrefix(digits, "_")
+	}
+	if digits == "" {
+		return false
+	}
+	for _, ch := range digits {
+		if !isDigit(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLabel reports whether lit is a label, which is M followed by digits.
+func isLabel(lit string) bool {
+	if len(lit) < 2 || lit[0] != 'M' {
+		return false
+	}
+	for _, ch := range lit[1:] {
+		if !isDigit(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanWhile reads the runes following the already read rune ch as long as
+// they satisfy valid and returns them as token tok.
+func (s *Scanner) scanWhile(tok Token, ch rune, valid func(rune) bool) (Token, string, error) {
+	var buf bytes.Buffer
+	buf.WriteRune(ch)
+	for {
+		ch, err := s.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return scanError(fmt.Errorf("error reading next character: %s", err))
+		}
+		if !valid(ch) {
+			if err = s.unread(); err != nil {
+				return scanError(fmt.Errorf("error unreading character: %s", err))
+			}
+			break
+		}
+		buf.WriteRune(ch)
+	}
+	return tok, buf.String(), nil
+}
+
 // scanWhitespace consumes the current rune and all following whitespace.
 func (s *Scanner) scanWhitespace() (tok Token, lit string, err error) {
 	// Create buffer and read current character into it.
@@ -199,7 +484,7 @@ func (s *Scanner) scanWhitespace() (tok Token, lit string, err error) {
 }
 
 // scanVariable unreads the last character and reads in a variable name
-// in the form of x0, x1, ...
+// in the form of x0, x1, ... or x_0, x_1, ... if the dialect allows it.
 func (s *Scanner) scanVariable() (tok Token, lit string, err error) {
 	err = s.unread()
 	if err != nil {
@@ -218,6 +503,22 @@ func (s *Scanner) scanVariable() (tok Token, lit string, err error) {
 	}
 	buf.WriteRune(ch)
 
+	// Read the underscore of a subscript.
+	if s.d.Subscripts {
+		ch, err = s.read()
+		if err == io.EOF {
+			return VARIABLE, buf.String(), nil
+		}
+		if err != nil {
+			return scanError(fmt.Errorf("error tokenizing variable: %s", err))
+		}
+		if ch == '_' {
+			buf.WriteRune(ch)
+		} else if err = s.unread(); err != nil {
+			return scanError(fmt.Errorf("error tokenizing variable: %s", err))
+		}
+	}
+
 	// Read every following digit until non digit character.
 	for {
 		ch, err = s.read()
@@ -35,6 +35,7 @@ func TestSingleToken(t *testing.T) {
 	tests := map[string]TestCase{
 		// Valid inputs for lexer
 		"EOF":              {input: string(rune(0)), expected: EOF},
+		"Empty input":      {input: "", expected: EOF},
 		"Space( )":         {input: "   ", expected: WS},
 		"Tab(\\t)":         {input: "\t\t", expected: WS},
 		"Newline(\\n)":     {input: "\n\n", expected: WS},
@@ -52,10 +53,26 @@ func TestSingleToken(t *testing.T) {
 		"Keyword WHILE":    {input: "WHILE", expected: WHILE},
 		"Keyword DO":       {input: "DO", expected: DO},
 		"Keyword END":      {input: "END", expected: END},
+		"Constant 42":      {input: "42", expected: CONSTANT, literal: "42"},
+		"Equal =":          {input: "=", expected: EQUAL},
+		"Operator *":       {input: "*", expected: TIMES},
+		"Keyword IF":       {input: "IF", expected: IF},
+		"Keyword THEN":     {input: "THEN", expected: THEN},
+		"Keyword ELSE":     {input: "ELSE", expected: ELSE},
+		"Keyword LOOP":     {input: "LOOP", expected: LOOP},
+		"Colon :":          {input: ":", expected: COLON},
+		"Comma ,":          {input: ",", expected: COMMA},
+		"Keyword INPUT":    {input: "INPUT", expected: INPUT},
+		"Keyword OUTPUT":   {input: "OUTPUT", expected: OUTPUT},
+		"Label M12":        {input: "M12", expected: LABEL, literal: "M12"},
+		"Keyword GOTO":     {input: "GOTO", expected: GOTO},
+		"Keyword HALT":     {input: "HALT", expected: HALT},
+		"Keyword OD":       {input: "OD", expected: OD},
 
 		// Tests for invalid inputs
-		"Invalid Assign":    {input: ":!", expected: ILLEGAL},
+		"Invalid label":     {input: "M1A", expected: ILLEGAL},
 		"Invalid Not Equal": {input: "!!", expected: ILLEGAL},
+		"Unknown keyword":   {input: "WHIL", expected: ILLEGAL},
 		// TODO: Fix variable scanning
 		// "Variable 042": {input: "x042", expected: ILLEGAL},
 	}
@@ -108,3 +125,28 @@ func TestMultipleTokens(t *testing.T) {
 	}
 
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "x1 := x1 + 1;\nWHILE x1"
+	expected := []struct {
+		tok Token
+		pos Pos
+	}{
+		{VARIABLE, Pos{1, 1}}, {WS, Pos{1, 3}}, {ASSIGN, Pos{1, 4}}, {WS, Pos{1, 6}},
+		{VARIABLE, Pos{1, 7}}, {WS, Pos{1, 9}}, {PLUS, Pos{1, 10}}, {WS, Pos{1, 11}},
+		{CONSTANT, Pos{1, 12}}, {SEMICOLON, Pos{1, 13}}, {WS, Pos{1, 14}},
+		{WHILE, Pos{2, 1}}, {WS, Pos{2, 6}}, {VARIABLE, Pos{2, 7}}, {EOF, Pos{2, 9}},
+	}
+
+	scanner := NewScanner(strings.NewReader(input))
+	for i, exp := range expected {
+		tok, _, err := scanner.Scan()
+		if err != nil {
+			t.Fatalf("token %d: %s", i, err)
+		}
+		if tok != exp.tok || scanner.Pos() != exp.pos {
+			t.Fatalf("token %d: expected %s at %s but got %s at %s",
+				i, exp.tok, exp.pos, tok, scanner.Pos())
+		}
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Modules extend programs by procedures and imports:
+//
+//	IMPORT "lib.while"
+//	PROC ADD(x1, x2, x0) BEGIN
+//	  WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END;
+//	  WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 1 END
+//	END
+//	ADD(x1, x2, x3); ADD(x3, x3, x0)
+//
+// A procedure is a program of its own with the parameters as inputs and the
+// last parameter as output. Calls pass the values of the input arguments and
+// assign the result to the last argument, so the procedure can not change
+// any other variable of the caller. Link inlines the calls, which shows that
+// procedures add no computational power. Recursion can not be inlined and is
+// an error.
+//
+// Since the source is expanded by the macro preprocessor before parsing,
+// procedures must not have the names of macros.
+
+// Module is a parsed file with imports, procedures and a main program.
+type Module struct {
+	// Path is the file the module was read from. It is used for error
+	// messages and to identify the module, so it is linked only once.
+	Path    string
+	Imports []Import
+	Procs   []*Proc
+	// Main is the main program or nil for libraries.
+	Main *Expr
+}
+
+// Import is the directive `IMPORT "path"`.
+type Import struct {
+	Path string
+	Pos  Pos
+}
+
+// Proc is the procedure definition `PROC NAME(xA, ..., xR) BEGIN P END`.
+type Proc struct {
+	Name string
+	Pos  Pos
+	// Inputs are the input parameters xA, ...
+	Inputs []int
+	// Output is the output parameter xR.
+	Output int
+	Body   *Expr
+}
+
+// errorf returns an error at the position pos of the module.
+func (m *Module) errorf(pos Pos, format string, a ...interface{}) error {
+	err := &Error{pos, fmt.Sprintf(format, a...)}
+	if m.Path == "" {
+		return err
+	}
+	return fmt.Errorf("%s:%s", m.Path, err)
+}
+
+// location returns pos prefixed with the path of the module.
+func (m *Module) location(pos Pos) string {
+	if m.Path == "" {
+		return pos.String()
+	}
+	return m.Path + ":" + pos.String()
+}
+
+// ParseModule parses a module. The imports have to precede the procedures,
+// which have to precede the main program.
+func (p *Parser) ParseModule() (*Module, error) {
+	if p.names != nil {
+		return nil, &Error{Pos{1, 1}, "modules can not have named variables"}
+	}
+	p.module, p.s.idents = true, true
+
+	m := &Module{}
+	for {
+		tok, _, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, p.errorf("error tokenizing: %s", err)
+		}
+		switch tok {
+		case IMPORT:
+			if len(m.Procs) > 0 {
+				return nil, p.errorf("IMPORT has to precede the procedures")
+			}
+			imp := Import{Pos: p.buf.pos}
+			if imp.Path, err = p.expect(STRING); err != nil {
+				return nil, err
+			}
+			m.Imports = append(m.Imports, imp)
+		case PROC:
+			proc, err := p.parseProc()
+			if err != nil {
+				return nil, err
+			}
+			m.Procs = append(m.Procs, proc)
+		case EOF:
+			return m, nil
+		default:
+			p.unscan()
+			if m.Main, err = p.Parse(); err != nil {
+				return nil, err
+			}
+			return m, nil
+		}
+	}
+}
+
+// parseProc parses a procedure definition after the keyword PROC.
+func (p *Parser) parseProc() (*Proc, error) {
+	proc := &Proc{Pos: p.buf.pos}
+	name, err := p.expect(IDENT)
+	if err != nil {
+		return nil, err
+	}
+	proc.Name = name
+	params, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, p.errorf("procedure %s has no output parameter", name)
+	}
+	seen := make(map[int]bool)
+	for _, v := range params {
+		if seen[v] {
+			return nil, p.errorf("duplicate parameter x%d of procedure %s", v, name)
+		}
+		seen[v] = true
+	}
+	proc.Inputs, proc.Output = params[:len(params)-1], params[len(params)-1]
+
+	if _, err = p.expect(BEGIN); err != nil {
+		return nil, err
+	}
+	if proc.Body, err = p.parseSeq(); err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(END); err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
+
+// parseCall parses the call of a procedure.
+func (p *Parser) parseCall() (*CallExpr, error) {
+	name, err := p.expect(IDENT)
+	if err != nil {
+		return nil, err
+	}
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, p.errorf("call of %s has no output argument", name)
+	}
+	return &CallExpr{name, args}, nil
+}
+
+// parseArgs parses a list of variables in parentheses.
+func (p *Parser) parseArgs() ([]int, error) {
+	if _, err := p.expect(LPAREN); err != nil {
+		return nil, err
+	}
+	tok, _, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, p.errorf("error tokenizing: %s", err)
+	}
+	if tok == RPAREN {
+		return nil, nil
+	}
+	p.unscan()
+
+	var args []int
+	for {
+		v, err := p.parseVariable()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+
+		tok, lit, err := p.scanIgnoreWhitespace()
+		if err != nil {
+			return nil, p.errorf("error tokenizing: %s", err)
+		}
+		switch tok {
+		case RPAREN:
+			return args, nil
+		case COMMA:
+		default:
+			return nil, p.errorf("expected COMMA or RPAREN, got %s", describeToken(tok, lit))
+		}
+	}
+}
+
+// ParseModuleMacros expands the macros in src and parses the result as a
+// module in the given dialect. Positions of errors and expressions refer to
+// the unexpanded source.
+func ParseModuleMacros(src string, d Dialect) (*Module, *SourceMap, error) {
+	expanded, smap, err := Preprocess(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := NewParser(strings.NewReader(expanded), d).ParseModule()
+	if err != nil {
+		return nil, nil, smap.remapError(err)
+	}
+	for i := range m.Imports {
+		m.Imports[i].Pos = smap.Lookup(m.Imports[i].Pos).Pos
+	}
+	for _, proc := range m.Procs {
+		proc.Pos = smap.Lookup(proc.Pos).Pos
+		smap.Remap(proc.Body)
+	}
+	if m.Main != nil {
+		smap.Remap(m.Main)
+		m.Main = smap.clearLocals(m.Main, d)
+	}
+	return m, smap, nil
+}
+
+// Link inlines all procedure calls of the main program of m and returns the
+// resulting program. The procedures are those of m and of the modules
+// imported directly or indirectly, which are loaded by load. It gets the
+// importing module and the path of the import. Every module is linked once,
+// even if it is imported multiple times.
+//
+// The variables of an inlined procedure follow the variables of the caller.
+// They are cleared before the call, since they may have been given as input,
+// and are 0 again after the call.
+func Link(m *Module, load func(from *Module, path string) (*Module, error)) (*Expr, error) {
+	if m.Main == nil {
+		return nil, m.errorf(Pos{1, 1}, "module has no main program")
+	}
+	l := &linker{
+		procs:   make(map[string]*Proc),
+		modules: make(map[*Proc]*Module),
+		bodies:  make(map[*Proc]*Expr),
+		active:  make(map[*Proc]bool),
+		loaded:  make(map[string]bool),
+	}
+	if err := l.add(m, load); err != nil {
+		return nil, err
+	}
+	return l.link(m.Main, m)
+}
+
+// linker inlines procedure calls.
+type linker struct {
+	procs map[string]*Proc
+	// modules contains the module defining every procedure.
+	modules map[*Proc]*Module
+	// bodies contains the linked bodies of the procedures.
+	bodies map[*Proc]*Expr
+	// active contains the procedures being linked to detect recursion.
+	active map[*Proc]bool
+	// loaded contains the paths of the added modules.
+	loaded map[string]bool
+}
+
+// add adds the procedures of m and the modules it imports.
+func (l *linker) add(m *Module, load func(from *Module, path string) (*Module, error)) error {
+	l.loaded[m.Path] = true
+	for _, proc := range m.Procs {
+		if other, ok := l.procs[proc.Name]; ok {
+			return m.errorf(proc.Pos, "procedure %s already defined at %s",
+				proc.Name, l.modules[other].location(other.Pos))
+		}
+		l.procs[proc.Name] = proc
+		l.modules[proc] = m
+	}
+
+	for _, imp := range m.Imports {
+		if load == nil {
+			return m.errorf(imp.Pos, "can not import %q", imp.Path)
+		}
+		lib, err := load(m, imp.Path)
+		if err != nil {
+			return m.errorf(imp.Pos, "error importing %q: %s", imp.Path, err)
+		}
+		if l.loaded[lib.Path] {
+			continue
+		}
+		if err = l.add(lib, load); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// link returns a copy of e, which is part of m, with all calls inlined.
+func (l *linker) link(e *Expr, m *Module) (*Expr, error) {
+	e = cloneExpr(e)
+	max := maxVariable(e)
+	var err error
+	Walk(e, func(e *Expr) bool {
+		if err != nil || e.Type != CALL_EXPR {
+			return err == nil
+		}
+		var inlined *Expr
+		if inlined, err = l.inline(e, m, max); err == nil {
+			*e = *inlined
+		}
+		return false
+	})
+	return e, err
+}
+
+// body returns the body of proc with all calls inlined.
+func (l *linker) body(proc *Proc) (*Expr, error) {
+	if body, ok := l.bodies[proc]; ok {
+		return body, nil
+	}
+	l.active[proc] = true
+	body, err := l.link(proc.Body, l.modules[proc])
+	delete(l.active, proc)
+	if err != nil {
+		return nil, err
+	}
+	l.bodies[proc] = body
+	return body, nil
+}
+
+// inline returns the code replacing the call e in m, whose highest variable
+// is max. The variables xN of the procedure become x(max+1+N).
+func (l *linker) inline(e *Expr, m *Module, max int) (*Expr, error) {
+	call := e.CallExpr
+	proc, ok := l.procs[call.Name]
+	switch {
+	case !ok:
+		return nil, m.errorf(e.Pos, "undefined procedure %s", call.Name)
+	case len(call.Args) != len(proc.Inputs)+1:
+		return nil, m.errorf(e.Pos, "procedure %s expects %d arguments, got %d",
+			call.Name, len(proc.Inputs)+1, len(call.Args))
+	case l.active[proc]:
+		return nil, m.errorf(e.Pos, "recursive call of procedure %s", call.Name)
+	}
+	body, err := l.body(proc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The inlined code gets the position of the call.
+	regs := map[int]bool{proc.Output: true}
+	for _, v := range proc.Inputs {
+		regs[v] = true
+	}
+	body = cloneExpr(body)
+	mapVariables(body, func(v int) int {
+		regs[v] = true
+		return v
+	})
+	var vars []int
+	for v := range regs {
+		vars = append(vars, v)
+	}
+	sort.Ints(vars)
+	// The variables and the temporary xT have to fit into an int.
+	if vars[len(vars)-1] > maxInt-2-max {
+		return nil, m.errorf(e.Pos, "x%d is too large to inline procedure %s after it", max, call.Name)
+	}
+	base := max + 1
+	t := base + vars[len(vars)-1] + 1
+	mapVariables(body, func(v int) int { return base + v })
+	Walk(body, func(b *Expr) bool {
+		b.Pos, b.End = e.Pos, e.End
+		return true
+	})
+
+	b := builder{e.Pos, e.End}
+	var stmts []*Expr
+	for _, v := range vars {
+		stmts = append(stmts, b.clear(base+v))
+	}
+	stmts = append(stmts, b.clear(t))
+	for i, v := range proc.Inputs {
+		stmts = append(stmts, b.addTo(base+v, call.Args[i], t))
+	}
+	out := call.Args[len(call.Args)-1]
+	stmts = append(stmts, body, b.clear(out), b.move(out, base+proc.Output))
+	for _, v := range vars {
+		if v != proc.Output {
+			stmts = append(stmts, b.clear(base+v))
+		}
+	}
+	return b.seq(stmts...), nil
+}
+
+// cloneExpr returns a deep copy of e.
+func cloneExpr(e *Expr) *Expr {
+	c := *e
+	switch e.Type {
+	case INCR_EXPR:
+		incr := *e.IncrExpr
+		c.IncrExpr = &incr
+	case SEQ_EXPR:
+		c.SeqExpr = &SeqExpr{cloneExpr(e.SeqExpr.P1), cloneExpr(e.SeqExpr.P2)}
+	case WHILE_EXPR:
+		c.WhileExpr = &WhileExpr{e.WhileExpr.Variable, cloneExpr(e.WhileExpr.P)}
+	case ASSIGN_EXPR:
+		assign := *e.AssignExpr
+		c.AssignExpr = &assign
+	case IF_EXPR:
+		c.IfExpr = &IfExpr{Variable: e.IfExpr.Variable, Then: cloneExpr(e.IfExpr.Then)}
+		if e.IfExpr.Else != nil {
+			c.IfExpr.Else = cloneExpr(e.IfExpr.Else)
+		}
+	case LOOP_EXPR:
+		c.LoopExpr = &LoopExpr{Variable: e.LoopExpr.Variable, P: cloneExpr(e.LoopExpr.P)}
+	case CALL_EXPR:
+		c.CallExpr = &CallExpr{e.CallExpr.Name, append([]int(nil), e.CallExpr.Args...)}
+	}
+	return &c
+}
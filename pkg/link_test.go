@@ -0,0 +1,262 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// arithLib is a library with procedures for addition and multiplication.
+const arithLib = `PROC ADD2(x1, x2, x0) BEGIN
+  WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END;
+  WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 1 END
+END
+PROC MUL2(x1, x2, x0) BEGIN
+  WHILE x1 != 0 DO x1 := x1 - 1; ADD2(x0, x2, x0) END
+END`
+
+// memLoader returns a loader for the modules with the given sources.
+func memLoader(files map[string]string) func(*Module, string) (*Module, error) {
+	return func(from *Module, path string) (*Module, error) {
+		src, ok := files[path]
+		if !ok {
+			return nil, fmt.Errorf("no such file")
+		}
+		m, err := NewParser(strings.NewReader(src)).ParseModule()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%s", path, err)
+		}
+		m.Path = path
+		return m, nil
+	}
+}
+
+func linkSource(src string, files map[string]string) (*Expr, error) {
+	m, err := NewParser(strings.NewReader(src)).ParseModule()
+	if err != nil {
+		return nil, err
+	}
+	return Link(m, memLoader(files))
+}
+
+func TestParseModule(t *testing.T) {
+	src := `IMPORT "a.while" IMPORT "b.while"
+PROC INC(x1, x0) BEGIN x0 := x0 + 1 END
+PROC NOP(x0) BEGIN x0 := x0 + 1 END
+INC(x2, x3); x1 := x1 + 1`
+	m, err := NewParser(strings.NewReader(src)).ParseModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Imports) != 2 || m.Imports[1].Path != "b.while" || m.Imports[1].Pos != (Pos{1, 18}) {
+		t.Errorf("unexpected imports %v", m.Imports)
+	}
+	if len(m.Procs) != 2 {
+		t.Fatalf("expected 2 procedures, got %d", len(m.Procs))
+	}
+	inc := m.Procs[0]
+	if inc.Name != "INC" || len(inc.Inputs) != 1 || inc.Inputs[0] != 1 || inc.Output != 0 || inc.Pos != (Pos{2, 1}) {
+		t.Errorf("unexpected procedure %+v", inc)
+	}
+	call := m.Main.SeqExpr.P1
+	if call.Type != CALL_EXPR || statementString(call) != "INC(x2, x3)" {
+		t.Errorf("expected call INC(x2, x3), got %s", call)
+	}
+}
+
+func TestLink(t *testing.T) {
+	files := map[string]string{"arith.while": arithLib}
+	tests := map[string]struct {
+		src      string
+		input    []uint64
+		expected []uint64
+	}{
+		"Add":     {`IMPORT "arith.while" ADD2(x1, x2, x0)`, []uint64{3, 4}, []uint64{7, 3, 4}},
+		"Nested":  {`IMPORT "arith.while" MUL2(x1, x2, x0)`, []uint64{3, 4}, []uint64{12, 3, 4}},
+		"Aliased": {`IMPORT "arith.while" ADD2(x1, x1, x1); x0 := x0 + 1`, []uint64{3}, []uint64{1, 6}},
+		"In loop": {`IMPORT "arith.while"
+WHILE x1 != 0 DO x1 := x1 - 1; ADD2(x2, x2, x0); x3 := x0 + 0 END`, []uint64{3, 5, 0}, []uint64{10, 0, 5, 10}},
+		"Local procedure": {`IMPORT "arith.while"
+PROC SQUARE(x1, x0) BEGIN MUL2(x1, x1, x0) END
+SQUARE(x1, x1); SQUARE(x1, x0)`, []uint64{3}, []uint64{81, 9}},
+		"No inputs": {`PROC FIVE(x0) BEGIN x0 := x0 + 5 END FIVE(x2); x0 := x2 + 1`,
+			[]uint64{0, 7}, []uint64{6, 0, 5}},
+		"Extra input": {`IMPORT "arith.while" MUL2(x1, x2, x0)`, []uint64{3, 4, 5, 6, 7, 8, 9},
+			[]uint64{12, 3, 4}},
+	}
+
+	for caseName, testCase := range tests {
+		m, err := NewParser(strings.NewReader(testCase.src), SchoeningDialect).ParseModule()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		prog, err := Link(m, memLoader(files))
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		Walk(prog, func(e *Expr) bool {
+			if e.Type == CALL_EXPR {
+				t.Errorf("%s: call %s was not inlined", caseName, statementString(e))
+			}
+			return true
+		})
+
+		in := NewInterpreter(prog, testCase.input...)
+		if err = in.Run(0); err != nil {
+			t.Errorf("%s: %s", caseName, err)
+		}
+		// The variables of the procedures are 0 again.
+		expected := make([]uint64, len(in.Vars()))
+		copy(expected, testCase.expected)
+		if got := in.Vars(); fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", caseName, expected, got)
+		}
+	}
+}
+
+func TestLinkImportOnce(t *testing.T) {
+	files := map[string]string{
+		"arith.while": arithLib,
+		"a.while":     `IMPORT "arith.while" IMPORT "b.while" PROC A(x1, x0) BEGIN ADD2(x1, x1, x0) END`,
+		"b.while":     `IMPORT "a.while" IMPORT "arith.while" PROC B(x1, x0) BEGIN MUL2(x1, x1, x0) END`,
+	}
+	prog, err := linkSource(`IMPORT "a.while" IMPORT "b.while" A(x1, x2); B(x2, x0)`, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Run(prog, 0, 3); err != nil || got != 36 {
+		t.Errorf("expected 36, got %d, %v", got, err)
+	}
+}
+
+func TestLinkPositions(t *testing.T) {
+	prog, err := linkSource("x1 := x1 + 1;\n  ADD2(x1, x1, x0)", map[string]string{"arith.while": arithLib})
+	if err == nil || err.Error() != "2:3: undefined procedure ADD2" {
+		t.Errorf("expected undefined procedure at 2:3, got %v", err)
+	}
+
+	prog, err = linkSource("IMPORT \"arith.while\"\nx1 := x1 + 1;\n  ADD2(x1, x1, x0)", map[string]string{"arith.while": arithLib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Walk(prog.SeqExpr.P2, func(e *Expr) bool {
+		if e.Pos != (Pos{3, 3}) || e.End != (Pos{3, 19}) {
+			t.Errorf("expected inlined code at 3:3-3:19, got %s-%s", e.Pos, e.End)
+			return false
+		}
+		return true
+	})
+}
+
+func TestLinkErrors(t *testing.T) {
+	files := map[string]string{
+		"arith.while":  arithLib,
+		"broken.while": "PROC X(x1) BEGIN x1 := x1 + 2 END",
+		"dup.while":    "PROC ADD2(x1, x0) BEGIN x0 := x0 + 1 END",
+	}
+	tests := map[string]struct {
+		src string
+		msg string
+	}{
+		"Recursion": {"PROC F(x1, x0) BEGIN F(x1, x0) END F(x1, x0)",
+			"1:22: recursive call of procedure F"},
+		"Mutual recursion": {"PROC F(x0) BEGIN G(x0) END\nPROC G(x0) BEGIN F(x0) END\nG(x0)",
+			"1:18: recursive call of procedure G"},
+		"Undefined": {"F(x1, x0)", "1:1: undefined procedure F"},
+		"Arguments": {`IMPORT "arith.while" ADD2(x1, x0)`, "1:22: procedure ADD2 expects 3 arguments, got 2"},
+		"Duplicate": {`IMPORT "arith.while" IMPORT "dup.while" ADD2(x1, x0)`,
+			"dup.while:1:1: procedure ADD2 already defined at arith.while:1:1"},
+		"Missing file":  {`IMPORT "none.while" x0 := x0 + 1`, `1:1: error importing "none.while": no such file`},
+		"Broken import": {`IMPORT "broken.while" x0 := x0 + 1`, `error importing "broken.while": broken.while:1:`},
+		"No main":       {`IMPORT "arith.while"`, "1:1: module has no main program"},
+		"Large variable": {`IMPORT "arith.while" x9223372036854775806 := x9223372036854775806 + 1; ADD2(x1, x2, x0)`,
+			"1:72: x9223372036854775806 is too large to inline procedure ADD2 after it"},
+	}
+
+	for caseName, testCase := range tests {
+		_, err := linkSource(testCase.src, files)
+		if err == nil || !strings.Contains(err.Error(), testCase.msg) {
+			t.Errorf("%s: expected error containing %q, got %v", caseName, testCase.msg, err)
+		}
+	}
+
+	m, err := NewParser(strings.NewReader(`IMPORT "arith.while" x0 := x0 + 1`)).ParseModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Link(m, nil); err == nil {
+		t.Error("expected error for import without loader")
+	}
+}
+
+func TestParseModuleErrors(t *testing.T) {
+	tests := map[string]string{
+		"Import after procedure": `PROC F(x0) BEGIN x0 := x0 + 1 END IMPORT "a.while"`,
+		"Import without path":    "IMPORT x0 := x0 + 1",
+		"Unterminated path":      "IMPORT \"a.while\nx0 := x0 + 1",
+		"No output parameter":    "PROC F() BEGIN x0 := x0 + 1 END",
+		"Duplicate parameter":    "PROC F(x1, x1) BEGIN x0 := x0 + 1 END",
+		"Constant parameter":     "PROC F(1) BEGIN x0 := x0 + 1 END",
+		"Missing BEGIN":          "PROC F(x0) x0 := x0 + 1 END",
+		"Missing END":            "PROC F(x0) BEGIN x0 := x0 + 1",
+		"Call without output":    "F()",
+		"Missing parenthesis":    "F(x1, x0",
+		"Nested procedure":       "PROC F(x0) BEGIN PROC G(x0) BEGIN x0 := x0 + 1 END END",
+		"Named variables":        "",
+	}
+
+	for caseName, input := range tests {
+		var d Dialect
+		if caseName == "Named variables" {
+			d, input = NamedDialect, "r := r + 1"
+		}
+		if m, err := NewParser(strings.NewReader(input), d).ParseModule(); err == nil {
+			t.Errorf("%s: expected error, got %v", caseName, m)
+		}
+	}
+
+	// Calls are only allowed in modules.
+	if expr, err := NewParser(strings.NewReader("F(x1, x0)")).Parse(); err == nil {
+		t.Errorf("expected error for call outside of module, got %s", expr)
+	}
+}
+
+func TestParseModuleMacros(t *testing.T) {
+	src := "PROC DOUBLE(x1, x0) BEGIN\n  ADDTO(x0, x1); ADDTO(x0, x1)\nEND\nDOUBLE(x1, x0)"
+	m, _, err := ParseModuleMacros(src, StrictDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := m.Procs[0].Body.Pos; pos != (Pos{2, 3}) {
+		t.Errorf("expected body at 2:3, got %s", pos)
+	}
+	prog, err := Link(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Run(prog, 0, 4); err != nil || got != 8 {
+		t.Errorf("expected 8, got %d, %v", got, err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "io"
+
+// The LOOP language is the sibling of WHILE with `LOOP xN DO P END` instead of
+// while expressions. The number of iterations is fixed before the loop starts,
+// so LOOP programs always halt and compute exactly the primitive recursive
+// functions. The interpreter runs LOOP programs directly and Desugar
+// translates them to WHILE programs by counting down a fresh variable.
+
+// NewLoopParser creates a parser for the LOOP language.
+func NewLoopParser(r io.Reader) *Parser {
+	return NewParser(r, LoopDialect)
+}
+
+// isLoop reports whether e is a while or LOOP expression.
+func isLoop(e *Expr) bool {
+	return e.Type == WHILE_EXPR || e.Type == LOOP_EXPR
+}
+
+// loopBody returns the body of a while or LOOP expression.
+func loopBody(e *Expr) *Expr {
+	if e.Type == LOOP_EXPR {
+		return e.LoopExpr.P
+	}
+	return e.WhileExpr.P
+}
@@ -0,0 +1,151 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const loopMulProg = "LOOP x1 DO LOOP x2 DO x0 := x0 + 1 END END"
+
+func mustParseLoop(t testing.TB, input string) *Expr {
+	t.Helper()
+	prog, err := NewLoopParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		t.Fatalf("%q: %s", input, err)
+	}
+	return prog
+}
+
+func TestParseLoopErrors(t *testing.T) {
+	tests := map[string]string{
+		"While":          "WHILE x1 != 0 DO x1 := x1 - 1 END",
+		"Missing DO":     "LOOP x1 x0 := x0 + 1 END",
+		"Missing END":    "LOOP x1 DO x0 := x0 + 1",
+		"Sugar":          "x0 := x1 + 2",
+		"Loop condition": "LOOP x1 != 0 DO x0 := x0 + 1 END",
+	}
+
+	for caseName, input := range tests {
+		if expr, err := NewLoopParser(strings.NewReader(input)).Parse(); err == nil {
+			t.Errorf("%s: expected error, got %s", caseName, expr)
+		}
+	}
+	if _, err := NewParser(strings.NewReader(loopMulProg)).Parse(); err == nil {
+		t.Errorf("expected LOOP to be rejected by the WHILE parser")
+	}
+}
+
+func TestRunLoop(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		args     []uint64
+		expected uint64
+		steps    int
+	}{
+		"Mul":             {loopMulProg, []uint64{3, 4}, 12, 31},
+		"Zero iterations": {"LOOP x1 DO x0 := x0 + 1 END", nil, 0, 1},
+		// The number of iterations is fixed when the loop starts.
+		"Modify variable": {"LOOP x1 DO x1 := x1 + 1; x0 := x0 + 1 END", []uint64{3}, 3, 10},
+		"Clear variable":  {"LOOP x1 DO x1 := x1 - 1; x0 := x0 + 1 END", []uint64{3}, 3, 10},
+		"Sequence":        {"x1 := x1 + 1; LOOP x1 DO x0 := x0 + 1 END; x0 := x0 + 1", []uint64{1}, 3, 7},
+	}
+
+	for caseName, testCase := range tests {
+		in := NewInterpreter(mustParseLoop(t, testCase.input), testCase.args...)
+		if err := in.Run(0); err != nil {
+			t.Fatalf("%s: %s", caseName, err)
+		}
+		if in.Var(0) != testCase.expected || in.Steps() != testCase.steps {
+			t.Errorf("%s: expected %d in %d steps, got %d in %d steps",
+				caseName, testCase.expected, testCase.steps, in.Var(0), in.Steps())
+		}
+	}
+}
+
+func TestLoopNext(t *testing.T) {
+	prog := mustParseLoop(t, loopMulProg)
+	in := NewInterpreter(prog, 1, 1)
+	// LOOP x1, LOOP x2, x0 := x0 + 1, LOOP x2, LOOP x1 are executed.
+	expected := []*Expr{prog, prog.LoopExpr.P, prog.LoopExpr.P.LoopExpr.P, prog.LoopExpr.P, prog}
+	for i, e := range expected {
+		if in.Next() != e {
+			t.Fatalf("step %d: expected %s next, got %s", i, e, in.Next())
+		}
+		in.Step()
+	}
+	if !in.Done() {
+		t.Errorf("expected the program to halt")
+	}
+}
+
+func TestLoopToWhile(t *testing.T) {
+	for _, input := range []string{
+		loopMulProg,
+		"LOOP x1 DO x1 := x1 + 1; x0 := x0 + 1 END",
+		"LOOP x1 DO LOOP x0 DO x2 := x2 + 1 END; x0 := x0 + 1; LOOP x2 DO x0 := x0 + 1 END END",
+	} {
+		loop := mustParseLoop(t, input)
+		while := mustDesugar(t, loop)
+		Walk(while, func(e *Expr) bool {
+			if e.Type == LOOP_EXPR {
+				t.Fatalf("%q: LOOP expression left after translation", input)
+			}
+			return true
+		})
+
+		// Temporaries follow the used variables, so there must not be more
+		// input.
+		for x1 := uint64(0); x1 < 5; x1++ {
+			for x2 := uint64(0); x2 < 5; x2++ {
+				args := []uint64{x1, x2}[:maxVariable(loop)]
+				expected, _ := Run(loop, 0, args...)
+				got, err := Run(while, 100000, args...)
+				if err != nil || got != expected {
+					t.Errorf("%q with %v: expected %d, got %d, %v", input, args, expected, got, err)
+				}
+			}
+		}
+	}
+}
+
+func TestLoopStepBack(t *testing.T) {
+	prog := mustParseLoop(t, loopMulProg)
+	var states []state
+	in := NewInterpreter(prog, 2, 3)
+	for states = append(states, stateOf(in)); in.Step(); {
+		states = append(states, stateOf(in))
+	}
+
+	in = NewInterpreter(prog, 2, 3)
+	in.Record(4)
+	if err := in.Run(0); err != nil {
+		t.Fatal(err)
+	}
+	for i := len(states) - 1; i >= 0; i-- {
+		if got := stateOf(in); !reflect.DeepEqual(got, states[i]) {
+			t.Fatalf("step %d: expected %v, got %v", i, states[i], got)
+		}
+		in.StepBack()
+	}
+}
@@ -0,0 +1,611 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Macros are expanded by a preprocessor before the program is parsed.
+// A macro is defined on lines of its own:
+//
+//	MACRO ADD(a, b) LOCAL t
+//	  WHILE b != 0 DO b := b - 1; a := a + 1; t := t + 1 END;
+//	  WHILE t != 0 DO t := t - 1; b := b + 1 END
+//	ENDMACRO
+//
+// and called like a statement, e.g. `ADD(x0, x1)`. The parameters and locals
+// are replaced by the arguments and fresh variables, which are not used
+// anywhere else in the program. A local always gets the same variable within
+// one expansion, so macros have to reset their locals to 0 at the end to be
+// usable in loops. ParseMacrosWith and ParseModuleMacros clear the locals at
+// the start of the main program, since they may have been given as input.
+//
+// Before the replacement the body is executed as a text/template with the
+// parameters and locals as data, e.g. `{{.a}}`. This allows bodies depending
+// on constant arguments, like `{{range times .c}} a := a + 1; {{end}}`.
+//
+// Arguments may also be blocks of code in braces, e.g.
+// `IF(x1, { x0 := x0 + 1 })`. A block is expanded where the macro uses the
+// parameter, but with the parameters and locals of the caller, so the names
+// of the macro do not leak into the block.
+//
+// The macros of the standard library in stdlib.while are available in every
+// program. A program may define a macro with the same name to replace one.
+// Their names are only expanded if followed by arguments, so the keyword IF
+// of the sugar dialect is not mistaken for the macro IF.
+
+// MacroCall is the call of a macro.
+type MacroCall struct {
+	Name string
+	// Pos is the position of the call in the unexpanded source.
+	Pos Pos
+}
+
+// Origin is the position in the unexpanded source some expanded code
+// originates from.
+type Origin struct {
+	Pos Pos
+	// Calls contains the macro calls which led to the code, outermost first.
+	Calls []MacroCall
+}
+
+// String returns the position followed by the macro calls, innermost first.
+func (o Origin) String() string { return o.Pos.String() + o.context() }
+
+// context describes the macro calls, e.g. ` (in ADD called at 3:1)`.
+func (o Origin) context() string {
+	if len(o.Calls) == 0 {
+		return ""
+	}
+	calls := make([]string, len(o.Calls))
+	for i, call := range o.Calls {
+		calls[len(calls)-1-i] = fmt.Sprintf("in %s called at %s", call.Name, call.Pos)
+	}
+	return " (" + strings.Join(calls, ", ") + ")"
+}
+
+// segment is a part of the expanded code with the same origin.
+type segment struct {
+	// out is the position of the segment in the expanded code.
+	out Pos
+	// src is the position in the unexpanded source.
+	src Pos
+	// exact is true if the segment is a copy of the source, so the columns
+	// can be mapped one to one. Exact segments never span multiple lines.
+	exact bool
+	calls []MacroCall
+}
+
+// SourceMap maps positions in the expanded code to their origin.
+type SourceMap struct {
+	segments []segment
+	// The locals of the expanded macros are the variables x(localBase+1),
+	// ..., x(localBase+locals).
+	localBase, locals int
+
+	// Names are the named variables of a program parsed by ParseMacrosWith
+	// in a dialect with names, otherwise nil.
+	Names *Names
+}
+
+// Lookup returns the origin of a position in the expanded code.
+func (m *SourceMap) Lookup(p Pos) Origin {
+	i := sort.Search(len(m.segments), func(i int) bool {
+		return posLess(p, m.segments[i].out)
+	}) - 1
+	if i < 0 {
+		return Origin{Pos: p}
+	}
+	seg := m.segments[i]
+	src := seg.src
+	if seg.exact {
+		src.Column += p.Column - seg.out.Column
+	}
+	return Origin{src, seg.calls}
+}
+
+// Remap replaces the positions of the expression and its subexpressions by
+// their origins.
+func (m *SourceMap) Remap(e *Expr) {
+	Walk(e, func(e *Expr) bool {
+		if e.End.IsValid() {
+			// End is right after the last character, so look up the last
+			// character, which has the same origin as the expression.
+			end := m.Lookup(Pos{e.End.Line, e.End.Column - 1}).Pos
+			e.End = Pos{end.Line, end.Column + 1}
+		}
+		e.Pos = m.Lookup(e.Pos).Pos
+		return true
+	})
+}
+
+// posLess reports whether a is before b.
+func posLess(a, b Pos) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// macro is a macro definition.
+type macro struct {
+	name   string
+	params []string
+	locals []string
+	body   string
+	// pos is the position of the header and bodyPos the one of the body.
+	pos, bodyPos Pos
+	// tmpl is the body as template or nil if the body contains no actions.
+	tmpl *template.Template
+	// std is true for macros of the standard library.
+	std bool
+}
+
+// macroArg is an argument of a macro call, which is either a value like a
+// variable or a number, or a block of code.
+type macroArg struct {
+	value string
+	block *macroBlock
+}
+
+// macroBlock is a block of code passed to a macro. It is expanded with the
+// substitutions and calls of the place it was written at.
+type macroBlock struct {
+	text  string
+	pos   Pos
+	exact bool
+	subst map[string]macroArg
+	calls []MacroCall
+}
+
+var (
+	macroHeader = regexp.MustCompile(
+		`^(\s*)MACRO\s+([A-Za-z_]\w*)\s*\(([^)]*)\)\s*(?:LOCAL\s+(.*?))?\s*$`)
+	macroName   = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+	variable    = regexp.MustCompile(`\bx_?([0-9]+)\b`)
+	inputHeader = regexp.MustCompile(`\bINPUT\b([^;]*);`)
+)
+
+// maxTimes is the largest count of the template function times. Larger
+// constants have to be built from their bits, see SET in stdlib.while.
+const maxTimes = 10000
+
+// templateFuncs are the functions available in templates of macro bodies.
+var templateFuncs = template.FuncMap{
+	// times returns a slice of length n for ranging n times.
+	"times": func(n interface{}) ([]int, error) {
+		count, err := strconv.Atoi(fmt.Sprint(n))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("times: invalid count %v", n)
+		}
+		if count > maxTimes {
+			return nil, fmt.Errorf("times: count %d is larger than %d", count, maxTimes)
+		}
+		return make([]int, count), nil
+	},
+	// bits returns the binary digits of the natural number n, highest
+	// first and without leading zeros.
+	"bits": func(n interface{}) ([]bool, error) {
+		c, err := strconv.ParseUint(fmt.Sprint(n), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bits: invalid number %v", n)
+		}
+		var bits []bool
+		for ; c > 0; c >>= 1 {
+			bits = append([]bool{c&1 == 1}, bits...)
+		}
+		return bits, nil
+	},
+}
+
+// preprocessor expands the macros of a program.
+type preprocessor struct {
+	macros map[string]*macro
+	out    bytes.Buffer
+	outPos Pos
+	smap   *SourceMap
+
+	// next is the source position following the last exact segment.
+	next Pos
+}
+
+// Preprocess expands the macros in src. It returns the expanded program and
+// a source map to find the origin of positions in the expanded program.
+func Preprocess(src string) (string, *SourceMap, error) {
+	p := &preprocessor{
+		macros: make(map[string]*macro),
+		outPos: Pos{1, 1},
+		smap:   &SourceMap{},
+	}
+	for name, m := range stdMacros {
+		p.macros[name] = m
+	}
+	// The locals follow the variables of the program and x0, which is the
+	// output and must not be used as local.
+	for _, m := range variable.FindAllStringSubmatch(src, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > p.smap.localBase {
+			p.smap.localBase = n
+		}
+	}
+	if m := inputHeader.FindStringSubmatch(src); m != nil {
+		// The named inputs are x1, x2, ..., see Names.
+		if n := len(strings.Split(m[1], ",")); n > p.smap.localBase {
+			p.smap.localBase = n
+		}
+	}
+
+	main, err := p.readDefinitions(src, false)
+	if err != nil {
+		return "", nil, err
+	}
+	if err = p.expand(main, Pos{1, 1}, true, nil, nil); err != nil {
+		return "", nil, err
+	}
+	return p.out.String(), p.smap, nil
+}
+
+// ParseMacros expands the macros in src and parses the result. Positions of
+// errors and expressions refer to the unexpanded source.
+func ParseMacros(src string) (*Expr, *SourceMap, error) {
+	return ParseMacrosWith(src, StrictDialect)
+}
+
+// ParseMacrosWith is like ParseMacros, but parses the expanded program in the
+// given dialect, e.g. LoopDialect.
+func ParseMacrosWith(src string, d Dialect) (*Expr, *SourceMap, error) {
+	expanded, smap, err := Preprocess(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := NewParser(strings.NewReader(expanded), d)
+	prog, err := p.Parse()
+	if err != nil {
+		return nil, nil, smap.remapError(err)
+	}
+	smap.Remap(prog)
+	smap.Names = p.Names()
+	return smap.clearLocals(prog, d), smap, nil
+}
+
+// clearLocals returns the program prog of the given dialect starting with
+// statements setting the locals of the expanded macros to 0.
+func (m *SourceMap) clearLocals(prog *Expr, d Dialect) *Expr {
+	if m.locals == 0 {
+		return prog
+	}
+	b := builder{prog.Pos, prog.End}
+	var stmts []*Expr
+	for i := 1; i <= m.locals; i++ {
+		v := m.localBase + i
+		if d.Loop {
+			stmts = append(stmts, &Expr{Type: LOOP_EXPR, Pos: b.pos, End: b.end,
+				LoopExpr: &LoopExpr{Variable: v, P: b.decr(v)}})
+		} else {
+			stmts = append(stmts, b.clear(v))
+		}
+	}
+	return b.seq(append(stmts, prog)...)
+}
+
+// remapError maps the position of a syntax error in the expanded code to its
+// origin.
+func (m *SourceMap) remapError(err error) error {
+	if e, ok := err.(*Error); ok {
+		origin := m.Lookup(e.Pos)
+		return &Error{origin.Pos, e.Msg + origin.context()}
+	}
+	return err
+}
+
+// readDefinitions reads all macro definitions of src. It returns src with the
+// definitions replaced by empty lines, so the line numbers stay the same.
+// std marks the definitions as part of the standard library.
+func (p *preprocessor) readDefinitions(src string, std bool) (string, error) {
+	var main bytes.Buffer
+	lines := strings.SplitAfter(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		match := macroHeader.FindStringSubmatch(lines[i])
+		if match == nil {
+			main.WriteString(lines[i])
+			continue
+		}
+
+		m := &macro{name: match[2], pos: Pos{i + 1, len(match[1]) + 1}, bodyPos: Pos{i + 2, 1}, std: std}
+		if old, ok := p.macros[m.name]; ok && !old.std {
+			return "", &Error{m.pos, fmt.Sprintf("macro %s is already defined", m.name)}
+		}
+		var err error
+		if m.params, err = macroNames(match[3], m.pos, true); err != nil {
+			return "", err
+		}
+		if m.locals, err = macroNames(match[4], m.pos, false); err != nil {
+			return "", err
+		}
+
+		// The body ends with a line only containing ENDMACRO.
+		end := i + 1
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "ENDMACRO" {
+			end++
+		}
+		if end == len(lines) {
+			return "", &Error{m.pos, fmt.Sprintf("missing ENDMACRO for macro %s", m.name)}
+		}
+		m.body = strings.TrimRightFunc(strings.Join(lines[i+1:end], ""), unicode.IsSpace)
+		if strings.Contains(m.body, "{{") {
+			m.tmpl, err = template.New(m.name).Funcs(templateFuncs).Parse(m.body)
+			if err != nil {
+				return "", &Error{m.pos, err.Error()}
+			}
+		}
+		p.macros[m.name] = m
+
+		for ; i <= end; i++ {
+			if strings.HasSuffix(lines[i], "\n") {
+				main.WriteString("\n")
+			}
+		}
+		i = end
+	}
+	return main.String(), nil
+}
+
+// macroNames splits and checks a comma separated list of parameter or local
+// names.
+func macroNames(list string, pos Pos, allowEmpty bool) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case !macroName.MatchString(name):
+			return nil, &Error{pos, fmt.Sprintf("invalid name %q", name)}
+		case variable.MatchString(name):
+			return nil, &Error{pos, fmt.Sprintf("name %s is a variable", name)}
+		case name == "WHILE" || name == "DO" || name == "END":
+			return nil, &Error{pos, fmt.Sprintf("name %s is a keyword", name)}
+		case seen[name]:
+			return nil, &Error{pos, fmt.Sprintf("duplicate name %s", name)}
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// expand expands the macro calls in text and replaces identifiers using subst.
+// pos is the origin of the start of text. If exact is false, everything
+// originates from pos.
+func (p *preprocessor) expand(text string, pos Pos, exact bool, subst map[string]macroArg, calls []MacroCall) error {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		tokPos := pos
+		if !unicode.IsLetter(runes[i]) && runes[i] != '_' {
+			p.emit(string(runes[i]), tokPos, exact, calls)
+			pos = advance(pos, runes[i], exact)
+			i++
+			continue
+		}
+
+		// Read an identifier.
+		start := i
+		for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+			pos = advance(pos, runes[i], exact)
+			i++
+		}
+		ident := string(runes[start:i])
+
+		if arg, ok := subst[ident]; ok {
+			if b := arg.block; b != nil {
+				if err := p.expand(b.text, b.pos, b.exact, b.subst, b.calls); err != nil {
+					return err
+				}
+				continue
+			}
+			// The columns of the value can not be mapped to the name.
+			p.emit(arg.value, tokPos, false, calls)
+			continue
+		}
+		j := i
+		for j < len(runes) && unicode.IsSpace(runes[j]) {
+			j++
+		}
+		m, ok := p.macros[ident]
+		// Names of the standard library like IF are also keywords of some
+		// dialects, so they are only calls if followed by arguments.
+		if !ok || m.std && (j == len(runes) || runes[j] != '(') {
+			p.emit(ident, tokPos, exact, calls)
+			continue
+		}
+
+		// Read the arguments of the call. They are separated by commas, which
+		// are ignored inside of blocks and parentheses.
+		origin := Origin{tokPos, calls}
+		if j == len(runes) || runes[j] != '(' {
+			return &Error{tokPos, fmt.Sprintf("missing arguments for macro %s", ident) + origin.context()}
+		}
+		for ; i < j; i++ {
+			pos = advance(pos, runes[i], exact)
+		}
+		var args []macroArg
+		argStart, argPos, depth := i+1, advance(pos, runes[i], exact), 0
+		for {
+			pos = advance(pos, runes[i], exact)
+			i++
+			if i == len(runes) || depth < 0 {
+				return &Error{tokPos, fmt.Sprintf("missing ) after arguments of macro %s", ident) + origin.context()}
+			}
+			r := runes[i]
+			if depth > 0 || r != ',' && r != ')' {
+				switch r {
+				case '(', '{':
+					depth++
+				case ')', '}':
+					depth--
+				}
+				continue
+			}
+
+			argText := string(runes[argStart:i])
+			if r == ',' || len(args) > 0 || strings.TrimSpace(argText) != "" {
+				arg, ok := macroArgument(argText, argPos, exact, subst, calls)
+				if !ok {
+					return &Error{tokPos, fmt.Sprintf("invalid argument %q for macro %s",
+						strings.TrimSpace(argText), ident) + origin.context()}
+				}
+				args = append(args, arg)
+			}
+			if r == ')' {
+				pos = advance(pos, r, exact)
+				i++
+				break
+			}
+			argStart, argPos = i+1, advance(pos, r, exact)
+		}
+
+		if err := p.expandMacro(m, args, origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// macroArgument converts the text of an argument at pos, which is written in
+// the scope given by subst and calls. It reports whether the argument is valid.
+func macroArgument(text string, pos Pos, exact bool, subst map[string]macroArg, calls []MacroCall) (macroArg, bool) {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		open := strings.IndexRune(text, '{')
+		for _, r := range text[:open+1] {
+			pos = advance(pos, r, exact)
+		}
+		block := &macroBlock{text[open+1 : strings.LastIndex(text, "}")], pos, exact, subst, calls}
+		return macroArg{value: trimmed, block: block}, true
+	}
+	if arg, ok := subst[trimmed]; ok {
+		return arg, true
+	}
+	return macroArg{value: trimmed}, macroName.MatchString(trimmed) || isNumber(trimmed)
+}
+
+// expandMacro expands the call of m with the given arguments.
+func (p *preprocessor) expandMacro(m *macro, args []macroArg, call Origin) error {
+	for _, c := range call.Calls {
+		if c.Name == m.name {
+			return &Error{call.Pos, fmt.Sprintf("recursive call of macro %s", m.name) + call.context()}
+		}
+	}
+	if len(args) != len(m.params) {
+		return &Error{call.Pos, fmt.Sprintf("macro %s expects %d arguments, got %d",
+			m.name, len(m.params), len(args)) + call.context()}
+	}
+
+	subst := make(map[string]macroArg)
+	data := make(map[string]string)
+	for i, param := range m.params {
+		subst[param] = args[i]
+		data[param] = args[i].value
+	}
+	for _, local := range m.locals {
+		base := p.smap.localBase
+		if p.smap.locals >= maxInt-base {
+			return &Error{call.Pos, fmt.Sprintf("x%d is too large to number the locals of macro %s after it",
+				base, m.name) + call.context()}
+		}
+		p.smap.locals++
+		subst[local] = macroArg{value: fmt.Sprintf("x%d", base+p.smap.locals)}
+		data[local] = subst[local].value
+	}
+	calls := append(append([]MacroCall(nil), call.Calls...), MacroCall{m.name, call.Pos})
+
+	// The standard library is not part of the source, so its code originates
+	// from the call.
+	pos, bodyPos, exact := m.pos, m.bodyPos, true
+	if m.std {
+		pos, bodyPos, exact = call.Pos, call.Pos, false
+	}
+	if m.tmpl == nil {
+		return p.expand(m.body, bodyPos, exact, subst, calls)
+	}
+	var body bytes.Buffer
+	if err := m.tmpl.Execute(&body, data); err != nil {
+		return &Error{pos, err.Error() + Origin{pos, calls}.context()}
+	}
+	return p.expand(body.String(), pos, false, subst, calls)
+}
+
+// emit writes text to the expanded code and records its origin.
+func (p *preprocessor) emit(text string, src Pos, exact bool, calls []MacroCall) {
+	segs := p.smap.segments
+	continues := len(segs) > 0 && sameCalls(segs[len(segs)-1].calls, calls) &&
+		segs[len(segs)-1].exact == exact && (exact && p.next == src || !exact && segs[len(segs)-1].src == src)
+	if !continues {
+		p.smap.segments = append(segs, segment{p.outPos, src, exact, calls})
+	}
+
+	p.out.WriteString(text)
+	for _, r := range text {
+		p.outPos = advance(p.outPos, r, true)
+		src = advance(src, r, exact)
+	}
+	p.next = src
+	if strings.HasSuffix(text, "\n") {
+		// Exact segments must not span multiple lines.
+		p.next = Pos{}
+	}
+}
+
+// advance returns the position after the rune r at pos.
+func advance(pos Pos, r rune, exact bool) Pos {
+	if !exact {
+		return pos
+	}
+	if r == '\n' {
+		return Pos{pos.Line + 1, 1}
+	}
+	return Pos{pos.Line, pos.Column + 1}
+}
+
+// sameCalls reports whether a and b contain the same calls.
+func sameCalls(a, b []MacroCall) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumber reports whether s is a natural number.
+func isNumber(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
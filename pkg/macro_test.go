@@ -0,0 +1,146 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"strings"
+	"testing"
+)
+
+const addMacro = `MACRO ADD(a, b) LOCAL t
+  WHILE b != 0 DO b := b - 1; a := a + 1; t := t + 1 END;
+  WHILE t != 0 DO t := t - 1; b := b + 1 END
+ENDMACRO
+`
+
+func TestPreprocess(t *testing.T) {
+	input := addMacro + "ADD(x0, x1);\nADD(x0, x2)"
+	expected := "\n\n\n\n" +
+		"  WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1; x3 := x3 + 1 END;\n" +
+		"  WHILE x3 != 0 DO x3 := x3 - 1; x1 := x1 + 1 END;\n" +
+		"  WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 1; x4 := x4 + 1 END;\n" +
+		"  WHILE x4 != 0 DO x4 := x4 - 1; x2 := x2 + 1 END"
+
+	expanded, _, err := Preprocess(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expanded != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, expanded)
+	}
+}
+
+func TestParseMacros(t *testing.T) {
+	type TestCase struct {
+		input    string
+		args     []uint64
+		expected uint64
+	}
+
+	tests := map[string]TestCase{
+		"Add":     {addMacro + "ADD(x0, x1);\nADD(x0, x2)", []uint64{3, 4}, 7},
+		"Double":  {addMacro + "ADD(x0, x1); ADD(x0, x1)", []uint64{3}, 6},
+		"In loop": {addMacro + "WHILE x2 != 0 DO x2 := x2 - 1; ADD(x0, x1) END", []uint64{3, 4}, 12},
+		"Nested": {addMacro + `MACRO MUL(a, b, c) LOCAL t
+  WHILE b != 0 DO b := b - 1; ADD(a, c); t := t + 1 END;
+  WHILE t != 0 DO t := t - 1; b := b + 1 END
+ENDMACRO
+MUL(x0, x1, x2)`, []uint64{3, 4}, 12},
+		"Template": {`MACRO ADDC(a, c)
+  a := a + 1{{range times .c}}; a := a + 1{{end}}; a := a - 1
+ENDMACRO
+ADDC(x0, 5); ADDC(x0, 0)`, nil, 5},
+		"No macros": {addProg, []uint64{1, 2}, 3},
+		// The locals are cleared, even if they are given as input.
+		"Extra input": {"WHILE x1 != 0 DO x1 := x1 - 1; MUL(x3, x2, x2); ADDTO(x0, x3) END",
+			[]uint64{3, 4, 0, 0, 9, 9, 9}, 48},
+	}
+
+	for caseName, testCase := range tests {
+		prog, _, err := ParseMacros(testCase.input)
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		x0, err := Run(prog, 100000, testCase.args...)
+		if err != nil || x0 != testCase.expected {
+			t.Errorf("%s: expected %d, got %d, %v", caseName, testCase.expected, x0, err)
+		}
+	}
+}
+
+func TestParseMacrosErrors(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"Error in main": {addMacro + "ADD(x0, x1);\nx1 := x2 + 1",
+			"6:7: second variable index 2 has to match the first one which is 1"},
+		"Error in body": {"MACRO INC(a)\n  a := a + 2\nENDMACRO\nx1 := x1 + 1;\nINC(x1)",
+			"2:12: there has to follow a 1 after +/-, got \"2\" (in INC called at 5:1)"},
+		"Error in nested body": {"MACRO INC(a)\n  a := a + 2\nENDMACRO\nMACRO TWICE(b)\n  INC(b); INC(b)\nENDMACRO\nTWICE(x1)",
+			"2:12: there has to follow a 1 after +/-, got \"2\" (in INC called at 5:3, in TWICE called at 7:1)"},
+		"Arguments": {addMacro + "ADD(x0)",
+			"5:1: macro ADD expects 2 arguments, got 1"},
+		"Recursion": {"MACRO F(a)\n  F(a)\nENDMACRO\nF(x1)",
+			"2:3: recursive call of macro F (in F called at 4:1)"},
+		"Missing ENDMACRO": {"MACRO F(a)\n  a := a + 1\n",
+			"1:1: missing ENDMACRO for macro F"},
+		"Duplicate": {addMacro + addMacro + "ADD(x0, x1)",
+			"5:1: macro ADD is already defined"},
+		"Parameter is variable": {"MACRO F(x1)\nx1 := x1 + 1\nENDMACRO\nF(x2)",
+			"1:1: name x1 is a variable"},
+	}
+
+	for caseName, testCase := range tests {
+		_, _, err := ParseMacros(testCase.input)
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf("%s: expected error %q, got %v", caseName, testCase.expected, err)
+		}
+	}
+}
+
+func TestMacroPositions(t *testing.T) {
+	prog, smap, err := ParseMacros(addMacro + "x1 := x1 + 1;\nADD(x0, x1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The program starts by clearing the local t of ADD.
+	if clear := prog.SeqExpr.P1; statementString(clear) != "WHILE x2 != 0 DO" || clear.Pos != (Pos{5, 1}) {
+		t.Errorf("expected the local x2 to be cleared at 5:1, got %s at %s", statementString(clear), clear.Pos)
+	}
+	prog = prog.SeqExpr.P2
+
+	// The first loop of the expansion originates from the body of ADD.
+	loop := prog.SeqExpr.P2.SeqExpr.P1
+	if loop.Pos != (Pos{2, 3}) || loop.End != (Pos{2, 57}) {
+		t.Errorf("expected loop at 2:3-2:57, got %s-%s", loop.Pos, loop.End)
+	}
+	if first := prog.SeqExpr.P1; first.Pos != (Pos{5, 1}) || first.End != (Pos{5, 13}) {
+		t.Errorf("expected increment at 5:1-5:13, got %s-%s", first.Pos, first.End)
+	}
+
+	origin := smap.Lookup(Pos{7, 3})
+	if !strings.HasSuffix(origin.String(), "(in ADD called at 6:1)") {
+		t.Errorf("expected origin in ADD, got %s", origin)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Names maps the named variables of a program to the numbered registers of
+// the core language. Parsers of dialects with named variables create it, see
+// Dialect.Names.
+//
+// The optional header `INPUT a, b; OUTPUT r;` maps the input names to x1, x2,
+// ... and the output name to x0. All other names get the registers after the
+// inputs and after the variables used by their numbers, in the order of their
+// first appearance. Numbered variables can still be used, so x1 is the same
+// variable as the first input.
+type Names struct {
+	// Inputs are the names of the input variables x1, x2, ...
+	Inputs []string
+	// Output is the name of x0 or "" if the header has no OUTPUT.
+	Output string
+
+	// order contains the names in the order of their first appearance.
+	// While parsing, the name order[i] is represented by the variable -i-1.
+	order []string
+	ids   map[string]int
+	regs  map[string]int
+	names map[int]string
+}
+
+// newNames creates an empty mapping for a parser.
+func newNames() *Names {
+	return &Names{ids: make(map[string]int)}
+}
+
+// placeholder returns the negative variable representing name until the
+// registers are assigned by resolve.
+func (n *Names) placeholder(name string) int {
+	id, ok := n.ids[name]
+	if !ok {
+		n.order = append(n.order, name)
+		id = -len(n.order)
+		n.ids[name] = id
+	}
+	return id
+}
+
+// placeholderName returns the name represented by the variable v while
+// parsing or xv for numbered variables.
+func (n *Names) placeholderName(v int) string {
+	if v < 0 {
+		return n.order[-v-1]
+	}
+	return fmt.Sprintf("x%d", v)
+}
+
+// resolve assigns the registers to the names and replaces the placeholders
+// in e by them.
+func (n *Names) resolve(e *Expr) {
+	n.regs = make(map[string]int)
+	if n.Output != "" {
+		n.regs[n.Output] = 0
+	}
+	for i, name := range n.Inputs {
+		n.regs[name] = i + 1
+	}
+	next := maxVariable(e) + 1
+	if next <= len(n.Inputs) {
+		next = len(n.Inputs) + 1
+	}
+	for _, name := range n.order {
+		if _, ok := n.regs[name]; !ok {
+			n.regs[name] = next
+			next++
+		}
+	}
+
+	n.names = make(map[int]string)
+	for name, v := range n.regs {
+		n.names[v] = name
+	}
+	mapVariables(e, func(v int) int {
+		if v < 0 {
+			return n.regs[n.order[-v-1]]
+		}
+		return v
+	})
+}
+
+// Register returns the register of a name.
+func (n *Names) Register(name string) (int, bool) {
+	if n == nil {
+		return 0, false
+	}
+	v, ok := n.regs[name]
+	return v, ok
+}
+
+// Name returns the name of the register v or xv if it has no name. Like the
+// other methods it can be called on a nil Names, which has no names, so
+// programs of all dialects can be handled alike.
+func (n *Names) Name(v int) string {
+	if n != nil {
+		if name, ok := n.names[v]; ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("x%d", v)
+}
+
+// Replace replaces the registers like x3 in s by their names. It maps traces,
+// formatted programs and the messages of analyses back to the names of the
+// source code.
+func (n *Names) Replace(s string) string {
+	if n == nil {
+		return s
+	}
+	return variable.ReplaceAllStringFunc(s, func(reg string) string {
+		v, err := strconv.Atoi(variable.FindStringSubmatch(reg)[1])
+		if err != nil {
+			return reg
+		}
+		return n.Name(v)
+	})
+}
+
+// parseHeader parses the optional header `INPUT a, b; OUTPUT r;` of a program
+// with named variables.
+func (p *Parser) parseHeader() error {
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return p.errorf("error parsing header: %s", err)
+	}
+	seen := make(map[string]bool)
+	if tok == INPUT {
+		for tok != SEMICOLON {
+			name, err := p.parseName()
+			if err != nil {
+				return err
+			}
+			if seen[name] {
+				return p.errorf("duplicate input %s", name)
+			}
+			seen[name] = true
+			p.names.Inputs = append(p.names.Inputs, name)
+
+			if tok, lit, err = p.scanIgnoreWhitespace(); err != nil {
+				return p.errorf("error parsing header: %s", err)
+			}
+			if tok != COMMA && tok != SEMICOLON {
+				return p.errorf("expected COMMA or SEMICOLON, got %s", describeToken(tok, lit))
+			}
+		}
+		if tok, lit, err = p.scanIgnoreWhitespace(); err != nil {
+			return p.errorf("error parsing header: %s", err)
+		}
+	}
+	if tok != OUTPUT {
+		p.unscan()
+		return nil
+	}
+
+	name, err := p.parseName()
+	if err != nil {
+		return err
+	}
+	if seen[name] {
+		return p.errorf("%s is both input and output", name)
+	}
+	p.names.Output = name
+	_, err = p.expect(SEMICOLON)
+	return err
+}
+
+// parseName reads the name of a variable in the header.
+func (p *Parser) parseName() (string, error) {
+	name, err := p.expect(NAME)
+	if err != nil {
+		return "", err
+	}
+	p.names.placeholder(name)
+	return name, nil
+}
+
+// mapVariables replaces every variable v in e by f(v).
+func mapVariables(e *Expr, f func(int) int) {
+	Walk(e, func(e *Expr) bool {
+		switch e.Type {
+		case INCR_EXPR:
+			e.IncrExpr.Variable = f(e.IncrExpr.Variable)
+			if e.IncrExpr.General {
+				e.IncrExpr.Source = f(e.IncrExpr.Source)
+			}
+		case WHILE_EXPR:
+			e.WhileExpr.Variable = f(e.WhileExpr.Variable)
+		case ASSIGN_EXPR:
+			a := e.AssignExpr
+			a.Variable = f(a.Variable)
+			if a.Op != CONSTANT {
+				a.Source = f(a.Source)
+			}
+			if a.Op == TIMES {
+				a.Factor = f(a.Factor)
+			}
+		case IF_EXPR:
+			e.IfExpr.Variable = f(e.IfExpr.Variable)
+		case LOOP_EXPR:
+			e.LoopExpr.Variable = f(e.LoopExpr.Variable)
+		case CALL_EXPR:
+			for i, v := range e.CallExpr.Args {
+				e.CallExpr.Args[i] = f(v)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,160 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"strings"
+	"testing"
+)
+
+// namedAddProg computes r = a + b with named variables.
+const namedAddProg = `INPUT a, b; OUTPUT r;
+r := a + 0;
+WHILE b != 0 DO b := b - 1; r := r + 1 END`
+
+func mustParseNamed(t testing.TB, input string) (*Expr, *Names) {
+	p := NewParser(strings.NewReader(input), NamedDialect)
+	prog, err := p.Parse()
+	if err != nil {
+		t.Fatalf("error parsing %q: %s", input, err)
+	}
+	return prog, p.Names()
+}
+
+func TestNames(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		regs  map[string]int
+	}{
+		"Header": {namedAddProg, map[string]int{"r": 0, "a": 1, "b": 2}},
+		"Locals": {"INPUT n; OUTPUT r; tmp := n + 0; x5 := x5 + 1; r := tmp + 0; i := i + 1",
+			map[string]int{"r": 0, "n": 1, "tmp": 6, "i": 7}},
+		"Only output":   {"OUTPUT result; result := result + 1", map[string]int{"result": 0}},
+		"No header":     {"sum := sum + 1; x := sum + 2", map[string]int{"sum": 1, "x": 2}},
+		"Unused inputs": {"INPUT a, b, c; d := d + 1", map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}},
+	}
+
+	for caseName, testCase := range tests {
+		_, names := mustParseNamed(t, testCase.input)
+		for name, expected := range testCase.regs {
+			if v, ok := names.Register(name); !ok || v != expected {
+				t.Errorf("%s: expected %s to be x%d, got x%d, %t", caseName, name, expected, v, ok)
+			}
+			if got := names.Name(expected); got != name {
+				t.Errorf("%s: expected x%d to be named %s, got %s", caseName, expected, name, got)
+			}
+		}
+	}
+}
+
+func TestRunNamed(t *testing.T) {
+	prog, names := mustParseNamed(t, namedAddProg)
+	if got, err := Run(prog, 0, 3, 4); err != nil || got != 7 {
+		t.Errorf("expected 7, got %d, %v", got, err)
+	}
+	if strings.Join(names.Inputs, ",") != "a,b" || names.Output != "r" {
+		t.Errorf("expected inputs a,b and output r, got %v and %s", names.Inputs, names.Output)
+	}
+
+	expected, err := NewParser(strings.NewReader(
+		"x0 := x1 + 0; WHILE x2 != 0 DO x2 := x2 - 1; x0 := x0 + 1 END"), SchoeningDialect).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Format(prog), Format(expected); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestNamesReplace(t *testing.T) {
+	prog, names := mustParseNamed(t, namedAddProg)
+
+	expected := "r := a + 0;\nWHILE b != 0 DO\n  b := b - 1;\n  r := r + 1\nEND"
+	if got := names.Replace(Format(prog)); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	in := NewInterpreter(prog, 1, 1)
+	trace := NewTraceTail(in, 1)
+	in.Step()
+	entry := names.Replace(trace.Entries()[0].String())
+	if expected := "step 1 at 2:1: r := a + 0 [r=1 a=1 b=1]"; entry != expected {
+		t.Errorf("expected %q, got %q", expected, entry)
+	}
+
+	_, names = mustParseNamed(t, "INPUT n; i := i + 1; WHILE n != 0 DO i := i + 1 END")
+	if got, expected := names.Replace("x2 is not decremented, x1 and x0 and x10"), "i is not decremented, n and x0 and x10"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// Programs without names keep their registers.
+	names = nil
+	if got := names.Replace("x1 := x1 + 1"); got != "x1 := x1 + 1" || names.Name(3) != "x3" {
+		t.Errorf("expected registers without names, got %q and %s", got, names.Name(3))
+	}
+}
+
+func TestNamesErrors(t *testing.T) {
+	tests := map[string]struct {
+		dialect Dialect
+		input   string
+		msg     string
+	}{
+		"Strict":           {StrictDialect, "sum := sum + 1", "expected variable or WHILE"},
+		"Duplicate input":  {NamedDialect, "INPUT a, a; a := a + 1", "duplicate input a"},
+		"Input and output": {NamedDialect, "INPUT a; OUTPUT a; a := a + 1", "a is both input and output"},
+		"Numbered input":   {NamedDialect, "INPUT x1; x1 := x1 + 1", "expected NAME"},
+		"Missing comma":    {NamedDialect, "INPUT a b; a := a + 1", "expected COMMA or SEMICOLON"},
+		"Header only":      {NamedDialect, "INPUT a; OUTPUT r;", "expected expression"},
+		"Header in body":   {NamedDialect, "a := a + 1; INPUT a;", "expected variable or WHILE"},
+		"Different names": {Dialect{Names: true}, "sum := n + 1",
+			"second variable n has to match the first one which is sum"},
+		"Undefined variable": {NamedDialect, "INPUT a; OUTPUT r; r := a + q", "1:29: undefined variable q"},
+		"Added variable":     {NamedDialect, "INPUT a, q; OUTPUT r; r := a + q", "expected CONSTANT, got variable q"},
+		"GOTO":               {NamedDialect, "M1: a := a + 1", "GOTO programs can not have named variables"},
+	}
+
+	for caseName, testCase := range tests {
+		p := NewParser(strings.NewReader(testCase.input), testCase.dialect)
+		var err error
+		if caseName == "GOTO" {
+			_, err = p.ParseGoto()
+		} else {
+			_, err = p.Parse()
+		}
+		if err == nil || !strings.Contains(err.Error(), testCase.msg) {
+			t.Errorf("%s: expected error containing %q, got %v", caseName, testCase.msg, err)
+		}
+	}
+}
+
+func TestNamesMacros(t *testing.T) {
+	prog, smap, err := ParseMacrosWith("INPUT a, b; OUTPUT r;\nMUL(r, a, b)", NamedDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := smap.Names.Register("b"); !ok || v != 2 {
+		t.Errorf("expected b to be x2, got x%d, %t", v, ok)
+	}
+	if got, err := Run(prog, 0, 3, 4); err != nil || got != 12 {
+		t.Errorf("expected 12, got %d, %v", got, err)
+	}
+}
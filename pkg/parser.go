@@ -21,7 +21,6 @@
 package whilego
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -35,23 +34,48 @@ const (
 	// INVALID_EXPR indicates an invalid expression
 	INVALID_EXPR ExprType = iota
 
-	// INCR_EXPR indicates an expression of the from `xN := xN +/- 1`
+	// INCR_EXPR indicates an expression of the from `xN := xN +/- 1` or, if
+	// enabled by the dialect, `xN := xM +/- c`
 	INCR_EXPR
 
 	// SEQ_EXPR indicates a sequence of two expressions, e.g. `P1;P2`
 	SEQ_EXPR
 	// WHILE_EXPR indicates an expression of the from `WHILE xN != 0 DO P END`
 	WHILE_EXPR
+
+	// The following expressions are only part of the sugar dialect. They have
+	// to be replaced using Desugar before a program can be interpreted.
+
+	// ASSIGN_EXPR indicates an assignment like `xN := c`, `xN := xM + c` or
+	// `xN := xM * xK`
+	ASSIGN_EXPR
+	// IF_EXPR indicates an expression of the form
+	// `IF xN = 0 THEN P ELSE Q END`
+	IF_EXPR
+	// LOOP_EXPR indicates an expression of the form `LOOP xN DO P END`
+	LOOP_EXPR
+
+	// CALL_EXPR indicates a procedure call like `ADD(x1, x2, x0)` in a
+	// module. Calls are inlined by Link.
+	CALL_EXPR
 )
 
 // Expr is an expression of the WHILE language.
 // TODO: Maybe Refactor? (Composition?, Reflection?, Inheritance?)
 type Expr struct {
 	Type ExprType
-
-	IncrExpr  *IncrExpr
-	SeqExpr   *SeqExpr
-	WhileExpr *WhileExpr
+	// Pos is the position of the expression in the source code.
+	Pos Pos
+	// End is the position right after the expression.
+	End Pos
+
+	IncrExpr   *IncrExpr
+	SeqExpr    *SeqExpr
+	WhileExpr  *WhileExpr
+	AssignExpr *AssignExpr
+	IfExpr     *IfExpr
+	LoopExpr   *LoopExpr
+	CallExpr   *CallExpr
 }
 
 // String returns a simple string representation of the expression.
@@ -69,6 +93,19 @@ func (e Expr) String() string {
 		s += fmt.Sprintf("P1: %s, P2: %s", e.SeqExpr.P1, e.SeqExpr.P2)
 	case WHILE_EXPR:
 		s += "WhileExpr: "
+		s += fmt.Sprintf("Variable: %d, P: %s", e.WhileExpr.Variable, e.WhileExpr.P)
+	case ASSIGN_EXPR:
+		s += "AssignExpr: "
+		s += fmt.Sprint(e.AssignExpr)
+	case IF_EXPR:
+		s += "IfExpr: "
+		s += fmt.Sprintf("Variable: %d, Then: %s, Else: %v", e.IfExpr.Variable, e.IfExpr.Then, e.IfExpr.Else)
+	case LOOP_EXPR:
+		s += "LoopExpr: "
+		s += fmt.Sprintf("Variable: %d, P: %s", e.LoopExpr.Variable, e.LoopExpr.P)
+	case CALL_EXPR:
+		s += "CallExpr: "
+		s += fmt.Sprint(e.CallExpr)
 	default:
 		s += "Unknown: "
 	}
@@ -77,12 +114,55 @@ func (e Expr) String() string {
 	return s
 }
 
-// IncrExpr represents a expression in the form `xN := xN +/- 1`
+// Walk traverses the expression e in source order. It calls fn for e and,
+// if fn returns true, for all of its subexpressions.
+func Walk(e *Expr, fn func(*Expr) bool) {
+	if !fn(e) {
+		return
+	}
+	switch e.Type {
+	case SEQ_EXPR:
+		Walk(e.SeqExpr.P1, fn)
+		Walk(e.SeqExpr.P2, fn)
+	case WHILE_EXPR:
+		Walk(e.WhileExpr.P, fn)
+	case IF_EXPR:
+		Walk(e.IfExpr.Then, fn)
+		if e.IfExpr.Else != nil {
+			Walk(e.IfExpr.Else, fn)
+		}
+	case LOOP_EXPR:
+		Walk(e.LoopExpr.P, fn)
+	}
+}
+
+// IncrExpr represents a expression in the form `xN := xN +/- 1`.
+//
+// Generalised increment expressions have the form `xN := xM +/- c` with an
+// arbitrary source variable M and natural constant c. They are only accepted
+// by parsers of dialects with assignments, see Dialect.Assign.
 type IncrExpr struct {
 	// The number of the variable in range {0, ...}
 	Variable int
 	// true means decrement, false increment
 	Decrement bool
+
+	// General marks a generalised increment expression. Source and
+	// Constant are only used if it is set.
+	General bool
+	// Source is the variable M.
+	Source int
+	// Constant is the constant c.
+	Constant uint64
+}
+
+// operands returns the source variable and the constant of the expression,
+// which are N and 1 for the minimal form.
+func (e *IncrExpr) operands() (int, uint64) {
+	if !e.General {
+		return e.Variable, 1
+	}
+	return e.Source, e.Constant
 }
 
 // SeqExpr represents a sequence of two expressions, e.g. `P1;P2`
@@ -101,22 +181,92 @@ type WhileExpr struct {
 	P *Expr
 }
 
+// AssignExpr represents an assignment of the sugar dialect. Depending on Op
+// it has one of the forms
+//
+//	CONSTANT  `xN := c`
+//	PLUS      `xN := xM + c`
+//	MINUS     `xN := xM - c`
+//	TIMES     `xN := xM * xK`
+//
+// `xN := xM` is an addition of 0.
+type AssignExpr struct {
+	// Variable is the assigned variable N.
+	Variable int
+	Op       Token
+	// Source is the variable M.
+	Source int
+	// Factor is the variable K.
+	Factor   int
+	Constant uint64
+}
+
+// IfExpr represents an expression of the form `IF xN = 0 THEN P ELSE Q END`.
+type IfExpr struct {
+	// Variable is the variable N to check `xN = 0` for.
+	Variable int
+	// Then is the program to run if `xN = 0` is true.
+	Then *Expr
+	// Else is the program to run otherwise. It is nil if there is no ELSE.
+	Else *Expr
+}
+
+// LoopExpr represents an expression of the form `LOOP xN DO P END`, which
+// runs P as many times as the value of xN before the loop.
+type LoopExpr struct {
+	// Variable is the variable N containing the number of iterations.
+	Variable int
+	// P is the program to repeat.
+	P *Expr
+
+	// loop and remaining are only set for the running loops on the stack of
+	// an interpreter. loop is the LOOP expression and remaining the number of
+	// iterations left.
+	loop      *Expr
+	remaining uint64
+}
+
+// CallExpr represents a procedure call `NAME(xA, xB, ..., xR)`, which passes
+// the values of the input arguments and assigns the result to the last one.
+type CallExpr struct {
+	Name string
+	Args []int
+}
+
 // Parser represents a parser for the WHILE language.
 type Parser struct {
 	s *Scanner
+	// d is the dialect of the parsed programs.
+	d Dialect
+	// names are the named variables if the dialect has them.
+	names *Names
+	// module enables procedure calls, see ParseModule.
+	module bool
 	// Buffer for lookahead
 	buf struct {
 		tok Token  // last read token
 		lit string // last read literal
+		pos Pos    // position of the last read token
+		end Pos    // position after the last read token
 		n   int    // buffer size(max=1)
 	}
 }
 
-// NewParser creates a new instance of a WHILE parser.
-func NewParser(r io.Reader) *Parser {
-	return &Parser{s: NewScanner(r)}
+// NewParser creates a new instance of a WHILE parser. An optional dialect
+// selects the accepted notation, by default it is the strict core language.
+func NewParser(r io.Reader, dialect ...Dialect) *Parser {
+	d := firstDialect(dialect)
+	p := &Parser{s: NewScanner(r, d), d: d}
+	if d.Names {
+		p.names = newNames()
+	}
+	return p
 }
 
+// Names returns the named variables of the parsed program or nil if the
+// dialect has no named variables.
+func (p *Parser) Names() *Names { return p.names }
+
 // scan returns the next token from the scanner.
 // If a token was unscanned, it will return the buffered one instead.
 // In case of an error it will also return the error as the third value.
@@ -130,6 +280,7 @@ func (p *Parser) scan() (tok Token, lit string, err error) {
 	// Write token into buffer in case we unscan later
 	tok, lit, err = p.s.Scan()
 	p.buf.tok, p.buf.lit = tok, lit
+	p.buf.pos, p.buf.end = p.s.Pos(), p.s.End()
 
 	// This returns the values we have written to tok, lit and err
 	return
@@ -154,106 +305,203 @@ func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string, err error) {
 	return
 }
 
+// Error is a syntax error at a position in the source code.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+// Error returns the message prefixed with the position.
+func (e *Error) Error() string { return fmt.Sprintf("%s: %s", e.Pos, e.Msg) }
+
+// errorf returns an error at the position of the last read token.
+func (p *Parser) errorf(format string, a ...interface{}) error {
+	return &Error{p.buf.pos, fmt.Sprintf(format, a...)}
+}
+
+// describeToken returns a description of a token for error messages.
+func describeToken(tok Token, lit string) string {
+	if tok == EOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%s \"%s\"", tok, lit)
+}
+
 // Parse parses the input, given to the parser using the reader.
 func (p *Parser) Parse() (*Expr, error) {
-	ex1 := &Expr{}
-	ex2 := &Expr{}
-	var expr *Expr
+	if p.names != nil {
+		if err := p.parseHeader(); err != nil {
+			return nil, err
+		}
+	}
+	expr, err := p.parseSeq()
+	if err != nil {
+		return nil, err
+	}
 
-	tok, _, err := p.scanIgnoreWhitespace()
+	// The whole input has to be consumed by the program.
+	tok, lit, err := p.scanIgnoreWhitespace()
 	if err != nil {
-		return expr, fmt.Errorf("error tokenizing: %s", err)
+		return nil, p.errorf("error tokenizing: %s", err)
+	}
+	if tok != EOF {
+		return nil, p.errorf("unexpected %s after end of program", describeToken(tok, lit))
 	}
 
-	// TODO: WhileExpr
+	if p.names != nil {
+		p.names.resolve(expr)
+	}
+	return expr, nil
+}
+
+// parseSeq parses a sequence of expressions separated by semicolons.
+// Sequences are nested to the right, so `P1;P2;P3` becomes `P1;(P2;P3)`.
+func (p *Parser) parseSeq() (*Expr, error) {
+	ex1, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
 
-	// Base case: assignment
-	if tok == VARIABLE {
+	tok, _, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, p.errorf("error tokenizing: %s", err)
+	}
+	if tok != SEMICOLON {
 		p.unscan()
-		incExpr, err := p.parseIncr()
-		if err != nil {
-			return nil, err
-		}
-		ex1.Type = INCR_EXPR
-		ex1.IncrExpr = incExpr
-		expr = ex1
+		return ex1, nil
 	}
 
-	tok, _, err = p.scanIgnoreWhitespace()
-	// TODO: Check if following condition is sane
-	if tok == ILLEGAL || tok == EOF {
-		return expr, nil
+	// Try to parse the following expression
+	ex2, err := p.parseSeq()
+	if err != nil {
+		return nil, err
 	}
+	return &Expr{Type: SEQ_EXPR, Pos: ex1.Pos, End: ex2.End, SeqExpr: &SeqExpr{ex1, ex2}}, nil
+}
+
+// parseStatement parses a single statement. In the core language this is an
+// increment or while expression.
+func (p *Parser) parseStatement() (*Expr, error) {
+	tok, lit, err := p.scanIgnoreWhitespace()
 	if err != nil {
-		return nil, fmt.Errorf("error tokenizing after ws: %s", err)
+		return nil, p.errorf("error tokenizing: %s", err)
+	}
+	pos := p.buf.pos
+	p.unscan()
+	if tok == NAME && p.names != nil {
+		tok = VARIABLE
 	}
 
-	// If there is a semicolon following the assignment
-	if tok == SEMICOLON {
-		// Try to parse the following expression
-		ex2, err = p.Parse()
+	switch {
+	case tok == VARIABLE && (p.d.Sugar || p.d.Assign):
+		return p.parseAssign()
+	case tok == IF && p.d.Sugar:
+		ifExpr, err := p.parseIf()
 		if err != nil {
-			return nil,
-				fmt.Errorf("no valid expression after semicolon: %s", err)
+			return nil, err
 		}
-		expr = &Expr{}
-		expr.Type = SEQ_EXPR
-		expr.SeqExpr = &SeqExpr{ex1, ex2}
+		return &Expr{Type: IF_EXPR, Pos: pos, End: p.buf.end, IfExpr: ifExpr}, nil
+	case tok == LOOP && (p.d.Sugar || p.d.Loop):
+		loopExpr, err := p.parseLoop()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Type: LOOP_EXPR, Pos: pos, End: p.buf.end, LoopExpr: loopExpr}, nil
+	case tok == VARIABLE:
+		incrExpr, err := p.parseIncr()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Type: INCR_EXPR, Pos: pos, End: p.buf.end, IncrExpr: incrExpr}, nil
+	case tok == WHILE && !p.d.Loop:
+		whileExpr, err := p.parseWhile()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Type: WHILE_EXPR, Pos: pos, End: p.buf.end, WhileExpr: whileExpr}, nil
+	case tok == IDENT && p.module:
+		callExpr, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Type: CALL_EXPR, Pos: pos, End: p.buf.end, CallExpr: callExpr}, nil
+	case tok == EOF:
+		return nil, p.errorf("expected expression, got end of file")
+	case p.d.Sugar:
+		return nil, p.errorf("expected variable, WHILE, IF or LOOP, got %s", describeToken(tok, lit))
+	case p.d.Loop:
+		return nil, p.errorf("expected variable or LOOP, got %s", describeToken(tok, lit))
 	}
 
-	return expr, nil
+	return nil, p.errorf("expected variable or WHILE, got %s", describeToken(tok, lit))
 }
 
-// parseIncr parses the increment expression of the WHILE language.
-func (p *Parser) parseIncr() (*IncrExpr, error) {
-	incrExpr := &IncrExpr{}
-
-	// Read left side variable.
-	// TODO: Introduce helpers for error reporting
+// parseVariable reads a variable and returns its number.
+func (p *Parser) parseVariable() (int, error) {
 	tok, lit, err := p.scanIgnoreWhitespace()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing left side variable: %s", err)
+		return 0, p.errorf("error parsing variable: %s", err)
+	}
+	if tok == NAME && p.names != nil {
+		return p.names.placeholder(lit), nil
 	}
 	if tok != VARIABLE {
-		return nil, errors.New("initial token of increment has to be a variable")
+		return 0, p.errorf("expected variable, got %s", describeToken(tok, lit))
 	}
-	firstVarNum, err := strconv.Atoi(strings.TrimPrefix(lit, "x"))
+	num, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(lit, "x"), "_"))
 	if err != nil {
-		return nil, fmt.Errorf("error parsing variable number: %s", err)
+		return 0, p.errorf("error parsing variable number: %s", err)
 	}
-	incrExpr.Variable = firstVarNum
+	return num, nil
+}
 
-	// Check if a assignment token follows
-	tok, lit, err = p.scanIgnoreWhitespace()
+// expect reads the next token and checks that it is of the expected type.
+func (p *Parser) expect(expected Token) (string, error) {
+	tok, lit, err := p.scanIgnoreWhitespace()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing equal sign: %s", err)
+		return "", p.errorf("error parsing %s: %s", expected, err)
 	}
-	if tok != ASSIGN {
-		return nil, fmt.Errorf("expected assignment operator after variable")
+	if tok != expected {
+		return "", p.errorf("expected %s, got %s", expected, describeToken(tok, lit))
 	}
+	return lit, nil
+}
 
-	// Read right side variable.
-	tok, lit, err = p.scanIgnoreWhitespace()
+// parseIncr parses the increment expression of the WHILE language.
+func (p *Parser) parseIncr() (*IncrExpr, error) {
+	incrExpr := &IncrExpr{}
+
+	// Read left side variable.
+	firstVarNum, err := p.parseVariable()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing left side variable: %s", err)
+		return nil, err
 	}
-	if tok != VARIABLE {
-		return nil, errors.New("initial token of increment has to be a variable")
+	incrExpr.Variable = firstVarNum
+
+	// Check if a assignment token follows
+	if _, err = p.expect(ASSIGN); err != nil {
+		return nil, err
 	}
-	secondVarNum, err := strconv.Atoi(strings.TrimPrefix(lit, "x"))
+
+	// Read right side variable.
+	secondVarNum, err := p.parseVariable()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing variable number: %s", err)
+		return nil, err
+	}
+	if firstVarNum != secondVarNum && (firstVarNum < 0 || secondVarNum < 0) {
+		return nil, p.errorf("second variable %s has to match the first one which is %s",
+			p.names.placeholderName(secondVarNum), p.names.placeholderName(firstVarNum))
 	}
 	if firstVarNum != secondVarNum {
 		return nil,
-			fmt.Errorf("second variable index %d has to match the first one which is %d",
-				firstVarNum, secondVarNum)
+			p.errorf("second variable index %d has to match the first one which is %d",
+				secondVarNum, firstVarNum)
 	}
 
 	// Determine increment or decrement
-	tok, lit, err = p.scanIgnoreWhitespace()
+	tok, lit, err := p.scanIgnoreWhitespace()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing increment/decrement: %s", err)
+		return nil, p.errorf("error parsing increment/decrement: %s", err)
 	}
 	switch tok {
 	case PLUS:
@@ -261,17 +509,74 @@ func (p *Parser) parseIncr() (*IncrExpr, error) {
 	case MINUS:
 		incrExpr.Decrement = true
 	default:
-		return nil, fmt.Errorf("token \"%s\" has to be - or + sign", lit)
+		return nil, p.errorf("token \"%s\" has to be - or + sign", lit)
 	}
 
 	// Make sure there is a 1 following the +/- sign
 	tok, lit, err = p.scanIgnoreWhitespace()
 	if err != nil {
-		return nil, fmt.Errorf("error parsing number after increment/decrement: %s", err)
+		return nil, p.errorf("error parsing number after increment/decrement: %s", err)
 	}
 	if tok != CONSTANT || lit != "1" {
-		return nil, fmt.Errorf("there has to follow a 1 after +/-, got \"%s\"", lit)
+		return nil, p.errorf("there has to follow a 1 after +/-, got \"%s\"", lit)
 	}
 
 	return incrExpr, nil
 }
+
+// parseWhile parses the while expression `WHILE xN != 0 DO P END`.
+func (p *Parser) parseWhile() (*WhileExpr, error) {
+	whileExpr := &WhileExpr{}
+
+	if _, err := p.expect(WHILE); err != nil {
+		return nil, err
+	}
+
+	// Read the condition xN != 0.
+	varNum, err := p.parseVariable()
+	if err != nil {
+		return nil, err
+	}
+	whileExpr.Variable = varNum
+	if _, err = p.expect(NOTEQUAL); err != nil {
+		return nil, err
+	}
+	lit, err := p.expect(CONSTANT)
+	if err != nil {
+		return nil, err
+	}
+	if lit != "0" {
+		return nil, p.errorf("while condition has to compare with 0, got \"%s\"", lit)
+	}
+
+	// Read the loop body.
+	if _, err = p.expect(DO); err != nil {
+		return nil, err
+	}
+	whileExpr.P, err = p.parseSeq()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expectLoopEnd(); err != nil {
+		return nil, err
+	}
+
+	return whileExpr, nil
+}
+
+// expectLoopEnd reads the END of a loop, which may also be OD depending on
+// the dialect.
+func (p *Parser) expectLoopEnd() error {
+	if !p.d.OD {
+		_, err := p.expect(END)
+		return err
+	}
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return p.errorf("error parsing %s: %s", END, err)
+	}
+	if tok != END && tok != OD {
+		return p.errorf("expected END or OD, got %s", describeToken(tok, lit))
+	}
+	return nil
+}
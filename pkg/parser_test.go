@@ -27,7 +27,7 @@ import (
 )
 
 func makeIncrExpr(v int, dec bool) Expr {
-	incrExpr := &IncrExpr{v, dec}
+	incrExpr := &IncrExpr{Variable: v, Decrement: dec}
 	return Expr{Type: INCR_EXPR, IncrExpr: incrExpr}
 }
 
@@ -36,6 +36,20 @@ func makeSeqExpr(p1, p2 *Expr) Expr {
 	return Expr{Type: SEQ_EXPR, SeqExpr: incrExpr}
 }
 
+func makeWhileExpr(v int, p *Expr) Expr {
+	whileExpr := &WhileExpr{v, p}
+	return Expr{Type: WHILE_EXPR, WhileExpr: whileExpr}
+}
+
+// clearPos removes all positions from the expression so it can be compared
+// to hand-built expressions.
+func clearPos(e *Expr) {
+	Walk(e, func(e *Expr) bool {
+		e.Pos, e.End = Pos{}, Pos{}
+		return true
+	})
+}
+
 func TestParse(t *testing.T) {
 	type TestCase struct {
 		input    string
@@ -44,12 +58,21 @@ func TestParse(t *testing.T) {
 
 	incrX1 := makeIncrExpr(1, false)
 	decrX1 := makeIncrExpr(1, true)
+	incrX2 := makeIncrExpr(2, false)
+	seqX1X2 := makeSeqExpr(&decrX1, &incrX2)
 	tests := map[string]TestCase{
 		"Increment x1":  {"x1 := x1 + 1", incrX1},
 		"Decrement x1":  {"x1 := x1 - 1", decrX1},
 		"Increment x42": {"x42 := x42 + 1", makeIncrExpr(42, false)},
 		"Decrement x42": {"x42 := x42 - 1", makeIncrExpr(42, true)},
 		"x1++;x1--":     {"x1 := x1 + 1 ; x1 := x1 - 1", makeSeqExpr(&incrX1, &decrX1)},
+		"x1++;x1--;x2++": {"x1 := x1 + 1; x1 := x1 - 1; x2 := x2 + 1",
+			makeSeqExpr(&incrX1, &seqX1X2)},
+		"While": {"WHILE x1 != 0 DO x1 := x1 - 1 END", makeWhileExpr(1, &decrX1)},
+		"While with sequence": {"WHILE x1 != 0 DO x1 := x1 - 1; x2 := x2 + 1 END",
+			makeWhileExpr(1, &seqX1X2)},
+		"Sequence after while": {"WHILE x1 != 0 DO x1 := x1 - 1 END; x2 := x2 + 1",
+			makeSeqExpr(&Expr{Type: WHILE_EXPR, WhileExpr: &WhileExpr{1, &decrX1}}, &incrX2)},
 	}
 
 	for caseName, testCase := range tests {
@@ -59,7 +82,9 @@ func TestParse(t *testing.T) {
 		expr, err := parser.Parse()
 		if err != nil {
 			t.Errorf("%s: %s", caseName, err)
+			continue
 		}
+		clearPos(expr)
 		gotExpr := *expr
 		if !reflect.DeepEqual(gotExpr, testCase.expected) {
 			// TODO: Implement Stringer for Expr
@@ -67,3 +92,52 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"Empty":              "",
+		"Different variable": "x1 := x2 + 1",
+		"Constant 0":         "x1 := x1 + 0",
+		"Trailing semicolon": "x1 := x1 + 1;",
+		"Missing END":        "WHILE x1 != 0 DO x1 := x1 - 1",
+		"Compare with 1":     "WHILE x1 != 1 DO x1 := x1 - 1 END",
+		"Empty body":         "WHILE x1 != 0 DO END",
+		"Garbage at end":     "x1 := x1 + 1 x2",
+		"Large constant":     "x1 := x1 + 12",
+		"Sugar assignment":   "x1 := 5",
+		"Sugar IF":           "IF x1 = 0 THEN x1 := x1 + 1 END",
+	}
+
+	for caseName, input := range tests {
+		parser := NewParser(strings.NewReader(input))
+		if expr, err := parser.Parse(); err == nil {
+			t.Errorf("%s: expected error, got %s", caseName, expr)
+		}
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	input := "x1 := x1 + 1;\nWHILE x1 != 0 DO\n  x1 := x1 - 1\nEND"
+	expr, err := NewParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	while := expr.SeqExpr.P2
+	tests := map[string]struct {
+		expr       *Expr
+		start, end Pos
+	}{
+		"Sequence":  {expr, Pos{1, 1}, Pos{4, 4}},
+		"Increment": {expr.SeqExpr.P1, Pos{1, 1}, Pos{1, 13}},
+		"While":     {while, Pos{2, 1}, Pos{4, 4}},
+		"Body":      {while.WhileExpr.P, Pos{3, 3}, Pos{3, 15}},
+	}
+
+	for caseName, testCase := range tests {
+		if testCase.expr.Pos != testCase.start || testCase.expr.End != testCase.end {
+			t.Errorf("%s: expected range %s-%s, got %s-%s", caseName,
+				testCase.start, testCase.end, testCase.expr.Pos, testCase.expr.End)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// The pprof format is a gzip compressed protocol buffer described in
+// https://github.com/google/pprof/blob/master/proto/profile.proto.
+// Only the few message types needed here are encoded by hand to avoid a
+// dependency on a protocol buffer library.
+
+// Field numbers of the pprof protocol buffer messages.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// protoBuffer encodes protocol buffer messages.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+// uint64Field encodes a varint field, which is also used for int64 values.
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+// bytesField encodes a length delimited field.
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+// packedField encodes a repeated varint field.
+func (b *protoBuffer) packedField(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytesField(field, packed.buf)
+}
+
+// WritePprof writes the profile in the pprof format to w, so it can be
+// viewed with `go tool pprof`. Every statement is a function in the profile
+// and the enclosing loops form its call stack. filename is used as the
+// source file of the functions.
+func (p *Profile) WritePprof(w io.Writer, filename string) error {
+	var prof protoBuffer
+
+	// The string table has to start with the empty string.
+	stringTable := []string{""}
+	indices := make(map[string]uint64)
+	str := func(s string) uint64 {
+		if i, ok := indices[s]; ok {
+			return i
+		}
+		indices[s] = uint64(len(stringTable))
+		stringTable = append(stringTable, s)
+		return indices[s]
+	}
+
+	var sampleType protoBuffer
+	sampleType.uint64Field(valueTypeType, str("executions"))
+	sampleType.uint64Field(valueTypeUnit, str("count"))
+	prof.bytesField(profileSampleType, sampleType.buf)
+
+	file := str(filename)
+	ids := make(map[*Expr]uint64)
+	for i, e := range p.stmts {
+		id := uint64(i + 1)
+		ids[e] = id
+		line := uint64(e.Pos.Line)
+
+		var function protoBuffer
+		function.uint64Field(functionID, id)
+		function.uint64Field(functionName, str(e.Pos.String()+" "+statementString(e)))
+		function.uint64Field(functionFilename, file)
+		function.uint64Field(functionStartLine, line)
+		prof.bytesField(profileFunction, function.buf)
+
+		var ln protoBuffer
+		ln.uint64Field(lineFunctionID, id)
+		ln.uint64Field(lineLine, line)
+		var location protoBuffer
+		location.uint64Field(locationID, id)
+		location.bytesField(locationLine, ln.buf)
+		prof.bytesField(profileLocation, location.buf)
+	}
+
+	for _, e := range p.stmts {
+		if p.counts[e] == 0 {
+			continue
+		}
+		stack := []uint64{ids[e]}
+		for _, loop := range p.loops[e] {
+			stack = append(stack, ids[loop])
+		}
+		var sample protoBuffer
+		sample.packedField(sampleLocationID, stack)
+		sample.packedField(sampleValue, []uint64{p.counts[e]})
+		prof.bytesField(profileSample, sample.buf)
+	}
+
+	for _, s := range stringTable {
+		prof.bytesField(profileStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(prof.buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
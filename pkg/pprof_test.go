@@ -0,0 +1,99 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+// decodeFields decodes the top level fields of a protocol buffer message and
+// returns the length delimited fields by field number.
+func decodeFields(t *testing.T, data []byte) map[int][][]byte {
+	varint := func() uint64 {
+		var x uint64
+		for shift := uint(0); ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatal("unexpected end of message")
+			}
+			b := data[0]
+			data = data[1:]
+			x |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return x
+			}
+		}
+	}
+
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key := varint()
+		switch key & 7 {
+		case 0:
+			varint()
+		case 2:
+			n := varint()
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestWritePprof(t *testing.T) {
+	_, prof := profileOf(t, mulProg, 2, 2)
+
+	var buf bytes.Buffer
+	if err := prof.WritePprof(&buf, "mul.while"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := decodeFields(t, data)
+	if n := len(fields[profileFunction]); n != 9 {
+		t.Errorf("expected a function for each of the 9 statements, got %d", n)
+	}
+	if n := len(fields[profileSample]); n != 9 {
+		t.Errorf("expected 9 samples, got %d", n)
+	}
+	strs := fields[profileStringTable]
+	if len(strs) == 0 || len(strs[0]) != 0 {
+		t.Fatalf("string table has to start with the empty string")
+	}
+	found := false
+	for _, s := range strs {
+		found = found || string(s) == "3:34 x0 := x0 + 1"
+	}
+	if !found {
+		t.Errorf("expected function name for x0 := x0 + 1 in string table")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Profile counts how often every expression of a program was executed.
+// It implements Tracer, so it can be attached to an interpreter.
+//
+// For increment expressions the count is the number of executions, for while
+// expressions it is the number of iterations, i.e. how often the body was
+// entered.
+type Profile struct {
+	// Steps is the total number of steps executed.
+	Steps int
+
+	stmts  []*Expr
+	counts map[*Expr]uint64
+	// loops maps every statement to its enclosing loops, innermost first.
+	loops map[*Expr][]*Expr
+}
+
+// NewProfile creates an empty profile for prog.
+func NewProfile(prog *Expr) *Profile {
+	p := &Profile{counts: make(map[*Expr]uint64), loops: make(map[*Expr][]*Expr)}
+	p.addStatements(prog, nil)
+	return p
+}
+
+// addStatements collects the increment, while and LOOP expressions of e.
+func (p *Profile) addStatements(e *Expr, loops []*Expr) {
+	switch e.Type {
+	case INCR_EXPR:
+		p.stmts = append(p.stmts, e)
+		p.loops[e] = loops
+	case SEQ_EXPR:
+		p.addStatements(e.SeqExpr.P1, loops)
+		p.addStatements(e.SeqExpr.P2, loops)
+	case WHILE_EXPR, LOOP_EXPR:
+		p.stmts = append(p.stmts, e)
+		p.loops[e] = loops
+		inner := append([]*Expr{e}, loops...)
+		p.addStatements(loopBody(e), inner)
+	}
+}
+
+// Step counts the execution of e.
+func (p *Profile) Step(e *Expr, cond bool) {
+	p.Steps++
+	if e.Type == INCR_EXPR || cond {
+		p.counts[e]++
+	}
+}
+
+// Count returns the number of executions of an increment expression or the
+// number of iterations of a while expression.
+func (p *Profile) Count(e *Expr) uint64 { return p.counts[e] }
+
+// Statements returns the increment and while expressions of the program in
+// source order.
+func (p *Profile) Statements() []*Expr { return p.stmts }
+
+// WriteListing writes the source code annotated with the counts of its
+// statements to w. A line gets the most executions of its increments and the
+// most iterations of its loops, so lines expanded from macros, sugar or
+// procedures into many statements still get a single count.
+func (p *Profile) WriteListing(w io.Writer, src []byte) error {
+	// Collect the highest counts for every line.
+	type lineCount struct {
+		execs, iters uint64
+		hasExecs     bool
+		hasIters     bool
+	}
+	lineCounts := make(map[int]*lineCount)
+	for _, e := range p.stmts {
+		lc := lineCounts[e.Pos.Line]
+		if lc == nil {
+			lc = &lineCount{}
+			lineCounts[e.Pos.Line] = lc
+		}
+		if count := p.counts[e]; isLoop(e) {
+			lc.hasIters = true
+			if count > lc.iters {
+				lc.iters = count
+			}
+		} else {
+			lc.hasExecs = true
+			if count > lc.execs {
+				lc.execs = count
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%12s  %s\n", "count", "line (x marks loop iterations)")
+	lines := strings.Split(strings.TrimRight(string(src), "\n"), "\n")
+	for i, line := range lines {
+		var counts []string
+		if lc := lineCounts[i+1]; lc != nil {
+			if lc.hasExecs {
+				counts = append(counts, fmt.Sprint(lc.execs))
+			}
+			if lc.hasIters {
+				counts = append(counts, fmt.Sprintf("%dx", lc.iters))
+			}
+		}
+		fmt.Fprintf(bw, "%12s %4d  %s\n", strings.Join(counts, " "), i+1, line)
+	}
+	fmt.Fprintf(bw, "%d steps\n", p.Steps)
+	return bw.Flush()
+}
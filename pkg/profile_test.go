@@ -0,0 +1,101 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func profileOf(t *testing.T, input string, args ...uint64) (*Expr, *Profile) {
+	prog := mustParse(t, input)
+	prof := NewProfile(prog)
+	in := NewInterpreter(prog, args...)
+	in.SetTracer(prof)
+	if err := in.Run(0); err != nil {
+		t.Fatal(err)
+	}
+	return prog, prof
+}
+
+func TestProfileCounts(t *testing.T) {
+	for n := uint64(0); n < 5; n++ {
+		_, prof := profileOf(t, mulProg, n, n)
+
+		// The statements of the program in source order.
+		stmts := prof.Statements()
+		expected := []uint64{n, n, n * n, n * n, n * n, n * n, n * n, n * n, n * n}
+		if len(stmts) != len(expected) {
+			t.Fatalf("expected %d statements, got %d", len(expected), len(stmts))
+		}
+		for i, e := range stmts {
+			if prof.Count(e) != expected[i] {
+				t.Errorf("n = %d: statement %d at %s: expected count %d, got %d",
+					n, i, e.Pos, expected[i], prof.Count(e))
+			}
+		}
+	}
+}
+
+func TestProfileListing(t *testing.T) {
+	_, prof := profileOf(t, addProg, 2, 3)
+
+	var buf bytes.Buffer
+	if err := prof.WriteListing(&buf, []byte(addProg)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	expected := []string{
+		"2 2x    1  WHILE x1 != 0 DO",
+		"3 3x    2  WHILE x2 != 0 DO",
+		"17 steps",
+	}
+	for i, exp := range expected {
+		if !strings.Contains(lines[i+1], exp) {
+			t.Errorf("line %d: expected %q in %q", i+1, exp, lines[i+1])
+		}
+	}
+}
+
+func TestProfileListingMacros(t *testing.T) {
+	// The statements expanded from a macro share one count.
+	src := "MUL(x0, x1, x2)"
+	prog, _, err := ParseMacros(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof := NewProfile(prog)
+	in := NewInterpreter(prog, 3, 4)
+	in.SetTracer(prof)
+	if err := in.Run(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := prof.WriteListing(&buf, []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Split(buf.String(), "\n")[1]
+	if fields := strings.Fields(line); len(fields) < 3 || fields[0] != "12" || fields[1] != "12x" || fields[2] != "1" {
+		t.Errorf("expected one count of executions and one of iterations, got %q", line)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "sort"
+
+// Reduce minimises a core program for which interesting returns true, e.g.
+// a program on which two engines disagree. It repeatedly tries smaller
+// variants of the program and keeps the first one which is still
+// interesting, until no variant is. The result is only locally minimal.
+//
+// The variants delete chunks of statements, largest first like delta
+// debugging, replace while expressions by their body and finally renumber
+// variables, first to unused lower variables and then to used ones.
+func Reduce(prog *Expr, interesting func(*Expr) bool) *Expr {
+	for {
+		reduced := false
+		for _, variant := range append(variants(prog), renumberings(prog)...) {
+			if interesting(variant) {
+				prog, reduced = variant, true
+				break
+			}
+		}
+		if !reduced {
+			return prog
+		}
+	}
+}
+
+// statements returns the statements of the sequence e, which are not
+// sequences.
+func statements(e *Expr) []*Expr {
+	if e.Type != SEQ_EXPR {
+		return []*Expr{e}
+	}
+	return append(statements(e.SeqExpr.P1), statements(e.SeqExpr.P2)...)
+}
+
+// variants returns the programs which are one step smaller than e.
+func variants(e *Expr) []*Expr {
+	b := builder{e.Pos, e.End}
+	stmts := statements(e)
+	n := len(stmts)
+	var result []*Expr
+	without := func(i, j int) *Expr {
+		rest := append(append([]*Expr(nil), stmts[:i]...), stmts[j:]...)
+		return b.seq(rest...)
+	}
+	for k := (n + 1) / 2; k >= 1; k /= 2 {
+		for i := 0; i < n; i += k {
+			if j := i + k; k < n {
+				if j > n {
+					j = n
+				}
+				result = append(result, without(i, j))
+			}
+		}
+	}
+
+	replace := func(i int, with ...*Expr) *Expr {
+		rest := append(append(append([]*Expr(nil), stmts[:i]...), with...), stmts[i+1:]...)
+		return b.seq(rest...)
+	}
+	for i, stmt := range stmts {
+		if stmt.Type == WHILE_EXPR {
+			result = append(result, replace(i, statements(stmt.WhileExpr.P)...))
+		}
+	}
+	for i, stmt := range stmts {
+		if stmt.Type != WHILE_EXPR {
+			continue
+		}
+		b := builder{stmt.Pos, stmt.End}
+		for _, body := range variants(stmt.WhileExpr.P) {
+			result = append(result, replace(i, b.while(stmt.WhileExpr.Variable, body)))
+		}
+	}
+	return result
+}
+
+// renumberings returns the programs with one variable of e replaced by a
+// lower one. Only the lowest unused variables are tried, at most one more
+// than there are used ones, since the variables may be huge.
+func renumberings(e *Expr) []*Expr {
+	used := make(map[int]bool)
+	mapVariables(cloneExpr(e), func(v int) int {
+		used[v] = true
+		return v
+	})
+	var vars []int
+	for v := range used {
+		vars = append(vars, v)
+	}
+	sort.Ints(vars)
+
+	var result []*Expr
+	renumber := func(from, to int) {
+		variant := cloneExpr(e)
+		mapVariables(variant, func(v int) int {
+			if v == from {
+				return to
+			}
+			return v
+		})
+		result = append(result, variant)
+	}
+	for i := len(vars) - 1; i >= 0; i-- {
+		for u := 0; u < vars[i] && u <= len(vars); u++ {
+			if !used[u] {
+				renumber(vars[i], u)
+			}
+		}
+	}
+	for i := len(vars) - 1; i >= 0; i-- {
+		for _, u := range vars[:i] {
+			renumber(vars[i], u)
+		}
+	}
+	return result
+}
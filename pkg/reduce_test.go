@@ -0,0 +1,68 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "testing"
+
+func TestReduce(t *testing.T) {
+	prog := mustParse(t, mulProg)
+	// Programs using x2 and x3 in one loop.
+	reduced := Reduce(prog, func(e *Expr) bool {
+		found := false
+		Walk(e, func(e *Expr) bool {
+			if e.Type == WHILE_EXPR && e.WhileExpr.Variable == 3 {
+				Walk(e.WhileExpr.P, func(e *Expr) bool {
+					found = found || e.Type == INCR_EXPR && e.IncrExpr.Variable == 2
+					return true
+				})
+			}
+			return true
+		})
+		return found
+	})
+	if expected := "WHILE x3 != 0 DO\n  x2 := x2 + 1\nEND"; Format(reduced) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, Format(reduced))
+	}
+}
+
+func TestReduceRenumber(t *testing.T) {
+	// Programs computing 2 for the input 2. The unused variable x2 replaces
+	// x5, which can not be merged with x0 or x1.
+	prog := mustParse(t, "x4 := x4 + 1; WHILE x1 != 0 DO x1 := x1 - 1; x5 := x5 + 1 END; WHILE x5 != 0 DO x5 := x5 - 1; x0 := x0 + 1 END")
+	reduced := Reduce(prog, func(e *Expr) bool {
+		x0, err := Run(e, 100, 2)
+		return err == nil && x0 == 2
+	})
+	expected := "WHILE x1 != 0 DO\n  x1 := x1 - 1;\n  x2 := x2 + 1\nEND;\nWHILE x2 != 0 DO\n  x2 := x2 - 1;\n  x0 := x0 + 1\nEND"
+	if Format(reduced) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, Format(reduced))
+	}
+}
+
+func TestReduceLargeVariables(t *testing.T) {
+	prog := mustParse(t, "x9223372036854775807 := x9223372036854775807 + 1; x0 := x0 + 1")
+	reduced := Reduce(prog, func(e *Expr) bool {
+		return maxVariable(e) > 0
+	})
+	if expected := "x1 := x1 + 1"; Format(reduced) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, Format(reduced))
+	}
+}
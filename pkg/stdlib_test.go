@@ -0,0 +1,265 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stdlibOps are the macros of the standard library computing x0 from x1 and
+// x2 with their expected results.
+var stdlibOps = map[string]func(b, c uint64) uint64{
+	"ADD": func(b, c uint64) uint64 { return b + c },
+	"SUB": func(b, c uint64) uint64 {
+		if c > b {
+			return 0
+		}
+		return b - c
+	},
+	"MUL": func(b, c uint64) uint64 { return b * c },
+	"DIV": func(b, c uint64) uint64 {
+		if c == 0 {
+			return 0
+		}
+		return b / c
+	},
+	"MOD": func(b, c uint64) uint64 {
+		if c == 0 {
+			return b
+		}
+		return b % c
+	},
+	"LT":   func(b, c uint64) uint64 { return boolToUint(b < c) },
+	"LE":   func(b, c uint64) uint64 { return boolToUint(b <= c) },
+	"GT":   func(b, c uint64) uint64 { return boolToUint(b > c) },
+	"GE":   func(b, c uint64) uint64 { return boolToUint(b >= c) },
+	"EQ":   func(b, c uint64) uint64 { return boolToUint(b == c) },
+	"NE":   func(b, c uint64) uint64 { return boolToUint(b != c) },
+	"PAIR": func(b, c uint64) uint64 { return (b+c)*(b+c+1)/2 + c },
+}
+
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// runStdlib runs the program and checks that the locals, which are the
+// variables after x2, are 0 at the end.
+func runStdlib(t *testing.T, src string, input ...uint64) *Interpreter {
+	t.Helper()
+	prog, _, err := ParseMacros(src)
+	if err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	in := NewInterpreter(prog, input...)
+	if err := in.Run(10000000); err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	for i, v := range in.Vars() {
+		if i > 2 && v != 0 {
+			t.Fatalf("%s: local x%d is %d at the end", src, i, v)
+		}
+	}
+	return in
+}
+
+func TestStdlibOps(t *testing.T) {
+	for name, op := range stdlibOps {
+		src := fmt.Sprintf("%s(x0, x1, x2)", name)
+		for b := uint64(0); b < 7; b++ {
+			for c := uint64(0); c < 7; c++ {
+				in := runStdlib(t, src, b, c)
+				if got, expected := in.Var(0), op(b, c); got != expected {
+					t.Errorf("%s with %d, %d: expected %d, got %d", name, b, c, expected, got)
+				}
+				if in.Var(1) != b || in.Var(2) != c {
+					t.Errorf("%s with %d, %d: arguments changed to %d, %d", name, b, c, in.Var(1), in.Var(2))
+				}
+			}
+		}
+	}
+}
+
+func TestStdlibAliasing(t *testing.T) {
+	for name, op := range stdlibOps {
+		for b := uint64(0); b < 5; b++ {
+			for c := uint64(0); c < 5; c++ {
+				src := fmt.Sprintf("%s(x1, x1, x2); ASSIGN(x0, x1)", name)
+				if got, expected := runStdlib(t, src, b, c).Var(0), op(b, c); got != expected {
+					t.Errorf("%s: expected %d for %d, %d, got %d", src, expected, b, c, got)
+				}
+				src = fmt.Sprintf("%s(x0, x1, x1)", name)
+				if got, expected := runStdlib(t, src, b).Var(0), op(b, b); got != expected {
+					t.Errorf("%s: expected %d for %d, got %d", src, expected, b, got)
+				}
+			}
+		}
+	}
+}
+
+func TestStdlibUnpair(t *testing.T) {
+	for b := uint64(0); b < 10; b++ {
+		for c := uint64(0); c < 10; c++ {
+			in := runStdlib(t, "PAIR(x2, x1, x2); UNPAIR(x1, x2, x2)", b, c)
+			if in.Var(1) != b || in.Var(2) != c {
+				t.Errorf("expected %d, %d, got %d, %d", b, c, in.Var(1), in.Var(2))
+			}
+		}
+	}
+}
+
+func TestStdlibAssignments(t *testing.T) {
+	tests := map[string]struct {
+		src      string
+		input    []uint64
+		expected uint64
+	}{
+		"Assign":      {"ASSIGN(x0, x1)", []uint64{5}, 5},
+		"Assign self": {"ASSIGN(x1, x1); ASSIGN(x0, x1)", []uint64{5}, 5},
+		"Overwrite":   {"x0 := x0 + 1; ASSIGN(x0, x1)", []uint64{3}, 3},
+		"Set":         {"x0 := x0 + 1; SET(x0, 4)", nil, 4},
+		"Set zero":    {"x0 := x0 + 1; SET(x0, 0)", nil, 0},
+		"Set large":   {"SET(x1, 1000); SET(x0, 1001)", nil, 1001},
+		"Clear":       {"CLEAR(x1); ADD(x0, x1, x2)", []uint64{4, 2}, 2},
+	}
+	for caseName, testCase := range tests {
+		if got := runStdlib(t, testCase.src, testCase.input...).Var(0); got != testCase.expected {
+			t.Errorf("%s: expected %d, got %d", caseName, testCase.expected, got)
+		}
+	}
+}
+
+func TestStdlibConditionals(t *testing.T) {
+	tests := map[string]struct {
+		src      string
+		input    []uint64
+		expected uint64
+	}{
+		"If":          {"IF(x1, { x0 := x0 + 1; x0 := x0 + 1 })", []uint64{3}, 2},
+		"If zero":     {"IF(x1, { x0 := x0 + 1 })", []uint64{0}, 0},
+		"Ifz":         {"IFZ(x1, { x0 := x0 + 1 })", []uint64{0}, 1},
+		"Ifz nonzero": {"IFZ(x1, { x0 := x0 + 1 })", []uint64{2}, 0},
+		"Then":        {"IFELSE(x1, { SET(x0, 1) }, { SET(x0, 2) })", []uint64{7}, 1},
+		"Else":        {"IFELSE(x1, { SET(x0, 1) }, { SET(x0, 2) })", []uint64{0}, 2},
+		"Nested": {"IF(x1, { IFELSE(x2, { SET(x0, 1) }, { SET(x0, 2) }) })",
+			[]uint64{1, 0}, 2},
+		"Modify condition": {"IF(x1, { CLEAR(x1); x0 := x0 + 1 }); IF(x1, { x0 := x0 + 1 })",
+			[]uint64{1}, 1},
+		"In loop": {"WHILE x1 != 0 DO x1 := x1 - 1; IFELSE(x2, { x0 := x0 + 1 }, { x2 := x2 + 1 }) END",
+			[]uint64{3}, 2},
+	}
+	for caseName, testCase := range tests {
+		if got := runStdlib(t, testCase.src, testCase.input...).Var(0); got != testCase.expected {
+			t.Errorf("%s: expected %d, got %d", caseName, testCase.expected, got)
+		}
+	}
+}
+
+func TestStdlibSugarIf(t *testing.T) {
+	// IF is a macro of the standard library and a keyword of the sugar
+	// dialect. Only IF followed by arguments is the macro.
+	src := "IF x1 = 0 THEN x0 := 5 ELSE x0 := 7 END;\nIF(x2, { x0 := x0 + 1 })"
+	prog, _, err := ParseMacrosWith(src, SugarDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, expected := range map[[2]uint64]uint64{{0, 0}: 5, {1, 0}: 7, {1, 1}: 8} {
+		if got, err := Run(mustDesugar(t, prog), 0, input[:]...); err != nil || got != expected {
+			t.Errorf("%v: expected %d, got %d, %v", input, expected, got, err)
+		}
+	}
+}
+
+func TestMacroBlocks(t *testing.T) {
+	// The block uses the parameter a of TWICE, which must not be confused
+	// with the parameter a of IF.
+	src := `MACRO TWICE(a, b)
+  IF(b, { a := a + 1; a := a + 1 })
+ENDMACRO
+TWICE(x0, x1)`
+	if got := runStdlib(t, src, 1).Var(0); got != 2 {
+		t.Errorf("expected 2, got %d", got)
+	}
+
+	// Blocks keep their positions in the source.
+	prog, _, err := ParseMacros("IF(x1, {\n  x0 := x0 + 1 })")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var incr *Expr
+	Walk(prog, func(e *Expr) bool {
+		if e.Type == INCR_EXPR && e.IncrExpr.Variable == 0 {
+			incr = e
+		}
+		return true
+	})
+	if incr == nil || incr.Pos != (Pos{2, 3}) {
+		t.Errorf("expected increment of x0 at 2:3, got %v", incr)
+	}
+}
+
+func TestStdlibErrors(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected string
+	}{
+		"Error in block": {"IF(x1, {\n  x0 := x1 + 1 })",
+			"2:9: second variable index 1 has to match the first one which is 0"},
+		"Number as variable": {"x1 := x1 + 1;\nASSIGN(x0, 5)",
+			"2:1: expected variable, got CONSTANT \"5\" (in ADDTO called at 2:1, in ASSIGN called at 2:1)"},
+		"Missing )":        {"IF(x1, { x0 := x0 + 1 }", "1:1: missing ) after arguments of macro IF"},
+		"Unbalanced block": {"IF(x1, x0 := x0 + 1 })", "1:1: missing ) after arguments of macro IF"},
+		"Invalid argument": {"ASSIGN(x0, x1 + 1)", "1:1: invalid argument \"x1 + 1\" for macro ASSIGN"},
+	}
+	for caseName, testCase := range tests {
+		_, _, err := ParseMacros(testCase.input)
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf("%s: expected error %q, got %v", caseName, testCase.expected, err)
+		}
+	}
+}
+
+func TestStdlibLargeConstant(t *testing.T) {
+	// The constant is built from its bits, so the program stays small.
+	prog, _, err := ParseMacros("SET(x0, 18446744073709551615)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := Size(prog); size > 1000 {
+		t.Errorf("expected a small program, got size %d", size)
+	}
+
+	src := "MACRO ADDC(a, c)\n  a := a + 1{{range times .c}}; a := a + 1{{end}}\nENDMACRO\nADDC(x0, 99999999999)"
+	if _, _, err = ParseMacros(src); err == nil || !strings.Contains(err.Error(), "times: count 99999999999 is larger than 10000") {
+		t.Errorf("expected an error for the count, got %v", err)
+	}
+}
+
+func TestStdlibOverride(t *testing.T) {
+	src := "MACRO SET(a, c)\n  a := a + 1\nENDMACRO\nSET(x0, 5)"
+	if got := runStdlib(t, src).Var(0); got != 1 {
+		t.Errorf("expected the program's SET to be used, got %d", got)
+	}
+}
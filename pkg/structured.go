@@ -0,0 +1,782 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// The structured language is a tiny imperative language which is compiled
+// to WHILE programs:
+//
+//	// gcd computes the greatest common divisor.
+//	func gcd(a, b) {
+//		while b != 0 {
+//			t = a % b;
+//			a = b;
+//			b = t;
+//		}
+//		return a;
+//	}
+//
+//	func main(a, b) {
+//		return gcd(a, b);
+//	}
+//
+// Values are natural numbers. Expressions have the operators
+// `|| && == != < <= > >= + - * / % !` with the usual precedence, where `-`
+// stops at 0 and division by 0 yields 0 with the dividend as remainder.
+// Conditions are true if their value is not 0, comparisons yield 0 or 1.
+// Variables are declared by assigning them and are 0 initially. Every
+// function ends with a return statement, which is the only one. The program
+// is the function main, its parameters are the inputs and its result is x0.
+//
+// Functions are compiled to procedures and linked, see Link. Expressions are
+// compiled to statements of the sugar dialect using temporary variables,
+// which are finally replaced by Desugar. Every function starts by clearing
+// its variables and temporaries, since they may have been given as input.
+
+// CompileStructured compiles a program of the structured language to a core
+// WHILE program.
+func CompileStructured(r io.Reader) (*Expr, error) {
+	p := &structParser{}
+	p.s.Init(r)
+	p.s.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanComments | scanner.SkipComments
+	p.s.Error = func(s *scanner.Scanner, msg string) {
+		if p.err == nil {
+			p.err = &Error{Pos{s.Pos().Line, s.Pos().Column}, msg}
+		}
+	}
+	p.next()
+	funcs, err := p.parseProgram()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkFuncs(funcs); err != nil {
+		return nil, err
+	}
+
+	m := &Module{}
+	for _, f := range funcs {
+		proc, err := compileFunc(f)
+		if err != nil {
+			return nil, err
+		}
+		m.Procs = append(m.Procs, proc)
+		if f.name == "main" {
+			m.Main = proc.Body
+		}
+	}
+	if m.Main == nil {
+		return nil, &Error{Pos{1, 1}, "missing function main"}
+	}
+	prog, err := Link(m, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Desugar(prog)
+}
+
+// structFunc is a function of the structured language.
+type structFunc struct {
+	name   string
+	params []string
+	body   []*structStmt
+	pos    Pos
+}
+
+// The kinds of statements.
+const (
+	structAssign = iota
+	structIf
+	structWhile
+	structReturn
+)
+
+// structStmt is a statement of the structured language.
+type structStmt struct {
+	kind     int
+	pos, end Pos
+	// name is the assigned variable.
+	name string
+	// expr is the assigned or returned value or the condition.
+	expr      *structExpr
+	body, els []*structStmt
+}
+
+// structExpr is an expression of the structured language. op is "num",
+// "var", "call" or an operator.
+type structExpr struct {
+	op    string
+	pos   Pos
+	value uint64
+	name  string
+	args  []*structExpr
+}
+
+// structParser parses the structured language.
+type structParser struct {
+	s   scanner.Scanner
+	tok string
+	pos Pos
+	err error
+}
+
+// next reads the next token. Operators of two characters are combined.
+func (p *structParser) next() {
+	r := p.s.Scan()
+	p.pos = Pos{p.s.Position.Line, p.s.Position.Column}
+	p.tok = p.s.TokenText()
+	if r == scanner.EOF {
+		p.tok = ""
+		return
+	}
+	if strings.ContainsRune("=!<>&|", r) {
+		if two := string(r) + string(p.s.Peek()); two == "==" || two == "!=" || two == "<=" ||
+			two == ">=" || two == "&&" || two == "||" {
+			p.s.Next()
+			p.tok = two
+		}
+	}
+}
+
+// errorf returns an error at the current token.
+func (p *structParser) errorf(format string, a ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return &Error{p.pos, fmt.Sprintf(format, a...)}
+}
+
+// describe returns the current token for error messages.
+func (p *structParser) describe() string {
+	if p.tok == "" {
+		return "end of file"
+	}
+	return strconv.Quote(p.tok)
+}
+
+// expect checks that the current token is tok and reads the next one.
+func (p *structParser) expect(tok string) error {
+	if p.tok != tok {
+		return p.errorf("expected %q, got %s", tok, p.describe())
+	}
+	p.next()
+	return nil
+}
+
+// ident reads an identifier, which must not be a keyword.
+func (p *structParser) ident() (string, error) {
+	name := p.tok
+	if !isStructIdent(name) {
+		return "", p.errorf("expected identifier, got %s", p.describe())
+	}
+	p.next()
+	return name, nil
+}
+
+// structKeywords are the keywords of the structured language.
+var structKeywords = map[string]bool{"func": true, "if": true, "else": true, "while": true, "return": true}
+
+// isStructIdent reports whether tok is an identifier.
+func isStructIdent(tok string) bool {
+	if tok == "" || structKeywords[tok] {
+		return false
+	}
+	for i, ch := range tok {
+		if !isLower(ch) && !isUpper(ch) && ch != '_' && (i == 0 || !isDigit(ch)) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseProgram parses the function definitions.
+func (p *structParser) parseProgram() ([]*structFunc, error) {
+	var funcs []*structFunc
+	for p.tok != "" {
+		f := &structFunc{pos: p.pos}
+		if err := p.expect("func"); err != nil {
+			return nil, err
+		}
+		var err error
+		if f.name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		for p.tok != ")" {
+			if len(f.params) > 0 {
+				if err = p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			param, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			f.params = append(f.params, param)
+		}
+		p.next()
+		if f.body, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, f)
+	}
+	return funcs, p.err
+}
+
+// parseBlock parses statements in braces.
+func (p *structParser) parseBlock() ([]*structStmt, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var stmts []*structStmt
+	for p.tok != "}" {
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	p.next()
+	return stmts, nil
+}
+
+// parseStmt parses a statement.
+func (p *structParser) parseStmt() (*structStmt, error) {
+	stmt := &structStmt{pos: p.pos}
+	var err error
+	switch p.tok {
+	case "if":
+		stmt.kind = structIf
+		p.next()
+		if stmt.expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if stmt.body, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+		if p.tok == "else" {
+			p.next()
+			if p.tok == "if" {
+				elseIf, err := p.parseStmt()
+				if err != nil {
+					return nil, err
+				}
+				stmt.els = []*structStmt{elseIf}
+			} else if stmt.els, err = p.parseBlock(); err != nil {
+				return nil, err
+			}
+		}
+	case "while":
+		stmt.kind = structWhile
+		p.next()
+		if stmt.expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if stmt.body, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	case "return":
+		stmt.kind = structReturn
+		p.next()
+		if stmt.expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		err = p.expect(";")
+	default:
+		stmt.kind = structAssign
+		if !isStructIdent(p.tok) {
+			return nil, p.errorf("expected statement, got %s", p.describe())
+		}
+		stmt.name, _ = p.ident()
+		if err = p.expect("="); err != nil {
+			return nil, err
+		}
+		if stmt.expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		err = p.expect(";")
+	}
+	stmt.end = p.pos
+	return stmt, err
+}
+
+// structLevels are the binary operators by increasing precedence.
+var structLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// parseExpr parses an expression.
+func (p *structParser) parseExpr() (*structExpr, error) {
+	return p.parseBinary(0)
+}
+
+// parseBinary parses the binary operators of a precedence level and above.
+// Comparisons can not be chained.
+func (p *structParser) parseBinary(level int) (*structExpr, error) {
+	if level == len(structLevels) {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for isStructOp(p.tok, level) {
+		e := &structExpr{op: p.tok, pos: p.pos}
+		p.next()
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		e.args = []*structExpr{x, y}
+		x = e
+		if level == 2 && isStructOp(p.tok, level) {
+			return nil, p.errorf("comparisons can not be chained")
+		}
+	}
+	return x, nil
+}
+
+// isStructOp reports whether tok is an operator of the precedence level.
+func isStructOp(tok string, level int) bool {
+	for _, op := range structLevels[level] {
+		if tok == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUnary parses negations, numbers, variables, calls and parentheses.
+func (p *structParser) parseUnary() (*structExpr, error) {
+	e := &structExpr{pos: p.pos}
+	switch {
+	case p.tok == "!":
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		e.op, e.args = "!", []*structExpr{x}
+	case p.tok == "(":
+		p.next()
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case p.tok != "" && isDigit(rune(p.tok[0])):
+		value, err := strconv.ParseUint(p.tok, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", p.tok)
+		}
+		e.op, e.value = "num", value
+		p.next()
+	default:
+		name, err := p.ident()
+		if err != nil {
+			return nil, p.errorf("expected expression, got %s", p.describe())
+		}
+		e.op, e.name = "var", name
+		if p.tok != "(" {
+			return e, nil
+		}
+		e.op = "call"
+		p.next()
+		for p.tok != ")" {
+			if len(e.args) > 0 {
+				if err = p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			e.args = append(e.args, arg)
+		}
+		p.next()
+	}
+	return e, nil
+}
+
+// checkFuncs checks that the functions are unique and that calls have the
+// right number of arguments and are not recursive.
+func checkFuncs(funcs []*structFunc) error {
+	byName := make(map[string]*structFunc)
+	for _, f := range funcs {
+		if byName[f.name] != nil {
+			return &Error{f.pos, fmt.Sprintf("function %s already defined at %s", f.name, byName[f.name].pos)}
+		}
+		byName[f.name] = f
+	}
+
+	// state is 1 while the calls of a function are checked and 2 afterwards.
+	state := make(map[*structFunc]int)
+	var checkFunc func(f *structFunc) error
+	var checkStmts func(stmts []*structStmt) error
+	var checkExpr func(e *structExpr) error
+	checkFunc = func(f *structFunc) error {
+		state[f] = 1
+		err := checkStmts(f.body)
+		state[f] = 2
+		return err
+	}
+	checkStmts = func(stmts []*structStmt) error {
+		for _, stmt := range stmts {
+			if stmt.expr != nil {
+				if err := checkExpr(stmt.expr); err != nil {
+					return err
+				}
+			}
+			if err := checkStmts(stmt.body); err != nil {
+				return err
+			}
+			if err := checkStmts(stmt.els); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	checkExpr = func(e *structExpr) error {
+		for _, arg := range e.args {
+			if err := checkExpr(arg); err != nil {
+				return err
+			}
+		}
+		if e.op != "call" {
+			return nil
+		}
+		f := byName[e.name]
+		switch {
+		case f == nil:
+			return &Error{e.pos, fmt.Sprintf("undefined function %s", e.name)}
+		case len(e.args) != len(f.params):
+			return &Error{e.pos, fmt.Sprintf("function %s expects %d arguments, got %d",
+				e.name, len(f.params), len(e.args))}
+		case state[f] == 1:
+			return &Error{e.pos, fmt.Sprintf("recursive call of function %s", e.name)}
+		case state[f] == 0:
+			return checkFunc(f)
+		}
+		return nil
+	}
+
+	for _, f := range funcs {
+		if state[f] == 0 {
+			if err := checkFunc(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// structGen generates the code of a function. The parameters are x1, x2, ...,
+// the result is x0 and the other variables and temporaries follow.
+type structGen struct {
+	vars map[string]int
+	next int
+	b    builder
+}
+
+// compileFunc compiles a function to a procedure.
+func compileFunc(f *structFunc) (*Proc, error) {
+	g := &structGen{vars: make(map[string]int), next: 1}
+	proc := &Proc{Name: f.name, Pos: f.pos}
+	for _, param := range f.params {
+		if _, ok := g.vars[param]; ok {
+			return nil, &Error{f.pos, fmt.Sprintf("duplicate parameter %s of function %s", param, f.name)}
+		}
+		g.vars[param] = g.temp()
+		proc.Inputs = append(proc.Inputs, g.vars[param])
+	}
+
+	n := len(f.body)
+	if n == 0 || f.body[n-1].kind != structReturn {
+		return nil, &Error{f.pos, fmt.Sprintf("function %s does not end with a return statement", f.name)}
+	}
+	g.declare(f.body)
+	stmts, err := g.stmts(f.body[:n-1])
+	if err != nil {
+		return nil, err
+	}
+	ret := f.body[n-1]
+	g.b = builder{ret.pos, ret.end}
+	r, code, err := g.expr(ret.expr)
+	if err != nil {
+		return nil, err
+	}
+	stmts = append(stmts, code...)
+
+	b := builder{f.pos, f.pos}
+	var prologue []*Expr
+	for v := len(f.params) + 1; v < g.next; v++ {
+		prologue = append(prologue, b.clear(v))
+	}
+	proc.Body = g.b.seq(append(append(prologue, stmts...), g.copy(0, r))...)
+	return proc, nil
+}
+
+// declare assigns registers to the variables assigned in stmts.
+func (g *structGen) declare(stmts []*structStmt) {
+	for _, stmt := range stmts {
+		if _, ok := g.vars[stmt.name]; stmt.kind == structAssign && !ok {
+			g.vars[stmt.name] = g.temp()
+		}
+		g.declare(stmt.body)
+		g.declare(stmt.els)
+	}
+}
+
+// temp returns an unused variable.
+func (g *structGen) temp() int {
+	g.next++
+	return g.next - 1
+}
+
+// stmts compiles a list of statements.
+func (g *structGen) stmts(stmts []*structStmt) ([]*Expr, error) {
+	var code []*Expr
+	for _, stmt := range stmts {
+		g.b = builder{stmt.pos, stmt.end}
+		switch stmt.kind {
+		case structReturn:
+			return nil, &Error{stmt.pos, "return has to be the last statement of a function"}
+		case structAssign:
+			r, c, err := g.expr(stmt.expr)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, c...)
+			code = append(code, g.copy(g.vars[stmt.name], r))
+		case structIf:
+			// The negated condition allows to use `IF xN = 0 THEN P END`.
+			c, n, err := g.cond(stmt.expr, "!")
+			if err != nil {
+				return nil, err
+			}
+			then, err := g.block(stmt.body)
+			if err != nil {
+				return nil, err
+			}
+			var els *Expr
+			if stmt.els != nil {
+				if els, err = g.block(stmt.els); err != nil {
+					return nil, err
+				}
+			}
+			g.b = builder{stmt.pos, stmt.end}
+			code = append(code, c...)
+			code = append(code, g.b.ifZero(n, then, els))
+		case structWhile:
+			c, v, err := g.cond(stmt.expr, "")
+			if err != nil {
+				return nil, err
+			}
+			body, err := g.stmts(stmt.body)
+			if err != nil {
+				return nil, err
+			}
+			// The condition is computed again at the end of the body.
+			g.b = builder{stmt.pos, stmt.end}
+			again, w, _ := g.cond(stmt.expr, "")
+			body = append(body, again...)
+			body = append(body, g.copy(v, w))
+			code = append(code, c...)
+			code = append(code, g.b.while(v, body...))
+		}
+	}
+	return code, nil
+}
+
+// block compiles a block of statements to a single expression.
+func (g *structGen) block(stmts []*structStmt) (*Expr, error) {
+	code, err := g.stmts(stmts)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return g.nop(), nil
+	}
+	return g.b.seq(code...), nil
+}
+
+// cond computes the condition e, which is negated if op is "!", into a new
+// variable.
+func (g *structGen) cond(e *structExpr, op string) ([]*Expr, int, error) {
+	if op == "!" {
+		e = &structExpr{op: "!", pos: e.pos, args: []*structExpr{e}}
+	}
+	r, code, err := g.expr(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	t := g.temp()
+	return append(code, g.copy(t, r)), t, nil
+}
+
+// expr computes e and returns the variable containing the value. Variables
+// of the function are returned directly, so the value must not be modified.
+func (g *structGen) expr(e *structExpr) (int, []*Expr, error) {
+	switch e.op {
+	case "num":
+		t := g.temp()
+		return t, []*Expr{g.assign(t, CONSTANT, 0, 0, e.value)}, nil
+	case "var":
+		v, ok := g.vars[e.name]
+		if !ok {
+			return 0, nil, &Error{e.pos, fmt.Sprintf("undefined variable %s", e.name)}
+		}
+		return v, nil, nil
+	}
+
+	var code []*Expr
+	args := make([]int, len(e.args))
+	for i, arg := range e.args {
+		r, c, err := g.expr(arg)
+		if err != nil {
+			return 0, nil, err
+		}
+		args[i] = r
+		code = append(code, c...)
+	}
+
+	t := g.temp()
+	switch e.op {
+	case "call":
+		call := &CallExpr{Name: e.name, Args: append(args, t)}
+		return t, append(code, &Expr{Type: CALL_EXPR, Pos: g.b.pos, End: g.b.end, CallExpr: call}), nil
+	case "!":
+		return t, append(code, g.not(t, args[0])...), nil
+	}
+
+	x, y := args[0], args[1]
+	switch e.op {
+	case "+":
+		code = append(code, g.copy(t, x), g.b.addTo(t, y, g.temp()))
+	case "-":
+		code = append(code, g.copy(t, x), g.monus(t, y))
+	case "*":
+		code = append(code, g.assign(t, TIMES, x, y, 0))
+	case "/", "%":
+		code = append(code, g.divide(t, x, y, e.op == "%")...)
+	case "<", ">", "<=", ">=":
+		// x < y is y - x != 0, x <= y is x - y = 0.
+		if e.op == ">" || e.op == "<=" {
+			x, y = y, x
+		}
+		d := g.temp()
+		code = append(code, g.copy(d, y), g.monus(d, x))
+		if e.op == "<" || e.op == ">" {
+			code = append(code, g.bool(t, d)...)
+		} else {
+			code = append(code, g.not(t, d)...)
+		}
+	case "==", "!=":
+		d, f := g.temp(), g.temp()
+		code = append(code, g.copy(d, x), g.monus(d, y), g.copy(f, y), g.monus(f, x),
+			g.b.addTo(d, f, g.temp()))
+		if e.op == "!=" {
+			code = append(code, g.bool(t, d)...)
+		} else {
+			code = append(code, g.not(t, d)...)
+		}
+	case "&&":
+		a, b := g.temp(), g.temp()
+		code = append(code, g.bool(a, x)...)
+		code = append(code, g.bool(b, y)...)
+		code = append(code, g.assign(t, TIMES, a, b, 0))
+	case "||":
+		s := g.temp()
+		code = append(code, g.copy(s, x), g.b.addTo(s, y, g.temp()))
+		code = append(code, g.bool(t, s)...)
+	}
+	return t, code, nil
+}
+
+// divide computes x / y or x % y into t. Testing r >= y in every step would
+// copy r, so the steps only count down y and afterwards the quotient is
+// corrected, which takes time linear in x and y.
+func (g *structGen) divide(t, x, y int, mod bool) []*Expr {
+	q, c, k, z, p, over, r := g.temp(), g.temp(), g.temp(), g.temp(), g.temp(), g.temp(), g.temp()
+	code := []*Expr{g.assign(q, CONSTANT, 0, 0, 0), g.copy(c, x)}
+	// Nothing is subtracted if y is 0, so the loop must not be entered.
+	code = append(code, g.not(z, y)...)
+	code = append(code, g.b.while(z, g.assign(z, CONSTANT, 0, 0, 0), g.assign(c, CONSTANT, 0, 0, 0)))
+	code = append(code, g.b.while(c, g.copy(k, y), g.b.while(k, g.b.decr(k), g.b.decr(c)), g.b.incr(q)))
+	// The last step may have been incomplete, then q·y > x.
+	code = append(code, g.assign(p, TIMES, q, y, 0), g.copy(over, p), g.monus(over, x))
+	code = append(code, g.bool(z, over)...)
+	code = append(code, g.monus(q, z))
+	if mod {
+		return append(code, g.assign(p, TIMES, q, y, 0), g.copy(r, x), g.monus(r, p), g.copy(t, r))
+	}
+	return append(code, g.copy(t, q))
+}
+
+// assign returns the assignment of the sugar dialect `xT := ...`.
+func (g *structGen) assign(t int, op Token, source, factor int, c uint64) *Expr {
+	assign := &AssignExpr{Variable: t, Op: op, Source: source, Factor: factor, Constant: c}
+	return &Expr{Type: ASSIGN_EXPR, Pos: g.b.pos, End: g.b.end, AssignExpr: assign}
+}
+
+// copy returns `xT := xV`.
+func (g *structGen) copy(t, v int) *Expr {
+	return g.assign(t, PLUS, v, 0, 0)
+}
+
+// nop returns a statement doing nothing.
+func (g *structGen) nop() *Expr {
+	t := g.temp()
+	return g.copy(t, t)
+}
+
+// monus subtracts xV from xT, stopping at 0.
+func (g *structGen) monus(t, v int) *Expr {
+	c := g.temp()
+	return g.b.seq(g.copy(c, v), g.b.while(c, g.b.decr(c), g.b.decr(t)))
+}
+
+// bool sets xT to 1 if xV is not 0 and to 0 otherwise.
+func (g *structGen) bool(t, v int) []*Expr {
+	c := g.temp()
+	return []*Expr{g.assign(t, CONSTANT, 0, 0, 0), g.copy(c, v),
+		g.b.while(c, g.assign(c, CONSTANT, 0, 0, 0), g.assign(t, CONSTANT, 0, 0, 1))}
+}
+
+// not sets xT to 1 if xV is 0 and to 0 otherwise.
+func (g *structGen) not(t, v int) []*Expr {
+	c := g.temp()
+	return []*Expr{g.assign(t, CONSTANT, 0, 0, 1), g.copy(c, v),
+		g.b.while(c, g.assign(c, CONSTANT, 0, 0, 0), g.assign(t, CONSTANT, 0, 0, 0))}
+}
@@ -0,0 +1,217 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// gcdStruct computes the greatest common divisor in the structured language.
+const gcdStruct = `// Euclid's algorithm
+func gcd(a, b) {
+	while b != 0 {
+		t = a % b;
+		a = b;
+		b = t;
+	}
+	return a;
+}
+
+func main(a, b) {
+	return gcd(a, b);
+}`
+
+// primeStruct tests for primality in the structured language.
+const primeStruct = `func divides(d, n) {
+	return n % d == 0;
+}
+
+func main(n) {
+	d = 2;
+	prime = n >= 2;
+	while d * d <= n && prime {
+		if divides(d, n) {
+			prime = 0;
+		}
+		d = d + 1;
+	}
+	return prime;
+}`
+
+// mustCompile compiles src and checks that the result runs on the parser
+// of the core language.
+func mustCompile(t *testing.T, src string) *Expr {
+	prog, err := CompileStructured(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("error compiling %q: %s", src, err)
+	}
+	return mustParse(t, Format(prog))
+}
+
+func TestCompileStructured(t *testing.T) {
+	gcd := mustCompile(t, gcdStruct)
+	prime := mustCompile(t, primeStruct)
+	Walk(gcd, func(e *Expr) bool {
+		if e.Type != INCR_EXPR && e.Type != SEQ_EXPR && e.Type != WHILE_EXPR || e.Type == INCR_EXPR && e.IncrExpr.General {
+			t.Fatalf("unexpected expression %s", e)
+		}
+		return true
+	})
+
+	goGcd := func(a, b uint64) uint64 {
+		for b != 0 {
+			a, b = b, a%b
+		}
+		return a
+	}
+	for a := uint64(0); a < 13; a++ {
+		for b := uint64(0); b < 13; b++ {
+			if got, err := Run(gcd, 0, a, b); err != nil || got != goGcd(a, b) {
+				t.Errorf("gcd(%d, %d): expected %d, got %d, %v", a, b, goGcd(a, b), got, err)
+			}
+		}
+	}
+
+	for n := uint64(0); n < 30; n++ {
+		expected := uint64(1)
+		if n < 2 {
+			expected = 0
+		}
+		for d := uint64(2); d < n; d++ {
+			if n%d == 0 {
+				expected = 0
+			}
+		}
+		if got, err := Run(prime, 0, n); err != nil || got != expected {
+			t.Errorf("prime(%d): expected %d, got %d, %v", n, expected, got, err)
+		}
+	}
+
+	// Input for the variables and temporaries is ignored.
+	extra := []uint64{12, 18, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
+	if got, err := Run(gcd, 0, extra...); err != nil || got != 6 {
+		t.Errorf("gcd with extra input: expected 6, got %d, %v", got, err)
+	}
+	if got, err := Run(prime, 0, 7, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5); err != nil || got != 1 {
+		t.Errorf("prime with extra input: expected 1, got %d, %v", got, err)
+	}
+}
+
+func TestCompileStructuredOperators(t *testing.T) {
+	b2u := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	ops := map[string]func(x, y uint64) uint64{
+		"x + y":        func(x, y uint64) uint64 { return x + y },
+		"x - y":        func(x, y uint64) uint64 { return x - y*b2u(y <= x) - x*b2u(y > x) },
+		"x * y":        func(x, y uint64) uint64 { return x * y },
+		"x / y":        func(x, y uint64) uint64 { return x / (y + b2u(y == 0)) * b2u(y != 0) },
+		"x % y":        func(x, y uint64) uint64 { return x % (y + (x+1)*b2u(y == 0)) },
+		"x == y":       func(x, y uint64) uint64 { return b2u(x == y) },
+		"x != y":       func(x, y uint64) uint64 { return b2u(x != y) },
+		"x < y":        func(x, y uint64) uint64 { return b2u(x < y) },
+		"x <= y":       func(x, y uint64) uint64 { return b2u(x <= y) },
+		"x > y":        func(x, y uint64) uint64 { return b2u(x > y) },
+		"x >= y":       func(x, y uint64) uint64 { return b2u(x >= y) },
+		"x && y":       func(x, y uint64) uint64 { return b2u(x != 0 && y != 0) },
+		"x || y":       func(x, y uint64) uint64 { return b2u(x != 0 || y != 0) },
+		"!x":           func(x, y uint64) uint64 { return b2u(x == 0) },
+		"1 + x * 2":    func(x, y uint64) uint64 { return 1 + x*2 },
+		"(1 + x) * 2":  func(x, y uint64) uint64 { return (1 + x) * 2 },
+		"x - 1 - y":    func(x, y uint64) uint64 { return (x - 1 - y) * b2u(x >= y+1) },
+		"x < y || !y":  func(x, y uint64) uint64 { return b2u(x < y || y == 0) },
+		"x + 1 == y":   func(x, y uint64) uint64 { return b2u(x+1 == y) },
+		"x % 3 * y":    func(x, y uint64) uint64 { return x % 3 * y },
+		"!(x > 1) + y": func(x, y uint64) uint64 { return b2u(x <= 1) + y },
+	}
+
+	for op, f := range ops {
+		prog := mustCompile(t, fmt.Sprintf("func main(x, y) { z = %s; return z; }", op))
+		for x := uint64(0); x < 5; x++ {
+			for y := uint64(0); y < 5; y++ {
+				if got, err := Run(prog, 0, x, y); err != nil || got != f(x, y) {
+					t.Errorf("%s with x = %d, y = %d: expected %d, got %d, %v", op, x, y, f(x, y), got, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCompileStructuredStatements(t *testing.T) {
+	src := `func max(a, b) {
+	if a > b { m = a; } else { m = b; }
+	return m;
+}
+
+/* sign of a - b with 0, 1 or 2 */
+func cmp(a, b) {
+	if a == b { c = 0; } else if a > b { c = 2; } else { c = 1; }
+	return c;
+}
+
+func main(a, b) {
+	s = 0;
+	i = 0;
+	while i < a { if i % 2 {} else { s = s + i; } i = i + 1; }
+	return max(a, b) * 100 + cmp(a, b) * 10 + s;
+}`
+	prog := mustCompile(t, src)
+	tests := [][3]uint64{{0, 0, 0}, {3, 1, 322}, {1, 3, 310}, {5, 5, 506}}
+	for _, test := range tests {
+		if got, err := Run(prog, 0, test[0], test[1]); err != nil || got != test[2] {
+			t.Errorf("%d, %d: expected %d, got %d, %v", test[0], test[1], test[2], got, err)
+		}
+	}
+}
+
+func TestCompileStructuredErrors(t *testing.T) {
+	tests := map[string]struct {
+		input, err string
+	}{
+		"No main":        {"func f() { return 0; }", "1:1: missing function main"},
+		"No return":      {"func main() { x = 1; }", "1:1: function main does not end with a return statement"},
+		"Early return":   {"func main() {\n if 1 { return 1; }\n return 0; }", "2:9: return has to be the last statement of a function"},
+		"Undefined var":  {"func main(a) { return b; }", "1:23: undefined variable b"},
+		"Undefined func": {"func main(a) { return f(a); }", "1:23: undefined function f"},
+		"Arguments":      {"func f(a) { return a; }\nfunc main(a) { return f(a, a); }", "2:23: function f expects 1 arguments, got 2"},
+		"Recursion": {"func f(a) { return g(a); }\nfunc g(a) { return f(a); }\nfunc main() { return 0; }",
+			"2:20: recursive call of function f"},
+		"Duplicate":  {"func main() { return 0; }\nfunc main() { return 1; }", "2:1: function main already defined at 1:1"},
+		"Parameters": {"func main(a, a) { return a; }", "1:1: duplicate parameter a of function main"},
+		"Chained":    {"func main(a) { return 1 < a < 3; }", "1:29: comparisons can not be chained"},
+		"Keyword":    {"func main(if) { return 0; }", "1:11: expected identifier, got \"if\""},
+		"Semicolon":  {"func main() { return 0 }", "1:24: expected \";\", got \"}\""},
+		"Expression": {"func main() { return +; }", "1:22: expected expression, got \"+\""},
+		"EOF":        {"func main() { return 0;", "1:24: expected statement, got end of file"},
+	}
+
+	for caseName, testCase := range tests {
+		_, err := CompileStructured(strings.NewReader(testCase.input))
+		if err == nil || err.Error() != testCase.err {
+			t.Errorf("%s: expected error %q, got %v", caseName, testCase.err, err)
+		}
+	}
+}
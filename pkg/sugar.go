@@ -0,0 +1,464 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The sugar dialect extends the core language by the statements
+//
+//	xN := c
+//	xN := xM + c
+//	xN := xM - c
+//	xN := xM * xK
+//	IF xN = 0 THEN P END
+//	IF xN = 0 THEN P ELSE Q END
+//	LOOP xN DO P END
+//
+// for arbitrary natural constants c. Desugar replaces them by core
+// expressions, which shows that they add no computational power.
+
+// NewSugarParser creates a parser accepting the sugar dialect.
+func NewSugarParser(r io.Reader) *Parser {
+	return NewParser(r, SugarDialect)
+}
+
+// parseAssign parses an assignment of the sugar dialect. Without the sugar
+// dialect only `xN := xM + c` and `xN := xM - c` are accepted and returned as
+// generalised increment expressions, see Dialect.Assign. Assignments of the
+// core language are returned as increment expressions.
+func (p *Parser) parseAssign() (*Expr, error) {
+	v, err := p.parseVariable()
+	if err != nil {
+		return nil, err
+	}
+	pos := p.buf.pos
+	if _, err = p.expect(ASSIGN); err != nil {
+		return nil, err
+	}
+	assign := &AssignExpr{Variable: v, Op: PLUS}
+	expr := func() (*Expr, error) {
+		if assign.Source == v && assign.Constant == 1 && (assign.Op == PLUS || assign.Op == MINUS) {
+			incr := &IncrExpr{Variable: v, Decrement: assign.Op == MINUS}
+			return &Expr{Type: INCR_EXPR, Pos: pos, End: p.buf.end, IncrExpr: incr}, nil
+		}
+		if !p.d.Sugar {
+			incr := &IncrExpr{Variable: v, Decrement: assign.Op == MINUS,
+				General: true, Source: assign.Source, Constant: assign.Constant}
+			return &Expr{Type: INCR_EXPR, Pos: pos, End: p.buf.end, IncrExpr: incr}, nil
+		}
+		return &Expr{Type: ASSIGN_EXPR, Pos: pos, End: p.buf.end, AssignExpr: assign}, nil
+	}
+
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, p.errorf("error parsing assignment: %s", err)
+	}
+	switch {
+	case tok == CONSTANT && p.d.Sugar:
+		assign.Op = CONSTANT
+		assign.Constant, err = p.parseConstant(lit)
+		if err != nil {
+			return nil, err
+		}
+		return expr()
+	case tok == VARIABLE || tok == NAME && p.names != nil:
+		p.unscan()
+		if assign.Source, err = p.parseVariable(); err != nil {
+			return nil, err
+		}
+	case p.d.Sugar:
+		return nil, p.errorf("expected variable or constant, got %s", describeToken(tok, lit))
+	default:
+		return nil, p.errorf("expected variable, got %s", describeToken(tok, lit))
+	}
+
+	// A single variable is an addition of 0.
+	end := p.buf.end
+	tok, lit, err = p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, p.errorf("error parsing assignment: %s", err)
+	}
+	switch {
+	case tok == PLUS || tok == MINUS:
+		assign.Op = tok
+		if lit, err = p.expectConstant(); err != nil {
+			return nil, err
+		}
+		if assign.Constant, err = p.parseConstant(lit); err != nil {
+			return nil, err
+		}
+	case tok == TIMES && p.d.Sugar:
+		assign.Op = TIMES
+		if assign.Factor, err = p.parseVariable(); err != nil {
+			return nil, err
+		}
+	case !p.d.Sugar:
+		return nil, p.errorf("token \"%s\" has to be - or + sign", lit)
+	default:
+		p.unscan()
+		e, _ := expr()
+		e.End = end
+		return e, nil
+	}
+	return expr()
+}
+
+// expectConstant reads the constant added to or subtracted from a variable.
+// Names in its place are reported as variables.
+func (p *Parser) expectConstant() (string, error) {
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return "", p.errorf("error parsing %s: %s", CONSTANT, err)
+	}
+	if tok == NAME && p.names != nil {
+		if _, ok := p.names.ids[lit]; !ok {
+			return "", p.errorf("undefined variable %s", lit)
+		}
+		return "", p.errorf("expected %s, got variable %s", CONSTANT, lit)
+	}
+	if tok != CONSTANT {
+		return "", p.errorf("expected %s, got %s", CONSTANT, describeToken(tok, lit))
+	}
+	return lit, nil
+}
+
+// parseConstant converts the literal of a constant to a number.
+func (p *Parser) parseConstant(lit string) (uint64, error) {
+	c, err := strconv.ParseUint(lit, 10, 64)
+	if err != nil {
+		return 0, p.errorf("invalid constant \"%s\": %s", lit, err.(*strconv.NumError).Err)
+	}
+	return c, nil
+}
+
+// parseIf parses the conditional `IF xN = 0 THEN P ELSE Q END`, where the ELSE
+// part is optional.
+func (p *Parser) parseIf() (*IfExpr, error) {
+	ifExpr := &IfExpr{}
+
+	if _, err := p.expect(IF); err != nil {
+		return nil, err
+	}
+	varNum, err := p.parseVariable()
+	if err != nil {
+		return nil, err
+	}
+	ifExpr.Variable = varNum
+	if _, err = p.expect(EQUAL); err != nil {
+		return nil, err
+	}
+	lit, err := p.expect(CONSTANT)
+	if err != nil {
+		return nil, err
+	}
+	if lit != "0" {
+		return nil, p.errorf("if condition has to compare with 0, got \"%s\"", lit)
+	}
+
+	if _, err = p.expect(THEN); err != nil {
+		return nil, err
+	}
+	if ifExpr.Then, err = p.parseSeq(); err != nil {
+		return nil, err
+	}
+	tok, lit, err := p.scanIgnoreWhitespace()
+	if err != nil {
+		return nil, p.errorf("error parsing IF: %s", err)
+	}
+	switch tok {
+	case ELSE:
+		if ifExpr.Else, err = p.parseSeq(); err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(END); err != nil {
+			return nil, err
+		}
+	case END:
+	default:
+		return nil, p.errorf("expected ELSE or END, got %s", describeToken(tok, lit))
+	}
+
+	return ifExpr, nil
+}
+
+// parseLoop parses the loop expression `LOOP xN DO P END`.
+func (p *Parser) parseLoop() (*LoopExpr, error) {
+	loopExpr := &LoopExpr{}
+
+	if _, err := p.expect(LOOP); err != nil {
+		return nil, err
+	}
+	varNum, err := p.parseVariable()
+	if err != nil {
+		return nil, err
+	}
+	loopExpr.Variable = varNum
+
+	if _, err = p.expect(DO); err != nil {
+		return nil, err
+	}
+	if loopExpr.P, err = p.parseSeq(); err != nil {
+		return nil, err
+	}
+	if err = p.expectLoopEnd(); err != nil {
+		return nil, err
+	}
+
+	return loopExpr, nil
+}
+
+// Desugar returns a core program equivalent to e, which may contain
+// expressions of the sugar dialect. Temporary variables are numbered after
+// the variables used in e. The program starts by setting them to 0, since
+// they may have been given as input, and every desugared statement leaves
+// them 0 again. The generated expressions get the positions of the
+// statements they originate from. An error is returned if the numbers of the
+// temporaries would not fit into an int.
+func Desugar(e *Expr) (*Expr, error) {
+	d := &desugarer{base: maxVariable(e)}
+	core := d.desugar(e)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.count == 0 {
+		return core, nil
+	}
+	b := builder{e.Pos, e.End}
+	var stmts []*Expr
+	for i := 0; i < d.count; i++ {
+		stmts = append(stmts, b.clear(d.base+1+i))
+	}
+	return b.seq(append(stmts, core)...), nil
+}
+
+// maxVariable returns the highest variable number used in e, at least 0.
+func maxVariable(e *Expr) int {
+	max := 0
+	Walk(e, func(e *Expr) bool {
+		var vars []int
+		switch e.Type {
+		case INCR_EXPR:
+			vars = []int{e.IncrExpr.Variable, e.IncrExpr.Source}
+		case WHILE_EXPR:
+			vars = []int{e.WhileExpr.Variable}
+		case ASSIGN_EXPR:
+			vars = []int{e.AssignExpr.Variable, e.AssignExpr.Source, e.AssignExpr.Factor}
+		case IF_EXPR:
+			vars = []int{e.IfExpr.Variable}
+		case LOOP_EXPR:
+			vars = []int{e.LoopExpr.Variable}
+		case CALL_EXPR:
+			vars = e.CallExpr.Args
+		}
+		for _, v := range vars {
+			if v > max {
+				max = v
+			}
+		}
+		return true
+	})
+	return max
+}
+
+// maxInt is the highest value of an int.
+const maxInt = int(^uint(0) >> 1)
+
+// desugarer lowers the sugar dialect to the core language.
+type desugarer struct {
+	// base is the highest variable used by the program. The temporary
+	// variables are x(base+1), x(base+2), ...
+	base int
+	// next is the index of the next unused temporary variable and count
+	// the number of temporaries used so far.
+	next, count int
+	// err is set if a temporary variable would be larger than maxInt.
+	err error
+}
+
+// temp returns an unused temporary variable, which is 0.
+func (d *desugarer) temp() int {
+	i := d.next
+	d.next++
+	if d.next > d.count {
+		d.count = d.next
+	}
+	if i >= maxInt-d.base {
+		if d.err == nil {
+			d.err = fmt.Errorf("x%d is too large to number temporary variables after it", d.base)
+		}
+		return d.base
+	}
+	return d.base + 1 + i
+}
+
+// desugar lowers e and its subexpressions.
+func (d *desugarer) desugar(e *Expr) *Expr {
+	b := builder{e.Pos, e.End}
+	switch e.Type {
+	case INCR_EXPR:
+		incr := *e.IncrExpr
+		if incr.General {
+			// A generalised increment expression is lowered like the
+			// equivalent assignment.
+			op := PLUS
+			if incr.Decrement {
+				op = MINUS
+			}
+			assign := &AssignExpr{Variable: incr.Variable, Op: op, Source: incr.Source, Constant: incr.Constant}
+			return d.desugar(&Expr{Type: ASSIGN_EXPR, Pos: e.Pos, End: e.End, AssignExpr: assign})
+		}
+		return &Expr{Type: INCR_EXPR, Pos: e.Pos, End: e.End, IncrExpr: &incr}
+	case SEQ_EXPR:
+		return &Expr{Type: SEQ_EXPR, Pos: e.Pos, End: e.End,
+			SeqExpr: &SeqExpr{d.desugar(e.SeqExpr.P1), d.desugar(e.SeqExpr.P2)}}
+	case WHILE_EXPR:
+		return b.while(e.WhileExpr.Variable, d.desugar(e.WhileExpr.P))
+	}
+
+	// The temporaries are free again after the statement, since they are
+	// reset to 0.
+	defer func(next int) { d.next = next }(d.next)
+	var stmts []*Expr
+	switch e.Type {
+	case ASSIGN_EXPR:
+		a := e.AssignExpr
+		switch {
+		case a.Op == TIMES:
+			r, n, t := d.temp(), d.temp(), d.temp()
+			stmts = append(stmts,
+				b.addTo(n, a.Source, t),
+				b.while(n, b.decr(n), b.addTo(r, a.Factor, t)),
+				b.clear(a.Variable),
+				b.move(a.Variable, r))
+		case a.Op == CONSTANT:
+			stmts = append(stmts, b.clear(a.Variable))
+		case a.Source != a.Variable:
+			stmts = append(stmts, b.clear(a.Variable), b.addTo(a.Variable, a.Source, d.temp()))
+		}
+		if a.Op != TIMES {
+			stmts = append(stmts, d.addConstant(b, a.Variable, a.Constant, a.Op == MINUS)...)
+		}
+		if len(stmts) == 0 {
+			// There is no empty statement, so do nothing with two steps.
+			stmts = append(stmts, b.incr(a.Variable), b.decr(a.Variable))
+		}
+	case IF_EXPR:
+		// The first loop is entered if xN != 0 and clears the flag for
+		// the second one.
+		t, u, flag := d.temp(), d.temp(), d.temp()
+		first := []*Expr{b.clear(t), b.decr(flag)}
+		if e.IfExpr.Else != nil {
+			first = append(first, d.desugar(e.IfExpr.Else))
+		}
+		stmts = append(stmts,
+			b.addTo(t, e.IfExpr.Variable, u),
+			b.incr(flag),
+			b.while(t, first...),
+			b.while(flag, b.decr(flag), d.desugar(e.IfExpr.Then)))
+	case LOOP_EXPR:
+		n, t := d.temp(), d.temp()
+		stmts = append(stmts,
+			b.addTo(n, e.LoopExpr.Variable, t),
+			b.while(n, b.decr(n), d.desugar(e.LoopExpr.P)))
+	default:
+		panic("whilego: cannot desugar " + e.String())
+	}
+	return b.seq(stmts...)
+}
+
+// smallConstant is the largest constant added by repeated increments.
+// Larger constants are built by doubling, so the program stays small.
+const smallConstant = 16
+
+// addConstant returns statements adding c to xN or subtracting it if
+// decrement is set.
+func (d *desugarer) addConstant(b builder, n int, c uint64, decrement bool) []*Expr {
+	step := b.incr
+	if decrement {
+		step = b.decr
+	}
+	var stmts []*Expr
+	if c <= smallConstant {
+		for i := uint64(0); i < c; i++ {
+			stmts = append(stmts, step(n))
+		}
+		return stmts
+	}
+
+	// Build c in t bit by bit, starting with the highest one.
+	t, u := d.temp(), d.temp()
+	for bit := 63; bit >= 0; bit-- {
+		if len(stmts) > 0 {
+			stmts = append(stmts, b.move(u, t), b.while(u, b.decr(u), b.incr(t), b.incr(t)))
+		}
+		if c>>uint(bit)&1 == 1 {
+			stmts = append(stmts, b.incr(t))
+		}
+	}
+	return append(stmts, b.while(t, b.decr(t), step(n)))
+}
+
+// builder creates core expressions with the position of a statement.
+type builder struct {
+	pos, end Pos
+}
+
+// incr returns `xN := xN + 1`.
+func (b builder) incr(n int) *Expr {
+	return &Expr{Type: INCR_EXPR, Pos: b.pos, End: b.end, IncrExpr: &IncrExpr{Variable: n}}
+}
+
+// decr returns `xN := xN - 1`.
+func (b builder) decr(n int) *Expr {
+	return &Expr{Type: INCR_EXPR, Pos: b.pos, End: b.end, IncrExpr: &IncrExpr{Variable: n, Decrement: true}}
+}
+
+// while returns `WHILE xN != 0 DO P END` with the sequence of body as P.
+func (b builder) while(n int, body ...*Expr) *Expr {
+	return &Expr{Type: WHILE_EXPR, Pos: b.pos, End: b.end, WhileExpr: &WhileExpr{n, b.seq(body...)}}
+}
+
+// seq returns the sequence of the non-empty list of expressions.
+func (b builder) seq(es ...*Expr) *Expr {
+	if len(es) == 1 {
+		return es[0]
+	}
+	return &Expr{Type: SEQ_EXPR, Pos: b.pos, End: b.end, SeqExpr: &SeqExpr{es[0], b.seq(es[1:]...)}}
+}
+
+// clear sets xN to 0.
+func (b builder) clear(n int) *Expr {
+	return b.while(n, b.decr(n))
+}
+
+// move adds xM to xN and sets xM to 0.
+func (b builder) move(n, m int) *Expr {
+	return b.while(m, b.decr(m), b.incr(n))
+}
+
+// addTo adds xM to xN using the temporary variable xT, which has to be 0.
+func (b builder) addTo(n, m, t int) *Expr {
+	return b.seq(b.while(m, b.decr(m), b.incr(n), b.incr(t)), b.move(m, t))
+}
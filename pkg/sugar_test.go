@@ -0,0 +1,187 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParseSugar(t testing.TB, input string) *Expr {
+	t.Helper()
+	prog, err := NewSugarParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		t.Fatalf("%q: %s", input, err)
+	}
+	return prog
+}
+
+func mustDesugar(t testing.TB, e *Expr) *Expr {
+	t.Helper()
+	core, err := Desugar(e)
+	if err != nil {
+		t.Fatalf("%s: %s", Format(e), err)
+	}
+	return core
+}
+
+func TestParseSugar(t *testing.T) {
+	incr := makeIncrExpr(1, false)
+	tests := map[string]struct {
+		input    string
+		expected Expr
+	}{
+		"Constant": {"x1 := 42", Expr{Type: ASSIGN_EXPR,
+			AssignExpr: &AssignExpr{Variable: 1, Op: CONSTANT, Constant: 42}}},
+		"Plus": {"x1 := x2 + 3", Expr{Type: ASSIGN_EXPR,
+			AssignExpr: &AssignExpr{Variable: 1, Op: PLUS, Source: 2, Constant: 3}}},
+		"Minus": {"x1 := x1 - 2", Expr{Type: ASSIGN_EXPR,
+			AssignExpr: &AssignExpr{Variable: 1, Op: MINUS, Source: 1, Constant: 2}}},
+		"Copy": {"x1 := x2", Expr{Type: ASSIGN_EXPR,
+			AssignExpr: &AssignExpr{Variable: 1, Op: PLUS, Source: 2}}},
+		"Times": {"x1 := x2 * x3", Expr{Type: ASSIGN_EXPR,
+			AssignExpr: &AssignExpr{Variable: 1, Op: TIMES, Source: 2, Factor: 3}}},
+		"Increment": {"x1 := x1 + 1", incr},
+		"If": {"IF x2 = 0 THEN x1 := x1 + 1 END", Expr{Type: IF_EXPR,
+			IfExpr: &IfExpr{Variable: 2, Then: &incr}}},
+		"If else": {"IF x2 = 0 THEN x1 := x1 + 1 ELSE x1 := x1 + 1 END", Expr{Type: IF_EXPR,
+			IfExpr: &IfExpr{Variable: 2, Then: &incr, Else: &incr}}},
+		"Loop": {"LOOP x2 DO x1 := x1 + 1 END", Expr{Type: LOOP_EXPR,
+			LoopExpr: &LoopExpr{Variable: 2, P: &incr}}},
+	}
+
+	for caseName, testCase := range tests {
+		expr := mustParseSugar(t, testCase.input)
+		clearPos(expr)
+		if !reflect.DeepEqual(*expr, testCase.expected) {
+			t.Errorf("%s: expected %s, got %s", caseName, testCase.expected, expr)
+		}
+	}
+}
+
+func TestParseSugarErrors(t *testing.T) {
+	tests := map[string]string{
+		"Missing constant": "x1 := x2 +",
+		"Times constant":   "x1 := x2 * 3",
+		"Overflow":         "x1 := 18446744073709551616",
+		"If compare 1":     "IF x1 = 1 THEN x1 := x1 + 1 END",
+		"If not equal":     "IF x1 != 0 THEN x1 := x1 + 1 END",
+		"Missing END":      "IF x1 = 0 THEN x1 := x1 + 1 ELSE x1 := x1 - 1",
+		"Loop condition":   "LOOP x1 != 0 DO x1 := x1 + 1 END",
+		"Keyword":          "THEN",
+	}
+
+	for caseName, input := range tests {
+		if expr, err := NewSugarParser(strings.NewReader(input)).Parse(); err == nil {
+			t.Errorf("%s: expected error, got %s", caseName, expr)
+		}
+	}
+}
+
+func TestDesugar(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		args     []uint64
+		expected uint64
+	}{
+		"Constant":        {"x0 := x0 + 1; x0 := 5", nil, 5},
+		"Constant zero":   {"x0 := x0 + 1; x0 := 0", nil, 0},
+		"Plus":            {"x0 := x1 + 3", []uint64{4}, 7},
+		"Minus":           {"x0 := x1 - 3", []uint64{5}, 2},
+		"Monus":           {"x0 := x1 - 3", []uint64{2}, 0},
+		"Same variable":   {"x1 := x1 + 3; x0 := x1", []uint64{2}, 5},
+		"No-op":           {"x0 := x0; x0 := x0 + 0", nil, 0},
+		"Times":           {"x0 := x1 * x2", []uint64{6, 7}, 42},
+		"Square":          {"x1 := x1 * x1; x0 := x1", []uint64{5}, 25},
+		"Times aliased":   {"x0 := x1 + 2; x0 := x0 * x1", []uint64{3}, 15},
+		"Then":            {"IF x1 = 0 THEN x0 := 1 ELSE x0 := 2 END", []uint64{0}, 1},
+		"Else":            {"IF x1 = 0 THEN x0 := 1 ELSE x0 := 2 END", []uint64{3}, 2},
+		"If without else": {"IF x1 = 0 THEN x0 := 1 END; x0 := x0 + 1", []uint64{3}, 1},
+		"Loop":            {"LOOP x1 DO x0 := x0 + 2 END", []uint64{4}, 8},
+		// The number of iterations is fixed when the loop starts.
+		"Loop changes variable": {"LOOP x1 DO x1 := x1 + 1; x0 := x0 + 1 END", []uint64{3}, 3},
+		"Nested": {`LOOP x1 DO
+  IF x2 = 0 THEN x0 := 1 ELSE x0 := x0 * x2 END;
+  x2 := x2 + 1
+END`, []uint64{4, 0}, 6},
+		"Core": {mulProg, []uint64{3, 4}, 12},
+		// Input beyond the used variables must not affect the temporaries.
+		"Extra input":    {"x0 := x1 * x2", []uint64{3, 4, 9, 9, 9}, 12},
+		"Extra input if": {"IF x1 = 0 THEN x0 := 1 ELSE x0 := 2 END", []uint64{0, 5, 5, 5}, 1},
+		"Large constant": {"x0 := 1000; x0 := x0 - 999", nil, 1},
+	}
+
+	for caseName, testCase := range tests {
+		prog := mustDesugar(t, mustParseSugar(t, testCase.input))
+		Walk(prog, func(e *Expr) bool {
+			if e.Type != INCR_EXPR && e.Type != SEQ_EXPR && e.Type != WHILE_EXPR {
+				t.Errorf("%s: expected core program, got %s", caseName, e)
+			}
+			return true
+		})
+		in := NewInterpreter(prog, testCase.args...)
+		if err := in.Run(1000000); err != nil || in.Var(0) != testCase.expected {
+			t.Errorf("%s: expected %d, got %d, %v", caseName, testCase.expected, in.Var(0), err)
+		}
+		// The temporaries are reset after use.
+		for i, v := range in.Vars() {
+			if i > maxVariable(mustParseSugar(t, testCase.input)) && v != 0 {
+				t.Errorf("%s: temporary x%d is %d at the end", caseName, i, v)
+			}
+		}
+	}
+}
+
+func TestDesugarLargeConstant(t *testing.T) {
+	// Constants are built by doubling instead of one increment each.
+	prog := mustDesugar(t, mustParseSugar(t, "x0 := 9000000000000000000"))
+	if size := Size(prog); size > 1000 {
+		t.Errorf("expected a small program, got size %d", size)
+	}
+}
+
+func TestDesugarLargeVariables(t *testing.T) {
+	// Core programs need no temporaries, even with the largest variable.
+	prog := mustParse(t, "x9223372036854775807 := x9223372036854775807 + 1")
+	if core, err := Desugar(prog); err != nil || Format(core) != Format(prog) {
+		t.Errorf("expected the program unchanged, got %v, %v", core, err)
+	}
+
+	for _, input := range []string{"x9223372036854775807 := x1 + 0", "x9223372036854775805 := x1 * x2"} {
+		if _, err := Desugar(mustParseSugar(t, input)); err == nil {
+			t.Errorf("%s: expected an error for the temporaries", input)
+		}
+	}
+	if _, err := Desugar(mustParseSugar(t, "x9223372036854775804 := x1 * x2")); err != nil {
+		t.Errorf("expected three temporaries to fit, got %s", err)
+	}
+}
+
+func TestDesugarPositions(t *testing.T) {
+	prog := mustDesugar(t, mustParseSugar(t, "x1 := x1 + 1;\nx0 := 2"))
+	Walk(prog.SeqExpr.P2, func(e *Expr) bool {
+		if e.Pos != (Pos{2, 1}) || e.End != (Pos{2, 8}) {
+			t.Errorf("expected %s at 2:1-2:8, got %s-%s", e, e.Pos, e.End)
+		}
+		return true
+	})
+}
@@ -0,0 +1,329 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Termination is the result of the termination analysis.
+type Termination int
+
+const (
+	// TERM_UNKNOWN is the result if neither termination nor
+	// non-termination could be proved.
+	TERM_UNKNOWN Termination = iota
+	// TERM_TERMINATES is the result for loops and programs which halt for
+	// all inputs.
+	TERM_TERMINATES
+	// TERM_DIVERGES is the result for loops and programs which do not halt
+	// for some inputs.
+	TERM_DIVERGES
+)
+
+// String returns the name of the result.
+func (t Termination) String() string {
+	switch t {
+	case TERM_TERMINATES:
+		return "terminates"
+	case TERM_DIVERGES:
+		return "diverges"
+	}
+	return "unknown"
+}
+
+// TerminationInfo is the result of the termination analysis of a while
+// expression or a whole program.
+type TerminationInfo struct {
+	// Loop is the while expression or nil for the program.
+	Loop *Expr
+	Kind Termination
+	// Inputs describes the inputs for which a diverging loop or program
+	// does not halt, e.g. "inputs with x1 != 0".
+	Inputs string
+	// Reason justifies the result.
+	Reason string
+}
+
+// String returns the result in the form
+// `3:1: WHILE x1 != 0 DO: diverges for inputs with x1 != 0, x1 is never decremented in the body`.
+func (t TerminationInfo) String() string {
+	s := "program"
+	if t.Loop != nil {
+		s = fmt.Sprintf("%s: %s", t.Loop.Pos, statementString(t.Loop))
+	}
+	s += ": " + t.Kind.String()
+	if t.Kind == TERM_DIVERGES {
+		s += " for " + t.Inputs
+	}
+	return s + ", " + t.Reason
+}
+
+// ProveTermination tries to prove that the core program prog and its while
+// expressions halt or do not halt. inputs is the number of input variables
+// or -1 if it is unknown, like for Vet. It returns the result for the
+// program and for every while expression in source order.
+//
+// A loop `WHILE xN != 0 DO P END` terminates if it is never entered, or if
+// all nested loops terminate and xN decreases in every iteration, which is
+// the case if the statements of P outside of nested loops add up to a
+// negative change of xN, no prefix of them decreases xN more than all of
+// them and nested loops never increase xN. xN is a ranking function then.
+// It also terminates if all nested loops terminate and P contains a nested
+// loop over xN, which is not followed by an increment of xN, like the
+// conditionals `WHILE t != 0 DO CLEAR(t); Q END`. Then xN is 0 at the end
+// of P, so the loop runs at most once.
+//
+// A loop diverges if it is entered and P never decrements xN. The inputs
+// for which it is entered are only known if the loop is not nested, all
+// loops before it terminate and xN is positive before the loop or an input
+// which has not been written yet.
+func ProveTermination(prog *Expr, inputs int) (TerminationInfo, []TerminationInfo) {
+	pr := &prover{
+		pass:  &Pass{Prog: prog, Inputs: inputs},
+		entry: make(map[*Expr]signState),
+		infos: make(map[*Expr]TerminationInfo),
+	}
+	analyzeSigns(pr.pass, func(e *Expr, s signState) {
+		if e.Type == WHILE_EXPR {
+			pr.entry[e] = s
+		}
+	})
+
+	// Loops which are not nested may diverge for a known class of inputs.
+	var written []int
+	earlier := TERM_TERMINATES
+	for _, stmt := range statements(prog) {
+		if stmt.Type == WHILE_EXPR && earlier == TERM_TERMINATES {
+			pr.topLevel(stmt, written)
+		}
+		if stmt.Type == WHILE_EXPR && pr.loop(stmt).Kind != TERM_TERMINATES {
+			earlier = TERM_UNKNOWN
+		}
+		written = append(written, writes(stmt)...)
+	}
+
+	var loops []TerminationInfo
+	result := TerminationInfo{Kind: TERM_TERMINATES}
+	Walk(prog, func(e *Expr) bool {
+		if e.Type != WHILE_EXPR {
+			return true
+		}
+		info := pr.loop(e)
+		loops = append(loops, info)
+		switch {
+		case result.Kind == TERM_DIVERGES:
+		case info.Kind == TERM_DIVERGES:
+			result = TerminationInfo{Kind: TERM_DIVERGES, Inputs: info.Inputs,
+				Reason: fmt.Sprintf("the loop at %s does not halt", e.Pos)}
+		case result.Kind == TERM_TERMINATES && info.Kind == TERM_UNKNOWN:
+			result.Kind, result.Reason = TERM_UNKNOWN, fmt.Sprintf("the loop at %s may not halt", e.Pos)
+		}
+		return true
+	})
+	if result.Kind == TERM_TERMINATES {
+		switch len(loops) {
+		case 0:
+			result.Reason = "the program has no loops"
+		case 1:
+			result.Reason = "its loop terminates"
+		default:
+			result.Reason = fmt.Sprintf("all %d loops terminate", len(loops))
+		}
+	}
+	return result, loops
+}
+
+// prover caches the results of the loops.
+type prover struct {
+	pass *Pass
+	// entry is the state before every reachable loop.
+	entry map[*Expr]signState
+	infos map[*Expr]TerminationInfo
+}
+
+// writes returns the variables written in e, which may be decremented.
+func writes(e *Expr) []int {
+	var vars []int
+	Walk(e, func(e *Expr) bool {
+		if w, _ := access(e); w >= 0 {
+			vars = append(vars, w)
+		}
+		return true
+	})
+	return vars
+}
+
+// loop returns the result for the loop e regardless of the inputs.
+func (pr *prover) loop(e *Expr) TerminationInfo {
+	if info, ok := pr.infos[e]; ok {
+		return info
+	}
+	v := e.WhileExpr.Variable
+	info := TerminationInfo{Loop: e}
+	entry, reachable := pr.entry[e]
+	switch {
+	case !reachable:
+		info.Kind, info.Reason = TERM_TERMINATES, "the loop is never reached"
+	case entry.get(v) == signZero:
+		info.Kind, info.Reason = TERM_TERMINATES, fmt.Sprintf("x%d is always 0 before the loop, so it is never entered", v)
+	default:
+		info.Reason = pr.ranking(e)
+		if info.Reason == "" {
+			info.Kind, info.Reason = TERM_TERMINATES, fmt.Sprintf("x%d decreases in every iteration", v)
+		} else if reason := pr.runsOnce(e); reason != "" {
+			info.Kind, info.Reason = TERM_TERMINATES, reason
+		} else if reason := divergenceReason(e); reason != "" {
+			info.Reason = fmt.Sprintf("it does not halt if entered, since %s, but it is unknown for which inputs", reason)
+		}
+	}
+	pr.infos[e] = info
+	return info
+}
+
+// topLevel records the result for a loop which is not nested, where all
+// loops before it terminate and written are the variables written before
+// it.
+func (pr *prover) topLevel(e *Expr, written []int) {
+	info := pr.loop(e)
+	v := e.WhileExpr.Variable
+	reason := divergenceReason(e)
+	if info.Kind != TERM_UNKNOWN || reason == "" {
+		return
+	}
+	info.Kind, info.Reason = TERM_DIVERGES, reason
+	if pr.entry[e].get(v) == signPositive {
+		info.Inputs = "all inputs"
+		pr.infos[e] = info
+		return
+	}
+	if !pr.pass.isInput(v) {
+		return
+	}
+	for _, w := range written {
+		if w == v {
+			return
+		}
+	}
+	info.Inputs = fmt.Sprintf("inputs with x%d != 0", v)
+	pr.infos[e] = info
+}
+
+// ranking returns why the loop variable is not a ranking function of the
+// loop e, or "" if it is one and all nested loops terminate. The changes of
+// the variable are summed up exactly, since the constants of general
+// increments may be as large as the variables.
+func (pr *prover) ranking(e *Expr) string {
+	v := e.WhileExpr.Variable
+	total, min := new(big.Int), new(big.Int)
+	for _, stmt := range statements(e.WhileExpr.P) {
+		switch stmt.Type {
+		case INCR_EXPR:
+			incr := stmt.IncrExpr
+			if incr.Variable != v {
+				continue
+			}
+			if incr.General && incr.Source != v {
+				return fmt.Sprintf("x%d is assigned in the body", v)
+			}
+			_, c := incr.operands()
+			change := new(big.Int).SetUint64(c)
+			if incr.Decrement {
+				change.Neg(change)
+			}
+			if total.Add(total, change).Cmp(min) < 0 {
+				min.Set(total)
+			}
+		case WHILE_EXPR:
+			if info := pr.loop(stmt); info.Kind != TERM_TERMINATES {
+				return fmt.Sprintf("the nested loop at %s may not halt", stmt.Pos)
+			}
+			increased := false
+			Walk(stmt, func(e *Expr) bool {
+				w, _ := access(e)
+				increased = increased || w == v && !isDecrement(e)
+				return !increased
+			})
+			if increased {
+				return fmt.Sprintf("x%d is increased in the nested loop at %s", v, stmt.Pos)
+			}
+		default:
+			return "the body is not a core program"
+		}
+	}
+	switch {
+	case total.Sign() >= 0:
+		return fmt.Sprintf("x%d does not decrease in the body", v)
+	case total.Cmp(min) > 0:
+		return fmt.Sprintf("x%d may stop at 0 and increase again in the body", v)
+	}
+	return ""
+}
+
+// runsOnce returns why the loop e runs at most once, or "" if it may run
+// more often or a nested loop may not halt. A nested loop over the loop
+// variable leaves it 0, so it is still 0 at the end of the body, if it is
+// not increased after the nested loop.
+func (pr *prover) runsOnce(e *Expr) string {
+	v := e.WhileExpr.Variable
+	var cleared *Expr
+	for _, stmt := range statements(e.WhileExpr.P) {
+		if stmt.Type == WHILE_EXPR && pr.loop(stmt).Kind != TERM_TERMINATES {
+			return ""
+		}
+		if stmt.Type == WHILE_EXPR && stmt.WhileExpr.Variable == v {
+			cleared = stmt
+			continue
+		}
+		Walk(stmt, func(e *Expr) bool {
+			if w, _ := access(e); w == v && !isDecrement(e) {
+				cleared = nil
+			}
+			return true
+		})
+	}
+	if cleared == nil {
+		return ""
+	}
+	return fmt.Sprintf("x%d is 0 after the nested loop at %s, so the loop runs at most once", v, cleared.Pos)
+}
+
+// divergenceReason returns why the loop e does not halt once entered, or ""
+// if it may halt.
+func divergenceReason(e *Expr) string {
+	v := e.WhileExpr.Variable
+	modified, decremented := false, false
+	Walk(e.WhileExpr.P, func(e *Expr) bool {
+		if w, _ := access(e); w == v {
+			modified = true
+			decremented = decremented || !(e.Type == INCR_EXPR && !e.IncrExpr.Decrement && (!e.IncrExpr.General || e.IncrExpr.Source == v))
+		}
+		return true
+	})
+	switch {
+	case !modified:
+		return fmt.Sprintf("the body never modifies x%d", v)
+	case !decremented:
+		return fmt.Sprintf("x%d is only incremented in the body", v)
+	}
+	return ""
+}
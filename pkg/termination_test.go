@@ -0,0 +1,151 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestProveTermination(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		inputs int
+		result string
+		loops  []string
+	}{
+		"No loops": {"x0 := x0 + 1", 1, "program: terminates, the program has no loops", nil},
+		"Add": {addProg, 2, "program: terminates, all 2 loops terminate",
+			[]string{"1:1: WHILE x1 != 0 DO: terminates, x1 decreases in every iteration",
+				"2:1: WHILE x2 != 0 DO: terminates, x2 decreases in every iteration"}},
+		"Never entered": {"WHILE x2 != 0 DO x2 := x2 + 1 END", 1, "program: terminates, its loop terminates",
+			[]string{"1:1: WHILE x2 != 0 DO: terminates, x2 is always 0 before the loop, so it is never entered"}},
+		"Net decrease": {"WHILE x1 != 0 DO\n  x1 := x1 + 1;\n  x1 := x1 - 1;\n  x1 := x1 - 1;\n  WHILE x2 != 0 DO x2 := x2 - 1; x1 := x1 - 1 END\nEND", 2,
+			"program: terminates, all 2 loops terminate",
+			[]string{"1:1: WHILE x1 != 0 DO: terminates, x1 decreases in every iteration",
+				"5:3: WHILE x2 != 0 DO: terminates, x2 decreases in every iteration"}},
+		"Increment after zero": {"WHILE x1 != 0 DO x1 := x1 - 1; x1 := x1 - 1; x1 := x1 + 1 END", 1,
+			"program: unknown, the loop at 1:1 may not halt",
+			[]string{"1:1: WHILE x1 != 0 DO: unknown, x1 may stop at 0 and increase again in the body"}},
+		"Nested increment": {"WHILE x1 != 0 DO\n  x1 := x1 - 1;\n  WHILE x2 != 0 DO x2 := x2 - 1; x1 := x1 + 1 END\nEND", 2,
+			"program: unknown, the loop at 1:1 may not halt",
+			[]string{"1:1: WHILE x1 != 0 DO: unknown, x1 is increased in the nested loop at 3:3",
+				"3:3: WHILE x2 != 0 DO: terminates, x2 decreases in every iteration"}},
+		"Input": {"WHILE x1 != 0 DO x1 := x1 - 1 END;\nWHILE x2 != 0 DO x0 := x0 + 1 END", 2,
+			"program: diverges for inputs with x2 != 0, the loop at 2:1 does not halt",
+			[]string{"1:1: WHILE x1 != 0 DO: terminates, x1 decreases in every iteration",
+				"2:1: WHILE x2 != 0 DO: diverges for inputs with x2 != 0, the body never modifies x2"}},
+		"All inputs": {"x1 := x1 + 1;\nWHILE x1 != 0 DO x1 := x1 + 1 END", 1,
+			"program: diverges for all inputs, the loop at 2:1 does not halt",
+			[]string{"2:1: WHILE x1 != 0 DO: diverges for all inputs, x1 is only incremented in the body"}},
+		"Written before": {"x1 := x1 - 1;\nWHILE x1 != 0 DO x0 := x0 + 1 END", 1,
+			"program: unknown, the loop at 2:1 may not halt",
+			[]string{"2:1: WHILE x1 != 0 DO: unknown, it does not halt if entered, since the body never modifies x1, but it is unknown for which inputs"}},
+		"Large constant": {"x1 := x1 + 1;\nWHILE x1 != 0 DO x1 := x1 + 9223372036854775808 END", 1,
+			"program: diverges for all inputs, the loop at 2:1 does not halt",
+			[]string{"2:1: WHILE x1 != 0 DO: diverges for all inputs, x1 is only incremented in the body"}},
+		"Large constants": {"WHILE x1 != 0 DO x1 := x1 + 9223372036854775808; x1 := x1 + 9223372036854775808 END", 1,
+			"program: diverges for inputs with x1 != 0, the loop at 1:1 does not halt",
+			[]string{"1:1: WHILE x1 != 0 DO: diverges for inputs with x1 != 0, x1 is only incremented in the body"}},
+		"Large decrement": {"WHILE x1 != 0 DO x1 := x1 + 9223372036854775808; x1 := x1 - 18446744073709551615 END", 1,
+			"program: terminates, its loop terminates",
+			[]string{"1:1: WHILE x1 != 0 DO: terminates, x1 decreases in every iteration"}},
+		"Nested divergence": {"WHILE x1 != 0 DO\n  x1 := x1 - 1;\n  WHILE x2 != 0 DO x0 := x0 + 1 END\nEND", 2,
+			"program: unknown, the loop at 1:1 may not halt",
+			[]string{"1:1: WHILE x1 != 0 DO: unknown, the nested loop at 3:3 may not halt",
+				"3:3: WHILE x2 != 0 DO: unknown, it does not halt if entered, since the body never modifies x2, but it is unknown for which inputs"}},
+		"Cleared": {"WHILE x1 != 0 DO WHILE x1 != 0 DO x1 := x1 - 1 END; x0 := x0 + 1 END", 1,
+			"program: terminates, all 2 loops terminate",
+			[]string{"1:1: WHILE x1 != 0 DO: terminates, x1 is 0 after the nested loop at 1:18, so the loop runs at most once",
+				"1:18: WHILE x1 != 0 DO: terminates, x1 decreases in every iteration"}},
+		"Increased after clearing": {"WHILE x1 != 0 DO WHILE x1 != 0 DO x1 := x1 - 1 END; x1 := x1 + 1 END", 1,
+			"program: unknown, the loop at 1:1 may not halt",
+			[]string{"1:1: WHILE x1 != 0 DO: unknown, x1 does not decrease in the body",
+				"1:18: WHILE x1 != 0 DO: terminates, x1 decreases in every iteration"}},
+	}
+
+	for caseName, testCase := range tests {
+		prog, err := NewParser(strings.NewReader(testCase.input), SchoeningDialect).Parse()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		result, loops := ProveTermination(prog, testCase.inputs)
+		if result.String() != testCase.result {
+			t.Errorf("%s: expected %q, got %q", caseName, testCase.result, result)
+		}
+		var got []string
+		for _, info := range loops {
+			got = append(got, info.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(testCase.loops, "\n") {
+			t.Errorf("%s: expected\n%s\ngot\n%s", caseName, strings.Join(testCase.loops, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestProveTerminationStdlib(t *testing.T) {
+	// The conditionals clear the copy of their condition in the loop.
+	for _, input := range []string{"IF(x1, { x0 := x0 + 1 })", "IFZ(x1, { x0 := x0 + 1 })",
+		"IFELSE(x1, { SET(x0, 1) }, { SET(x0, 2) })", "LT(x0, x1, x2)", "GE(x0, x1, x2)", "MUL(x0, x1, x2)"} {
+		prog, _, err := ParseMacros(input)
+		if err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		if result, _ := ProveTermination(prog, 2); result.Kind != TERM_TERMINATES {
+			t.Errorf("%s: expected termination, got %s", input, result)
+		}
+	}
+
+	prog := mustDesugar(t, mustParseSugar(t, "x2 := 5;\nx3 := x1 * x2;\nIF x3 = 0 THEN x0 := 1 ELSE x0 := x3 + 2 END"))
+	if result, _ := ProveTermination(prog, 1); result.Kind != TERM_TERMINATES {
+		t.Errorf("expected termination of the desugared program, got %s", result)
+	}
+}
+
+// TestProveTerminationSound checks the results against the interpreter on
+// random programs.
+func TestProveTerminationSound(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	opts := GenerateOptions{Depth: 3, Vars: 3, Statements: 3, LoopProb: 0.5}
+	const limit = 10000
+	for i := 0; i < 500; i++ {
+		prog := Generate(rng, opts)
+		result, _ := ProveTermination(prog, 2)
+		for _, input := range [][]uint64{{0, 0}, {1, 0}, {0, 2}, {3, 1}} {
+			_, err := Run(prog, limit, input...)
+			switch result.Kind {
+			case TERM_TERMINATES:
+				if err != nil {
+					t.Fatalf("%s: %s, but %v: %s", Format(prog), result, input, err)
+				}
+			case TERM_DIVERGES:
+				diverges := result.Inputs == "all inputs" ||
+					result.Inputs == "inputs with x1 != 0" && input[0] != 0 ||
+					result.Inputs == "inputs with x2 != 0" && input[1] != 0
+				if diverges && err != ErrStepLimit {
+					t.Fatalf("%s: %s, but %v halts", Format(prog), result, input)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TestCase is a test of a program: running it on Input has to yield Expected
+// as the value of x0.
+type TestCase struct {
+	// Line is the line of the test case in its test file or 0 if unknown.
+	Line     int      `json:"-"`
+	Input    []uint64 `json:"input"`
+	Expected uint64   `json:"output"`
+}
+
+// String returns the test case in the syntax of test files.
+func (tc TestCase) String() string {
+	input := make([]string, len(tc.Input))
+	for i, x := range tc.Input {
+		input[i] = strconv.FormatUint(x, 10)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s -> %d", strings.Join(input, " "), tc.Expected))
+}
+
+// ParseTests reads test cases from a test file.
+//
+// Every line contains one test case consisting of the input values x1, x2,
+// ... separated by spaces or commas, followed by -> and the expected value of
+// x0. Empty lines and everything after # are ignored. For example:
+//
+//	# x1 + x2
+//	2 3 -> 5
+//	0, 7 -> 7
+func ParseTests(r io.Reader) ([]TestCase, error) {
+	var tests []TestCase
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "->")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected input -> output", lineNum)
+		}
+		tc := TestCase{Line: lineNum}
+		inputs := strings.FieldsFunc(parts[0], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		for _, input := range inputs {
+			x, err := strconv.ParseUint(input, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid input: %s", lineNum, err)
+			}
+			tc.Input = append(tc.Input, x)
+		}
+		var err error
+		tc.Expected, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid output: %s", lineNum, err)
+		}
+		tests = append(tests, tc)
+	}
+	return tests, scanner.Err()
+}
+
+// ParseTestsJSON reads test cases from JSON in the form
+// `[{"input": [2, 3], "output": 5}, ...]`.
+func ParseTestsJSON(r io.Reader) ([]TestCase, error) {
+	var tests []TestCase
+	if err := json.NewDecoder(r).Decode(&tests); err != nil {
+		return nil, err
+	}
+	return tests, nil
+}
+
+// TestResult is the result of running a single test case.
+type TestResult struct {
+	Case TestCase
+	// Got is the value of x0 after the run.
+	Got   uint64
+	Steps int
+	// Err is ErrStepLimit if the program did not halt in time.
+	Err error
+	// Trace contains the last steps of the run.
+	Trace []TraceEntry
+}
+
+// Passed reports whether the program halted with the expected value of x0.
+func (r TestResult) Passed() bool { return r.Err == nil && r.Got == r.Case.Expected }
+
+// RunTest runs prog on the test case with at most limit steps. The last
+// traceLen steps are remembered in the result, which is useful for failed
+// tests.
+func RunTest(prog *Expr, tc TestCase, limit, traceLen int) TestResult {
+	in := NewInterpreter(prog, tc.Input...)
+	trace := NewTraceTail(in, traceLen)
+	err := in.Run(limit)
+	return TestResult{
+		Case:  tc,
+		Got:   in.Var(0),
+		Steps: in.Steps(),
+		Err:   err,
+		Trace: trace.Entries(),
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTests(t *testing.T) {
+	input := `# x0 = x1 + x2
+2 3 -> 5
+0, 7 -> 7   # comment
+
+-> 0
+`
+	expected := []TestCase{
+		{Line: 2, Input: []uint64{2, 3}, Expected: 5},
+		{Line: 3, Input: []uint64{0, 7}, Expected: 7},
+		{Line: 5, Expected: 0},
+	}
+
+	tests, err := ParseTests(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tests, expected) {
+		t.Fatalf("expected %v, got %v", expected, tests)
+	}
+
+	for _, invalid := range []string{"1 2", "1 -> 2 -> 3", "a -> 1", "1 -> -1"} {
+		if _, err := ParseTests(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseTestsJSON(t *testing.T) {
+	tests, err := ParseTestsJSON(strings.NewReader(`[{"input": [2, 3], "output": 5}, {"output": 1}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TestCase{{Input: []uint64{2, 3}, Expected: 5}, {Expected: 1}}
+	if !reflect.DeepEqual(tests, expected) {
+		t.Fatalf("expected %v, got %v", expected, tests)
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	prog := mustParse(t, addProg)
+
+	if r := RunTest(prog, TestCase{Input: []uint64{2, 3}, Expected: 5}, 0, 0); !r.Passed() {
+		t.Errorf("expected test to pass, got %d", r.Got)
+	}
+	r := RunTest(prog, TestCase{Input: []uint64{2, 3}, Expected: 6}, 0, 3)
+	if r.Passed() || r.Got != 5 || len(r.Trace) != 3 {
+		t.Errorf("expected failed test with trace, got %+v", r)
+	}
+	r = RunTest(mustParse(t, loopProg), TestCase{Expected: 0}, 100, 1)
+	if r.Passed() || r.Err != ErrStepLimit || r.Steps != 100 {
+		t.Errorf("expected step limit to be exceeded, got %+v", r)
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"fmt"
 )
 
-const _TokenName = "ILLEGALEOFWSVARIABLECONSTANTSEMICOLONASSIGNNOTEQUALPLUSMINUSWHILEDOEND"
+const _TokenName = "ILLEGALEOFWSVARIABLECONSTANTLABELNAMEIDENTSTRINGSEMICOLONASSIGNCOLONCOMMALPARENRPARENNOTEQUALEQUALPLUSMINUSTIMESWHILEDOENDODIFTHENELSELOOPGOTOHALTINPUTOUTPUTPROCBEGINIMPORT"
 
-var _TokenIndex = [...]uint8{0, 7, 10, 12, 20, 28, 37, 43, 51, 55, 60, 65, 67, 70}
+var _TokenIndex = [...]uint8{0, 7, 10, 12, 20, 28, 33, 37, 42, 48, 57, 63, 68, 73, 79, 85, 93, 98, 102, 107, 112, 117, 119, 122, 124, 126, 130, 134, 138, 142, 146, 151, 157, 161, 166, 172}
 
 func (i Token) String() string {
 	if i < 0 || i >= Token(len(_TokenIndex)-1) {
@@ -17,22 +17,44 @@ func (i Token) String() string {
 	return _TokenName[_TokenIndex[i]:_TokenIndex[i+1]]
 }
 
-var _TokenValues = []Token{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+var _TokenValues = []Token{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34}
 
 var _TokenNameToValueMap = map[string]Token{
-	_TokenName[0:7]:   0,
-	_TokenName[7:10]:  1,
-	_TokenName[10:12]: 2,
-	_TokenName[12:20]: 3,
-	_TokenName[20:28]: 4,
-	_TokenName[28:37]: 5,
-	_TokenName[37:43]: 6,
-	_TokenName[43:51]: 7,
-	_TokenName[51:55]: 8,
-	_TokenName[55:60]: 9,
-	_TokenName[60:65]: 10,
-	_TokenName[65:67]: 11,
-	_TokenName[67:70]: 12,
+	_TokenName[0:7]:     0,
+	_TokenName[7:10]:    1,
+	_TokenName[10:12]:   2,
+	_TokenName[12:20]:   3,
+	_TokenName[20:28]:   4,
+	_TokenName[28:33]:   5,
+	_TokenName[33:37]:   6,
+	_TokenName[37:42]:   7,
+	_TokenName[42:48]:   8,
+	_TokenName[48:57]:   9,
+	_TokenName[57:63]:   10,
+	_TokenName[63:68]:   11,
+	_TokenName[68:73]:   12,
+	_TokenName[73:79]:   13,
+	_TokenName[79:85]:   14,
+	_TokenName[85:93]:   15,
+	_TokenName[93:98]:   16,
+	_TokenName[98:102]:  17,
+	_TokenName[102:107]: 18,
+	_TokenName[107:112]: 19,
+	_TokenName[112:117]: 20,
+	_TokenName[117:119]: 21,
+	_TokenName[119:122]: 22,
+	_TokenName[122:124]: 23,
+	_TokenName[124:126]: 24,
+	_TokenName[126:130]: 25,
+	_TokenName[130:134]: 26,
+	_TokenName[134:138]: 27,
+	_TokenName[138:142]: 28,
+	_TokenName[142:146]: 29,
+	_TokenName[146:151]: 30,
+	_TokenName[151:157]: 31,
+	_TokenName[157:161]: 32,
+	_TokenName[161:166]: 33,
+	_TokenName[166:172]: 34,
 }
 
 // TokenString retrieves an enum value from the enum constants string name.
@@ -0,0 +1,103 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TraceEntry describes a single executed step.
+type TraceEntry struct {
+	// Step is the number of the step, starting with 1.
+	Step int
+	// Expr is the executed increment or while expression.
+	Expr *Expr
+	// Cond is the value of the condition of a while expression.
+	Cond bool
+	// Vars are the values of all variables after the step.
+	Vars []uint64
+	// Registers are the numbers of the variables in Vars, see
+	// Interpreter.Registers. If nil, Vars are x0, x1, ...
+	Registers []int
+}
+
+// String returns the entry in the form `step 3 at 1:5: x1 := x1 - 1 [x0=0 x1=2]`.
+func (t TraceEntry) String() string {
+	stmt := statementString(t.Expr)
+	switch t.Expr.Type {
+	case WHILE_EXPR:
+		stmt = fmt.Sprintf("WHILE x%d != 0 is %t", t.Expr.WhileExpr.Variable, t.Cond)
+	case LOOP_EXPR:
+		stmt = fmt.Sprintf("LOOP x%d iterates %t", t.Expr.LoopExpr.Variable, t.Cond)
+	}
+	vars := make([]string, len(t.Vars))
+	for i, v := range t.Vars {
+		n := i
+		if t.Registers != nil {
+			n = t.Registers[i]
+		}
+		vars[i] = fmt.Sprintf("x%d=%d", n, v)
+	}
+	return fmt.Sprintf("step %d at %s: %s [%s]", t.Step, t.Expr.Pos, stmt, strings.Join(vars, " "))
+}
+
+// TraceTail is a tracer remembering the last steps of an execution.
+type TraceTail struct {
+	in      *Interpreter
+	n       int // number of steps to remember
+	entries []TraceEntry
+	next    int // index of the oldest entry once the buffer is full
+}
+
+// NewTraceTail creates a trace remembering the last n steps of in and sets
+// it as the tracer of in. If n is not positive, no steps are remembered. The
+// buffer grows with the steps, so a large n costs memory only if the
+// execution takes that many steps.
+func NewTraceTail(in *Interpreter, n int) *TraceTail {
+	if n < 0 {
+		n = 0
+	}
+	t := &TraceTail{in: in, n: n}
+	in.SetTracer(t)
+	return t
+}
+
+// Step records the executed step.
+func (t *TraceTail) Step(e *Expr, cond bool) {
+	if t.n == 0 {
+		return
+	}
+	entry := TraceEntry{t.in.Steps(), e, cond, t.in.Vars(), t.in.regs}
+	if len(t.entries) < t.n {
+		t.entries = append(t.entries, entry)
+		return
+	}
+	t.entries[t.next] = entry
+	t.next = (t.next + 1) % len(t.entries)
+}
+
+// Entries returns the remembered steps, oldest first.
+func (t *TraceTail) Entries() []TraceEntry {
+	entries := make([]TraceEntry, 0, len(t.entries))
+	entries = append(entries, t.entries[t.next:]...)
+	return append(entries, t.entries[:t.next]...)
+}
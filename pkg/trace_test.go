@@ -0,0 +1,64 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import "testing"
+
+func TestTraceTail(t *testing.T) {
+	type TestCase struct {
+		n        int
+		expected []string
+	}
+
+	tests := map[string]TestCase{
+		"Nothing":  {0, []string{}},
+		"Negative": {-1, []string{}},
+		"Last 2": {2, []string{
+			"step 10 at 2:32: x0 := x0 + 1 [x0=3 x1=0 x2=0]",
+			"step 11 at 2:1: WHILE x2 != 0 is false [x0=3 x1=0 x2=0]",
+		}},
+		"More than executed": {100, []string{
+			"step 1 at 1:1: WHILE x1 != 0 is true [x0=0 x1=1 x2=2]",
+		}},
+		// The buffer grows with the steps instead of being allocated at once.
+		"Huge": {maxInt, []string{
+			"step 1 at 1:1: WHILE x1 != 0 is true [x0=0 x1=1 x2=2]",
+		}},
+	}
+
+	for caseName, testCase := range tests {
+		in := NewInterpreter(mustParse(t, addProg), 1, 2)
+		trace := NewTraceTail(in, testCase.n)
+		if err := in.Run(0); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := trace.Entries()
+		if testCase.n >= 100 && len(entries) != 11 {
+			t.Errorf("%s: expected all 11 steps, got %d", caseName, len(entries))
+		}
+		for i, expected := range testCase.expected {
+			if i >= len(entries) || entries[i].String() != expected {
+				t.Errorf("%s: entry %d: expected %q, got %v", caseName, i, expected, entries)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/big"
+	"strings"
+)
+
+// universalSource is the universal program in the structured language. The
+// inputs are the Gödel number p of a program and the number of its input
+// list, see EncodeInput.
+//
+// The memory x0, x1, ... is kept as list of numbers, where variables after
+// the end of the list are 0. Instead of a stack of the programs still to run,
+// which would grow very fast, the current subprogram is the path from the
+// root of p. Its digits in base 4 are 1 for the first part of a sequence, 2
+// for the second and 3 for the body of a loop, the last step is the lowest
+// digit. The main loop either enters the subprogram at path or returns from
+// it to its parent.
+const universalSource = `// tri returns the triangular number s·(s + 1)/2.
+func tri(s) {
+	return s * (s + 1) / 2;
+}
+
+// diag returns the diagonal a + b of the pair n.
+func diag(n) {
+	s = 0;
+	k = 1;
+	while k <= n {
+		n = n - k;
+		s = s + 1;
+		k = k + 1;
+	}
+	return s;
+}
+
+func fst(n) {
+	s = diag(n);
+	return s - (n - tri(s));
+}
+
+func snd(n) {
+	return n - tri(diag(n));
+}
+
+func cons(a, l) {
+	return tri(a + l) + l + 1;
+}
+
+// head returns the first element of the list l or 0 if it is empty.
+func head(l) {
+	a = 0;
+	if l { a = fst(l - 1); }
+	return a;
+}
+
+func tail(l) {
+	r = 0;
+	if l { r = snd(l - 1); }
+	return r;
+}
+
+func get(m, i) {
+	while i { m = tail(m); i = i - 1; }
+	return head(m);
+}
+
+// set returns the list m with the element i replaced by v.
+func set(m, i, v) {
+	r = 0;
+	while i { r = cons(head(m), r); m = tail(m); i = i - 1; }
+	m = cons(v, tail(m));
+	while r { m = cons(head(r), m); r = tail(r); }
+	return m;
+}
+
+// subterm returns the subprogram of p at path.
+func subterm(p, path) {
+	rev = 0;
+	while path { rev = rev * 4 + path % 4; path = path / 4; }
+	while rev {
+		if rev % 4 == 1 { p = fst(p / 4); } else { p = snd(p / 4); }
+		rev = rev / 4;
+	}
+	return p;
+}
+
+func main(p, input) {
+	m = cons(0, input);
+	path = 0;
+	entering = 1;
+	running = 1;
+	while running {
+		if entering {
+			c = subterm(p, path);
+			k = c % 4;
+			v = c / 4;
+			if k == 0 {
+				m = set(m, v, get(m, v) + 1);
+				entering = 0;
+			} else if k == 1 {
+				m = set(m, v, get(m, v) - 1);
+				entering = 0;
+			} else if k == 2 {
+				path = path * 4 + 1;
+			} else if get(m, fst(v)) {
+				path = path * 4 + 3;
+			} else {
+				entering = 0;
+			}
+		} else if path == 0 {
+			running = 0;
+		} else {
+			// Return to the parent, which continues with the second
+			// part of a sequence or checks the loop condition again.
+			d = path % 4;
+			path = path / 4;
+			if d == 1 {
+				path = path * 4 + 2;
+				entering = 1;
+			} else if d == 3 {
+				entering = 1;
+			}
+		}
+	}
+	return head(m);
+}`
+
+// Universal returns a universal program U. Its inputs are x1 = Encode(p) and
+// x2 = EncodeInput(input...) for some program p and U computes the same x0 as
+// p with the given input, or does not halt if p does not halt. Since values
+// are represented in unary, U is very slow even for small programs.
+func Universal() *Expr {
+	u, err := CompileStructured(strings.NewReader(universalSource))
+	if err != nil {
+		panic("whilego: universal program: " + err.Error())
+	}
+	return u
+}
+
+// EncodeInput returns the number of the list of inputs for the universal
+// program. The empty list is 0 and a list with first element a and the rest
+// l is Pair(a, l) + 1.
+func EncodeInput(input ...uint64) *big.Int {
+	code := new(big.Int)
+	for i := len(input) - 1; i >= 0; i-- {
+		code = Pair(new(big.Int).SetUint64(input[i]), code)
+		code.Add(code, big.NewInt(1))
+	}
+	return code
+}
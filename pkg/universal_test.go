@@ -0,0 +1,99 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodeInput(t *testing.T) {
+	// [2] is pair(2, 0) + 1 and [1, 2] is pair(1, 4) + 1.
+	tests := map[int64][]uint64{0: nil, 4: {2}, 20: {1, 2}}
+	for expected, input := range tests {
+		if code := EncodeInput(input...); code.Cmp(big.NewInt(expected)) != 0 {
+			t.Errorf("%v: expected %d, got %s", input, expected, code)
+		}
+	}
+}
+
+// runUniversal runs u on prog with the given input.
+func runUniversal(t *testing.T, u, prog *Expr, input ...uint64) uint64 {
+	p, in := mustEncode(t, prog), EncodeInput(input...)
+	if !p.IsUint64() || !in.IsUint64() {
+		t.Fatalf("%s: codes %s and %s are too large", Format(prog), p, in)
+	}
+	got, err := Run(u, 0, p.Uint64(), in.Uint64())
+	if err != nil {
+		t.Fatalf("%s: %s", Format(prog), err)
+	}
+	return got
+}
+
+func TestUniversal(t *testing.T) {
+	u := Universal()
+	// The universal program is a program of the core language.
+	u = mustParse(t, Format(u))
+
+	tests := []struct {
+		input string
+		args  []uint64
+	}{
+		{"x0 := x0 + 1", nil},
+		{"x0 := x0 - 1", nil},
+		{"x1 := x1 + 1; x0 := x0 + 1", []uint64{3}},
+		{"x1 := x1 - 1; x0 := x0 + 1; x0 := x0 + 1", []uint64{2}},
+		{"WHILE x1 != 0 DO x1 := x1 - 1 END", []uint64{3}},
+		{"WHILE x1 != 0 DO x1 := x1 - 1; x0 := x0 + 1 END", []uint64{2}},
+		{"x1 := x1 + 1; x0 := x0 + 1; x0 := x0 + 1", []uint64{1}},
+	}
+	for _, test := range tests {
+		prog := mustParse(t, test.input)
+		expected, _ := Run(prog, 0, test.args...)
+		if got := runUniversal(t, u, prog, test.args...); got != expected {
+			t.Errorf("%s with %v: expected %d, got %d", test.input, test.args, expected, got)
+		}
+	}
+}
+
+func TestUniversalRandom(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the universal program is slow")
+	}
+	u := Universal()
+	rng := rand.New(rand.NewSource(5))
+	for tested := 0; tested < 10; {
+		prog := randomProg(rng, 1, 2)
+		if mustEncode(t, prog).Cmp(big.NewInt(10000)) > 0 {
+			continue
+		}
+		x1 := uint64(rng.Intn(3))
+		expected, err := Run(prog, 1000, x1)
+		if err != nil {
+			continue
+		}
+		if got := runUniversal(t, u, prog, x1); got != expected {
+			t.Errorf("%s with %d: expected %d, got %d", Format(prog), x1, expected, got)
+		}
+		tested++
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diagnostic is a problem found by an analyzer.
+type Diagnostic struct {
+	Pos      Pos
+	Analyzer string
+	Message  string
+}
+
+// String returns the diagnostic in the form `3:1: message (analyzer)`.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Analyzer)
+}
+
+// Analyzer is a single check of Vet.
+type Analyzer struct {
+	Name string
+	Doc  string
+	Run  func(pass *Pass)
+}
+
+// Pass is the program checked by an analyzer.
+type Pass struct {
+	Prog *Expr
+	// Inputs is the number of input variables x1, ..., xk or -1 if it is
+	// unknown, then every variable but x0 may be an input.
+	Inputs int
+
+	analyzer string
+	diags    []Diagnostic
+	// shared contains the positions of more than one statement.
+	shared map[Pos]bool
+}
+
+// Reportf reports a problem at pos.
+func (p *Pass) Reportf(pos Pos, format string, a ...interface{}) {
+	p.diags = append(p.diags, Diagnostic{pos, p.analyzer, fmt.Sprintf(format, a...)})
+}
+
+// generated reports whether the statement e has no source position of its
+// own. Desugar, macros and procedures generate several statements with the
+// position of the statement or call they originate from, while every
+// statement written in the source has a position of its own.
+func (p *Pass) generated(e *Expr) bool {
+	if p.shared == nil {
+		p.shared = make(map[Pos]bool)
+		seen := make(map[Pos]bool)
+		Walk(p.Prog, func(e *Expr) bool {
+			if e.Type != SEQ_EXPR {
+				p.shared[e.Pos] = seen[e.Pos]
+				seen[e.Pos] = true
+			}
+			return true
+		})
+	}
+	return p.shared[e.Pos]
+}
+
+// isInput reports whether xV may be an input variable.
+func (p *Pass) isInput(v int) bool {
+	return v > 0 && (p.Inputs < 0 || v <= p.Inputs)
+}
+
+// Analyzers are the checks of Vet.
+var Analyzers = []Analyzer{
+	{"uninit", "report variables which are read but never written, so they are always 0", checkUninit},
+	{"deadloop", "report loops over variables which are always 0, so they are never entered", checkDeadLoop},
+	{"infloop", "report loops whose body never modifies the loop variable, so they do not halt if entered", checkInfLoop},
+	{"zerodecr", "report decrements of variables which are always 0", checkZeroDecr},
+	{"unusedinput", "report input variables which are never used", checkUnusedInput},
+	{"overwrite", "report writes to x0 which are overwritten before being used", checkOverwrite},
+}
+
+// LookupAnalyzer returns the analyzer with the given name.
+func LookupAnalyzer(name string) (Analyzer, bool) {
+	for _, a := range Analyzers {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Analyzer{}, false
+}
+
+// Vet runs the analyzers, all Analyzers if nil, on the core program prog
+// with the given number of inputs, see Pass. The diagnostics are sorted by
+// position.
+func Vet(prog *Expr, inputs int, analyzers []Analyzer) []Diagnostic {
+	if analyzers == nil {
+		analyzers = Analyzers
+	}
+	pass := &Pass{Prog: prog, Inputs: inputs}
+	for _, a := range analyzers {
+		pass.analyzer = a.Name
+		a.Run(pass)
+	}
+	sort.SliceStable(pass.diags, func(i, j int) bool {
+		p, q := pass.diags[i].Pos, pass.diags[j].Pos
+		return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+	})
+	return pass.diags
+}
+
+// access returns the variable written by e, or -1, and the variables read
+// by e, not including subexpressions. A decrement reads its variable.
+func access(e *Expr) (int, []int) {
+	switch e.Type {
+	case INCR_EXPR:
+		incr := e.IncrExpr
+		switch {
+		case incr.General && incr.Source != incr.Variable:
+			return incr.Variable, []int{incr.Source}
+		case incr.Decrement || incr.General:
+			return incr.Variable, []int{incr.Variable}
+		}
+		return incr.Variable, nil
+	case WHILE_EXPR:
+		return -1, []int{e.WhileExpr.Variable}
+	}
+	return -1, nil
+}
+
+// isDecrement reports whether e decrements a variable, which never makes it
+// non-zero.
+func isDecrement(e *Expr) bool {
+	if e.Type != INCR_EXPR {
+		return false
+	}
+	incr := e.IncrExpr
+	return incr.Decrement && (!incr.General || incr.Source == incr.Variable)
+}
+
+// checkUninit reports variables which are read but never written.
+func checkUninit(pass *Pass) {
+	written := make(map[int]bool)
+	Walk(pass.Prog, func(e *Expr) bool {
+		if w, _ := access(e); w >= 0 && !isDecrement(e) {
+			written[w] = true
+		}
+		return true
+	})
+	reported := make(map[int]bool)
+	Walk(pass.Prog, func(e *Expr) bool {
+		_, reads := access(e)
+		for _, v := range reads {
+			if !written[v] && !pass.isInput(v) && !reported[v] {
+				reported[v] = true
+				pass.Reportf(e.Pos, "x%d is read but never written, so it is always 0", v)
+			}
+		}
+		return true
+	})
+}
+
+// checkDeadLoop reports loops whose variable is always 0 before the loop.
+// Generated code clears variables which may already be 0, so its loops are
+// skipped.
+func checkDeadLoop(pass *Pass) {
+	analyzeSigns(pass, func(e *Expr, s signState) {
+		if e.Type == WHILE_EXPR && s.get(e.WhileExpr.Variable) == signZero && !pass.generated(e) {
+			pass.Reportf(e.Pos, "x%d is always 0, so the loop is never entered", e.WhileExpr.Variable)
+		}
+	})
+}
+
+// checkInfLoop reports loops whose body does not write the loop variable.
+func checkInfLoop(pass *Pass) {
+	Walk(pass.Prog, func(e *Expr) bool {
+		if e.Type != WHILE_EXPR {
+			return true
+		}
+		v := e.WhileExpr.Variable
+		modified := false
+		Walk(e.WhileExpr.P, func(e *Expr) bool {
+			if w, _ := access(e); w == v {
+				modified = true
+			}
+			return !modified
+		})
+		if !modified {
+			pass.Reportf(e.Pos, "the body never modifies x%d, so the loop does not halt if entered", v)
+		}
+		return true
+	})
+}
+
+// checkZeroDecr reports decrements of variables which are always 0, except
+// in generated code like checkDeadLoop.
+func checkZeroDecr(pass *Pass) {
+	analyzeSigns(pass, func(e *Expr, s signState) {
+		if isDecrement(e) && s.get(e.IncrExpr.Variable) == signZero && !pass.generated(e) {
+			pass.Reportf(e.Pos, "x%d is always 0, so the decrement has no effect", e.IncrExpr.Variable)
+		}
+	})
+}
+
+// checkUnusedInput reports input variables which do not occur in the
+// program. It needs the number of inputs.
+func checkUnusedInput(pass *Pass) {
+	used := make(map[int]bool)
+	mapVariables(cloneExpr(pass.Prog), func(v int) int {
+		used[v] = true
+		return v
+	})
+	for v := 1; v <= pass.Inputs; v++ {
+		if !used[v] {
+			pass.Reportf(pass.Prog.Pos, "input x%d is never used", v)
+		}
+	}
+}
+
+// checkOverwrite reports writes to x0 which are followed by a statement
+// overwriting x0 in the same sequence, without using x0 in between. x0 is
+// overwritten by `WHILE x0 != 0 DO x0 := x0 - 1 END` and `x0 := xM ± c`.
+func checkOverwrite(pass *Pass) {
+	overwrites := func(e *Expr) bool {
+		if e.Type == INCR_EXPR {
+			incr := e.IncrExpr
+			return incr.Variable == 0 && incr.General && incr.Source != 0
+		}
+		if e.Type != WHILE_EXPR || e.WhileExpr.Variable != 0 || e.WhileExpr.P.Type != INCR_EXPR {
+			return false
+		}
+		body := e.WhileExpr.P.IncrExpr
+		return body.Variable == 0 && body.Decrement && (!body.General || body.Source == 0 && body.Constant > 0)
+	}
+	uses := func(e *Expr) bool {
+		used := false
+		mapVariables(cloneExpr(e), func(v int) int {
+			used = used || v == 0
+			return v
+		})
+		return used
+	}
+
+	var check func(e *Expr)
+	check = func(e *Expr) {
+		stmts := statements(e)
+		for i, stmt := range stmts {
+			if stmt.Type == WHILE_EXPR {
+				check(stmt.WhileExpr.P)
+			}
+			if w, _ := access(stmt); w != 0 {
+				continue
+			}
+			for _, next := range stmts[i+1:] {
+				if overwrites(next) {
+					pass.Reportf(stmt.Pos, "x0 is overwritten at %s before it is used", next.Pos)
+					break
+				}
+				if uses(next) {
+					break
+				}
+			}
+		}
+	}
+	check(pass.Prog)
+}
+
+// sign is the abstract value of a variable: 0, positive or unknown.
+type sign int8
+
+const (
+	signZero sign = iota
+	signPositive
+	signUnknown
+)
+
+// signState is the abstract value of all variables at a point of the
+// program. Variables which are not in the map are 0. A nil state is
+// unreachable.
+type signState map[int]sign
+
+// get returns the sign of xV.
+func (s signState) get(v int) sign {
+	return s[v]
+}
+
+// set returns a copy of s with xV set to x.
+func (s signState) set(v int, x sign) signState {
+	c := make(signState, len(s)+1)
+	for w, y := range s {
+		c[w] = y
+	}
+	if x == signZero {
+		delete(c, v)
+	} else {
+		c[v] = x
+	}
+	return c
+}
+
+// join returns the state which covers s and t.
+func (s signState) join(t signState) signState {
+	if s == nil {
+		return t
+	}
+	if t == nil {
+		return s
+	}
+	c := s
+	for v, x := range t {
+		if c.get(v) != x {
+			c = c.set(v, signUnknown)
+		}
+	}
+	for v := range s {
+		if _, ok := t[v]; !ok {
+			c = c.set(v, signUnknown)
+		}
+	}
+	return c
+}
+
+// equal reports whether s and t are the same state.
+func (s signState) equal(t signState) bool {
+	if (s == nil) != (t == nil) || len(s) != len(t) {
+		return false
+	}
+	for v, x := range s {
+		if t.get(v) != x {
+			return false
+		}
+	}
+	return true
+}
+
+// analyzeSigns computes the signs of the variables before every reachable
+// increment and while expression of the core program and calls visit with
+// them. At the start x0 and all variables which are not inputs are 0.
+func analyzeSigns(pass *Pass, visit func(e *Expr, s signState)) {
+	start := make(signState)
+	mapVariables(cloneExpr(pass.Prog), func(v int) int {
+		if pass.isInput(v) {
+			start[v] = signUnknown
+		}
+		return v
+	})
+	execSigns(pass.Prog, start, visit)
+}
+
+// execSigns returns the state after e starting in state s. visit may be
+// nil while computing the fixed point of a loop.
+func execSigns(e *Expr, s signState, visit func(e *Expr, s signState)) signState {
+	if s == nil {
+		return nil
+	}
+	switch e.Type {
+	case SEQ_EXPR:
+		return execSigns(e.SeqExpr.P2, execSigns(e.SeqExpr.P1, s, visit), visit)
+	case INCR_EXPR:
+		if visit != nil {
+			visit(e, s)
+		}
+		incr := e.IncrExpr
+		src, c := incr.operands()
+		switch {
+		case !incr.Decrement && c > 0:
+			return s.set(incr.Variable, signPositive)
+		case src != incr.Variable:
+			return s.set(incr.Variable, signUnknown)
+		case incr.Decrement && c > 0 && s.get(incr.Variable) != signZero:
+			return s.set(incr.Variable, signUnknown)
+		}
+		return s
+	case WHILE_EXPR:
+		if visit != nil {
+			visit(e, s)
+		}
+		v := e.WhileExpr.Variable
+		// enter returns the state at the start of the body.
+		enter := func(head signState) signState {
+			if head.get(v) == signZero {
+				return nil
+			}
+			return head.set(v, signPositive)
+		}
+		head := s
+		for {
+			next := s.join(execSigns(e.WhileExpr.P, enter(head), nil))
+			if next.equal(head) {
+				break
+			}
+			head = next
+		}
+		execSigns(e.WhileExpr.P, enter(head), visit)
+		return head.set(v, signZero)
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+// Copyright © 2018 Phileas Vöcking <paspartout@fogglabs.de>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package whilego
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		inputs   int
+		analyzer string
+		diags    []string
+	}{
+		"Uninit": {"x0 := x0 + 1;\nWHILE x3 != 0 DO x3 := x3 - 1 END", 2, "uninit",
+			[]string{"2:1: x3 is read but never written, so it is always 0 (uninit)"}},
+		"Uninit input":   {"WHILE x1 != 0 DO x1 := x1 - 1 END", -1, "uninit", nil},
+		"Uninit written": {"x3 := x3 + 1; WHILE x3 != 0 DO x3 := x3 - 1 END", 0, "uninit", nil},
+		"Dead loop": {"WHILE x2 != 0 DO x0 := x0 + 1; x2 := x2 - 1 END;\nWHILE x0 != 0 DO x0 := x0 - 1 END", 1, "deadloop",
+			[]string{"1:1: x2 is always 0, so the loop is never entered (deadloop)",
+				"2:1: x0 is always 0, so the loop is never entered (deadloop)"}},
+		"Loop after loop": {"WHILE x1 != 0 DO x1 := x1 - 1 END;\nWHILE x1 != 0 DO x1 := x1 - 1 END", 1, "deadloop",
+			[]string{"2:1: x1 is always 0, so the loop is never entered (deadloop)"}},
+		"Live loop": {addProg, 2, "deadloop", nil},
+		"Inf loop": {"x1 := x1 + 1;\nWHILE x1 != 0 DO x0 := x0 + 1; WHILE x2 != 0 DO x2 := x2 - 1 END END", -1, "infloop",
+			[]string{"2:1: the body never modifies x1, so the loop does not halt if entered (infloop)"}},
+		"Zero decrement": {"x0 := x0 - 1;\nx1 := x1 - 1;\nx2 := x2 + 1; x2 := x2 - 1; x2 := x2 - 1", 0, "zerodecr",
+			[]string{"1:1: x0 is always 0, so the decrement has no effect (zerodecr)",
+				"2:1: x1 is always 0, so the decrement has no effect (zerodecr)"}},
+		"Decrement in loop": {"WHILE x1 != 0 DO x1 := x1 - 1; x2 := x2 - 1; x2 := x2 + 1 END", 1, "zerodecr", nil},
+		"Unused input": {"x0 := x0 + 1;\nx2 := x2 - 1", 3, "unusedinput",
+			[]string{"1:1: input x1 is never used (unusedinput)", "1:1: input x3 is never used (unusedinput)"}},
+		"Overwrite": {"x0 := x0 + 1;\nx1 := x1 + 1;\nWHILE x0 != 0 DO x0 := x0 - 1 END", 0, "overwrite",
+			[]string{"1:1: x0 is overwritten at 3:1 before it is used (overwrite)"}},
+		"Used before overwrite": {"x0 := x0 + 1;\nWHILE x0 != 0 DO x0 := x0 - 1; x1 := x1 + 1 END;\nWHILE x0 != 0 DO x0 := x0 - 1 END", 0, "overwrite", nil},
+	}
+
+	for caseName, testCase := range tests {
+		a, ok := LookupAnalyzer(testCase.analyzer)
+		if !ok {
+			t.Fatalf("%s: unknown analyzer %s", caseName, testCase.analyzer)
+		}
+		var got []string
+		for _, d := range Vet(mustParse(t, testCase.input), testCase.inputs, []Analyzer{a}) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(testCase.diags, "\n") {
+			t.Errorf("%s: expected\n%s\ngot\n%s", caseName, strings.Join(testCase.diags, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestVetOverwriteAssign(t *testing.T) {
+	prog, err := NewParser(strings.NewReader("x0 := x0 + 2;\nx0 := x1 + 1"), SchoeningDialect).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags := Vet(prog, 1, nil)
+	if len(diags) != 1 || diags[0].String() != "1:1: x0 is overwritten at 2:1 before it is used (overwrite)" {
+		t.Errorf("unexpected diagnostics %v", diags)
+	}
+}
+
+func TestVetSigns(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		diags []string
+	}{
+		// Adding 0 does not make x2 positive, so the loop is never entered.
+		"Add zero": {"x2 := x2 + 0;\nWHILE x2 != 0 DO x2 := x2 - 1 END",
+			[]string{"2:1: x2 is always 0, so the loop is never entered (deadloop)"}},
+		"Add constant": {"x2 := x2 + 3;\nWHILE x2 != 0 DO x2 := x2 - 1 END", nil},
+		"Copy input":   {"x2 := x1 + 0;\nWHILE x2 != 0 DO x2 := x2 - 1 END", nil},
+		"Large variables": {"WHILE x9000000000000000000 != 0 DO x900000000000 := x900000000000 - 1 END",
+			[]string{"1:1: x9000000000000000000 is always 0, so the loop is never entered (deadloop)"}},
+	}
+
+	deadloop, _ := LookupAnalyzer("deadloop")
+	for caseName, testCase := range tests {
+		prog, err := NewParser(strings.NewReader(testCase.input), SchoeningDialect).Parse()
+		if err != nil {
+			t.Errorf("%s: %s", caseName, err)
+			continue
+		}
+		diags := Vet(prog, 1, []Analyzer{deadloop})
+		if fmt.Sprint(diags) != fmt.Sprint(testCase.diags) {
+			t.Errorf("%s: expected %v, got %v", caseName, testCase.diags, diags)
+		}
+	}
+}
+
+func TestVetClean(t *testing.T) {
+	for _, input := range []string{addProg, mulProg} {
+		if diags := Vet(mustParse(t, input), 2, nil); len(diags) != 0 {
+			t.Errorf("unexpected diagnostics %v", diags)
+		}
+	}
+}
+
+func TestVetGenerated(t *testing.T) {
+	// The macros of the standard library and the desugared statements clear
+	// variables, which are already 0, but they are not in the source.
+	tests := map[string]int{
+		"IF(x1, { x0 := x0 + 1 })":                   1,
+		"IFELSE(x1, { SET(x0, 1) }, { SET(x0, 2) })": 1,
+		"SET(x0, 37)":                                0,
+		"ASSIGN(x0, x1)":                             1,
+		"INPUT a, b; OUTPUT r;\nADD(r, a, b)":        2,
+	}
+	for name := range stdlibOps {
+		tests[fmt.Sprintf("%s(x0, x1, x2)", name)] = 2
+	}
+	for input, inputs := range tests {
+		prog, _, err := ParseMacrosWith(input, NamedDialect)
+		if err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+		if diags := Vet(prog, inputs, nil); len(diags) != 0 {
+			t.Errorf("%s: unexpected diagnostics %v", input, diags)
+		}
+	}
+
+	prog := mustDesugar(t, mustParseSugar(t, "x2 := 5;\nx3 := x1 * x2;\nIF x3 = 0 THEN x0 := 1 ELSE x0 := x3 + 2 END"))
+	if diags := Vet(prog, 1, nil); len(diags) != 0 {
+		t.Errorf("unexpected diagnostics %v", diags)
+	}
+
+	// Loops in the source are still reported.
+	prog, _, err := ParseMacros("ADD(x0, x1, x2);\nWHILE x3 != 0 DO x3 := x3 - 1 END")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadloop, _ := LookupAnalyzer("deadloop")
+	expected := "[2:1: x3 is always 0, so the loop is never entered (deadloop)]"
+	if diags := Vet(prog, 2, []Analyzer{deadloop}); fmt.Sprint(diags) != expected {
+		t.Errorf("expected %s, got %v", expected, diags)
+	}
+}
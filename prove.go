@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var proveCmd = &command{
+	name:  "prove",
+	usage: "[-inputs k] [-dialect name] [-v] file...",
+	short: "try to prove that programs halt or do not halt",
+}
+
+func init() {
+	proveCmd.run = runProve
+}
+
+func runProve(args []string) error {
+	flags := newFlagSet(proveCmd)
+	inputs := flags.Int("inputs", -1, "number of input variables, -1 for the INPUT header or unknown")
+	verbose := flags.Bool("v", false, "print the result for every loop")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing file")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+
+	diverging := 0
+	for _, file := range flags.Args() {
+		prog, _, names, err := parseProgram(file, dialect)
+		if err != nil {
+			return err
+		}
+		result, loops := whilego.ProveTermination(prog, inputCount(*inputs, names))
+		if *verbose {
+			for _, info := range loops {
+				fmt.Printf("%s:%s\n", file, names.Replace(info.String()))
+			}
+		}
+		fmt.Printf("%s: %s\n", file, names.Replace(result.String()))
+		if result.Kind == whilego.TERM_DIVERGES {
+			diverging++
+		}
+	}
+	if diverging > 0 {
+		return fmt.Errorf("%d programs do not halt", diverging)
+	}
+	return nil
+}
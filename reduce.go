@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var reduceCmd = &command{
+	name:  "reduce",
+	usage: "-expect n|-diverge|-engine name [-limit steps] [-dialect name] file [input...]",
+	short: "minimise a program while it still misbehaves",
+}
+
+func init() {
+	reduceCmd.run = runReduce
+}
+
+func runReduce(args []string) error {
+	flags := newFlagSet(reduceCmd)
+	expect := flags.String("expect", "", "keep programs which halt with x0 different from `n`")
+	diverge := flags.Bool("diverge", false, "keep programs which exceed the step limit")
+	engineName := flags.String("engine", "", "keep programs on which the engine `name` differs from the interpreter")
+	limit := flags.Int("limit", 10000, "maximum number of steps")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 || *limit < 1 {
+		flags.Usage()
+		return fmt.Errorf("missing file")
+	}
+
+	input, err := parseInput(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+	var interesting []func(*whilego.Expr) bool
+	if *expect != "" {
+		n, err := strconv.ParseUint(*expect, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid expected output: %s", err)
+		}
+		interesting = append(interesting, func(prog *whilego.Expr) bool {
+			x0, err := whilego.Run(prog, *limit, input...)
+			return err == nil && x0 != n
+		})
+	}
+	if *diverge {
+		interesting = append(interesting, func(prog *whilego.Expr) bool {
+			_, err := whilego.Run(prog, *limit, input...)
+			return err == whilego.ErrStepLimit
+		})
+	}
+	if *engineName != "" {
+		e, ok := whilego.LookupEngine(*engineName)
+		if !ok {
+			return fmt.Errorf("unknown engine %q", *engineName)
+		}
+		interesting = append(interesting, func(prog *whilego.Expr) bool {
+			return whilego.Diff(prog, *limit, input, []whilego.Engine{e}) != nil
+		})
+	}
+	if len(interesting) != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected exactly one of -expect, -diverge and -engine")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	prog, err := parseCoreProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	if !interesting[0](prog) {
+		return fmt.Errorf("%s does not misbehave", flags.Arg(0))
+	}
+	reduced := whilego.Reduce(prog, interesting[0])
+	fmt.Fprintf(os.Stderr, "reduced from %d to %d statements\n", whilego.Size(prog), whilego.Size(reduced))
+	fmt.Println(whilego.Format(reduced))
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var runCmd = &command{
+	name:  "run",
+	usage: "[-limit n] [-dialect name | -loop | -goto] [-trace n] [-profile] [-pprof out.pb.gz] [-coverprofile cover.out] file [x1 x2 ...]",
+	short: "run a program and print x0",
+}
+
+func init() {
+	runCmd.run = runRun
+}
+
+func runRun(args []string) error {
+	flags := newFlagSet(runCmd)
+	limit := flags.Int("limit", 0, "maximum number of steps, 0 means no limit")
+	dialectName := dialectFlag(flags)
+	loop := flags.Bool("loop", false, "run a program of the LOOP language")
+	gotoProg := flags.Bool("goto", false, "run a program of the GOTO language")
+	profile := flags.Bool("profile", false, "print the source annotated with execution counts to stderr")
+	pprofFile := flags.String("pprof", "", "write a pprof profile of the execution counts to `file`")
+	coverFile := flags.String("coverprofile", "", "add the coverage of this run to the coverage profile `file`")
+	traceLen := flags.Int("trace", 0, "print the last `n` steps to stderr")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return fmt.Errorf("missing file")
+	}
+	if *traceLen < 0 {
+		flags.Usage()
+		return fmt.Errorf("invalid arguments")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	if *gotoProg {
+		if *loop {
+			return fmt.Errorf("-loop and -goto can not be combined")
+		}
+		if *dialectName != "strict" {
+			return fmt.Errorf("-dialect and -goto can not be combined")
+		}
+		if *profile || *pprofFile != "" || *coverFile != "" || *traceLen > 0 {
+			return fmt.Errorf("GOTO programs can not be profiled or traced")
+		}
+		return runGotoProgram(flags.Arg(0), *limit, flags.Args()[1:])
+	}
+
+	if *loop {
+		if *dialectName != "strict" {
+			return fmt.Errorf("-loop and -dialect can not be combined")
+		}
+		dialect = whilego.LoopDialect
+	}
+	prog, src, names, err := parseProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	input, err := parseInput(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	in := whilego.NewInterpreter(prog, input...)
+	var prof *whilego.Profile
+	if *profile || *pprofFile != "" {
+		prof = whilego.NewProfile(prog)
+		in.SetTracer(prof)
+	}
+	var cover *whilego.Coverage
+	if *coverFile != "" {
+		if prof != nil {
+			return fmt.Errorf("profiling and coverage can not be combined")
+		}
+		cover = whilego.NewCoverage(prog)
+		cover.Attach(in)
+	}
+	var trace *whilego.TraceTail
+	if *traceLen > 0 {
+		if prof != nil || cover != nil {
+			return fmt.Errorf("tracing can not be combined with profiling or coverage")
+		}
+		trace = whilego.NewTraceTail(in, *traceLen)
+	}
+
+	runErr := in.Run(*limit)
+	if runErr == nil {
+		fmt.Println(in.Var(0))
+	}
+
+	// The trace and the profile are also written if the step limit was
+	// exceeded, since they show where the time was spent. Registers are
+	// shown by the names of the program.
+	if trace != nil {
+		for _, entry := range trace.Entries() {
+			fmt.Fprintln(os.Stderr, names.Replace(entry.String()))
+		}
+	}
+	if *profile {
+		if err = prof.WriteListing(os.Stderr, src); err != nil {
+			return err
+		}
+	}
+	if *pprofFile != "" {
+		if err = writePprof(prof, *pprofFile, flags.Arg(0)); err != nil {
+			return err
+		}
+	}
+	if *coverFile != "" {
+		if err = writeCoverProfile(cover, *coverFile, flags.Arg(0)); err != nil {
+			return err
+		}
+	}
+	return runErr
+}
+
+// writeCoverProfile adds the coverage of the program in the source file to
+// the coverage profile with the given name. Blocks of other source files in
+// the profile are kept.
+func writeCoverProfile(cover *whilego.Coverage, filename, source string) error {
+	old, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = cover.ReadProfile(bytes.NewReader(old), source); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	var buf bytes.Buffer
+	if err = cover.WriteProfile(&buf, source); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(old), "\n") {
+		if line != "" && !strings.HasPrefix(line, "mode: ") && !strings.HasPrefix(line, source+":") {
+			fmt.Fprintln(&buf, line)
+		}
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0666)
+}
+
+// writePprof writes the profile of the program in the source file to the
+// file with the given name.
+func writePprof(prof *whilego.Profile, filename, source string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = prof.WritePprof(f, source); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var testCmd = &command{
+	name:  "test",
+	usage: "[-limit n] [-parallel n] [-trace n] [-dialect name] [-v] [dir | dir/... | file.while ...]",
+	short: "run the tests in the .tests files next to the programs",
+}
+
+func init() {
+	testCmd.run = runTest
+}
+
+// testProgram is a program and its test cases found by the test command.
+type testProgram struct {
+	file     string
+	testFile string
+	prog     *whilego.Expr
+	names    *whilego.Names
+	err      error
+	tests    []whilego.TestCase
+	results  []whilego.TestResult
+	duration time.Duration
+}
+
+func runTest(args []string) error {
+	flags := newFlagSet(testCmd)
+	limit := flags.Int("limit", 1000000, "maximum number of steps per test, 0 means no limit")
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of tests to run in parallel")
+	traceLen := flags.Int("trace", 10, "number of steps to show for failed tests")
+	verbose := flags.Bool("v", false, "print all tests, not only the failed ones")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if *limit < 0 || *parallel < 1 || *traceLen < 0 {
+		flags.Usage()
+		return fmt.Errorf("invalid arguments")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+
+	patterns := flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	files, err := findPrograms(patterns)
+	if err != nil {
+		return err
+	}
+
+	programs := make([]*testProgram, len(files))
+	for i, file := range files {
+		programs[i] = loadTestProgram(file, dialect)
+	}
+	runTestPrograms(programs, *limit, *traceLen, *parallel)
+
+	failed := 0
+	for _, p := range programs {
+		if !printTestProgram(os.Stdout, p, *verbose) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Println("FAIL")
+		return fmt.Errorf("%d of %d programs failed", failed, len(programs))
+	}
+	return nil
+}
+
+// findPrograms returns the .while files matching the patterns. A pattern is
+// either a file, a directory or a directory followed by /... to include all
+// subdirectories.
+func findPrograms(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if dir := strings.TrimSuffix(pattern, "..."); dir != pattern {
+			if dir == "" {
+				dir = "."
+			}
+			err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() && filepath.Ext(path) == ".while" {
+					files = append(files, path)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(pattern, "*.while"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// loadTestProgram parses the program in the given dialect and reads the test
+// file next to it, which is either name.tests or name.tests.json.
+func loadTestProgram(file string, d whilego.Dialect) *testProgram {
+	p := &testProgram{file: file}
+	p.prog, _, p.names, p.err = parseProgram(file, d)
+	if p.err != nil {
+		return p
+	}
+
+	base := strings.TrimSuffix(file, ".while")
+	for _, testFile := range []string{base + ".tests", base + ".tests.json"} {
+		f, err := os.Open(testFile)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			p.err = err
+			return p
+		}
+
+		p.testFile = testFile
+		if strings.HasSuffix(testFile, ".json") {
+			p.tests, err = whilego.ParseTestsJSON(f)
+		} else {
+			p.tests, err = whilego.ParseTests(f)
+		}
+		f.Close()
+		if err != nil {
+			p.err = fmt.Errorf("%s: %s", testFile, err)
+		}
+		return p
+	}
+	return p
+}
+
+// runTestPrograms runs all test cases of the programs using parallel workers.
+func runTestPrograms(programs []*testProgram, limit, traceLen, parallel int) {
+	type job struct {
+		p *testProgram
+		i int
+	}
+	jobs := make(chan job)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				start := time.Now()
+				result := whilego.RunTest(j.p.prog, j.p.tests[j.i], limit, traceLen)
+				mu.Lock()
+				j.p.results[j.i] = result
+				j.p.duration += time.Since(start)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, p := range programs {
+		if p.err != nil {
+			continue
+		}
+		p.results = make([]whilego.TestResult, len(p.tests))
+		for i := range p.tests {
+			jobs <- job{p, i}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// printTestProgram prints the results of the program in the style of go test
+// and returns whether all tests passed.
+func printTestProgram(w io.Writer, p *testProgram, verbose bool) bool {
+	if p.err != nil {
+		fmt.Fprintf(w, "FAIL\t%s [setup failed]\n    %s\n", p.file, p.err)
+		return false
+	}
+	if p.testFile == "" {
+		fmt.Fprintf(w, "?   \t%s\t[no test files]\n", p.file)
+		return true
+	}
+
+	passed := true
+	for i, r := range p.results {
+		// Test cases from JSON files have no line, so use their index.
+		name := fmt.Sprintf("%s:%d (%s)", p.testFile, r.Case.Line, r.Case)
+		if r.Case.Line == 0 {
+			name = fmt.Sprintf("%s#%d (%s)", p.testFile, i+1, r.Case)
+		}
+		if r.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "--- PASS: %s (%d steps)\n", name, r.Steps)
+			}
+			continue
+		}
+
+		passed = false
+		fmt.Fprintf(w, "--- FAIL: %s\n", name)
+		if r.Err != nil {
+			fmt.Fprintf(w, "    %s after %d steps, x0 = %d\n", r.Err, r.Steps, r.Got)
+		} else {
+			fmt.Fprintf(w, "    got x0 = %d, want %d after %d steps\n", r.Got, r.Case.Expected, r.Steps)
+		}
+		for _, entry := range r.Trace {
+			fmt.Fprintf(w, "        %s\n", p.names.Replace(entry.String()))
+		}
+	}
+
+	status := "ok  "
+	if !passed {
+		status = "FAIL"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%.3fs\n", status, p.file, p.duration.Seconds())
+	return passed
+}
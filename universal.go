@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var universalCmd = &command{
+	name:  "universal",
+	usage: "[-args [-dialect name] file [input...]]",
+	short: "print a universal program or its inputs for a program",
+}
+
+func init() {
+	universalCmd.run = runUniversal
+}
+
+func runUniversal(args []string) error {
+	flags := newFlagSet(universalCmd)
+	inputs := flags.Bool("args", false, "print the inputs of the universal program to run the program in file with the input")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if !*inputs {
+		if flags.NArg() != 0 {
+			flags.Usage()
+			return fmt.Errorf("unexpected arguments")
+		}
+		fmt.Println(whilego.Format(whilego.Universal()))
+		return nil
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a file")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+	prog, err := parseCoreProgram(flags.Arg(0), dialect)
+	if err != nil {
+		return err
+	}
+	input, err := parseInput(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+	code, err := whilego.Encode(prog)
+	if err != nil {
+		return err
+	}
+	fmt.Println(code, whilego.EncodeInput(input...))
+	return nil
+}
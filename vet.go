@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	whilego "github.com/Paspartout/whilego/pkg"
+)
+
+var vetCmd = &command{
+	name:  "vet",
+	usage: "[-inputs k] [-dialect name] [-enable names] [-disable names] file...",
+	short: "report suspicious constructs in programs",
+}
+
+func init() {
+	vetCmd.run = runVet
+}
+
+// analyzerNames returns the names of the analyzers for the usage message.
+func analyzerNames() string {
+	var names []string
+	for _, a := range whilego.Analyzers {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func runVet(args []string) error {
+	flags := newFlagSet(vetCmd)
+	inputs := flags.Int("inputs", -1, "number of input variables, -1 for the INPUT header or unknown")
+	enable := flags.String("enable", "", "comma separated analyzers to run, all by default, of "+analyzerNames())
+	disable := flags.String("disable", "", "comma separated analyzers not to run")
+	dialectName := dialectFlag(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing file")
+	}
+
+	dialect, err := lookupDialect(*dialectName)
+	if err != nil {
+		return err
+	}
+
+	lookup := func(list string) (map[string]bool, error) {
+		names := make(map[string]bool)
+		for _, name := range strings.Split(list, ",") {
+			if name == "" {
+				continue
+			}
+			if _, ok := whilego.LookupAnalyzer(name); !ok {
+				return nil, fmt.Errorf("unknown analyzer %q", name)
+			}
+			names[name] = true
+		}
+		return names, nil
+	}
+	enabled, err := lookup(*enable)
+	if err != nil {
+		return err
+	}
+	disabled, err := lookup(*disable)
+	if err != nil {
+		return err
+	}
+	var analyzers []whilego.Analyzer
+	for _, a := range whilego.Analyzers {
+		if (len(enabled) == 0 || enabled[a.Name]) && !disabled[a.Name] {
+			analyzers = append(analyzers, a)
+		}
+	}
+
+	problems := 0
+	noted := false
+	for _, file := range flags.Args() {
+		prog, _, names, err := parseProgram(file, dialect)
+		if err != nil {
+			return err
+		}
+		n := inputCount(*inputs, names)
+		if n < 0 && !noted {
+			fmt.Fprintln(os.Stderr, "whilego vet: the number of inputs is unknown, so unusedinput is skipped "+
+				"and all variables may be inputs, set it with -inputs")
+			noted = true
+		}
+		for _, d := range whilego.Vet(prog, n, analyzers) {
+			fmt.Printf("%s:%s\n", file, names.Replace(d.String()))
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	return nil
+}